@@ -0,0 +1,109 @@
+package logger
+
+import "sync"
+
+// asyncWriter writes log entries to the sinks of a logger from a background goroutine
+type asyncWriter struct {
+	logger  *Logger
+	entries chan asyncItem
+	done    chan struct{}
+
+	// mu is held for reading while queueing and for writing while closing,
+	// so that nothing is sent on the channel after it has been closed
+	mu     sync.RWMutex
+	closed bool
+}
+
+// asyncItem is either an entry to write or a flush request
+type asyncItem struct {
+	entry logEntry
+	// written is closed once the entry is written, nil when nobody waits for it
+	written chan struct{}
+	// flushed is closed once all entries queued before it are written, nil for entries
+	flushed chan struct{}
+}
+
+// newAsyncWriter starts the goroutine writing entries for l
+func newAsyncWriter(l *Logger, bufferSize int) *asyncWriter {
+	w := &asyncWriter{
+		logger:  l,
+		entries: make(chan asyncItem, bufferSize),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// run writes queued entries until the queue is closed
+func (w *asyncWriter) run() {
+	defer close(w.done)
+
+	for item := range w.entries {
+		if item.flushed != nil {
+			close(item.flushed)
+			continue
+		}
+
+		w.logger.mu.Lock()
+		w.logger.writeEntry(item.entry)
+		w.logger.mu.Unlock()
+		if item.written != nil {
+			close(item.written)
+		}
+	}
+}
+
+// enqueue queues an entry, blocking while the queue is full
+// With wait it also waits until the entry is written, entries logged after Close are dropped
+func (w *asyncWriter) enqueue(e logEntry, wait bool) {
+	item := asyncItem{entry: e}
+	if wait {
+		item.written = make(chan struct{})
+	}
+
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return
+	}
+	w.entries <- item
+	w.mu.RUnlock()
+
+	if wait {
+		<-item.written
+	}
+}
+
+// flush waits until all entries queued so far are written
+func (w *asyncWriter) flush() {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		<-w.done
+		return
+	}
+	flushed := make(chan struct{})
+	w.entries <- asyncItem{flushed: flushed}
+	w.mu.RUnlock()
+
+	<-flushed
+}
+
+// close writes the remaining entries and stops the goroutine
+func (w *asyncWriter) close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.entries)
+	}
+	w.mu.Unlock()
+
+	<-w.done
+}
+
+// Flush waits until all queued entries are written, it returns immediately for synchronous loggers
+func (l *Logger) Flush() {
+	if l.async != nil {
+		l.async.flush()
+	}
+}
@@ -0,0 +1,177 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingWriter blocks every write until release is closed
+type blockingWriter struct {
+	release chan struct{}
+	mu      sync.Mutex
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *blockingWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+// TestAsyncFlush tests that Flush waits for queued entries
+func TestAsyncFlush(t *testing.T) {
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(t.TempDir()),
+		WithAsync(8),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	for i := 0; i < 100; i++ {
+		logger.Info("Async entry %d", i)
+	}
+	logger.Flush()
+
+	content, err := os.ReadFile(logger.GetCurrentLogFile())
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 100 {
+		t.Fatalf("Log lines = %d, want 100", len(lines))
+	}
+	if !strings.HasSuffix(lines[99], "Async entry 99") {
+		t.Errorf("Last line = %q, want the last entry", lines[99])
+	}
+}
+
+// TestAsyncCloseFlushes tests that Close writes all queued entries
+func TestAsyncCloseFlushes(t *testing.T) {
+	writer := &blockingWriter{release: make(chan struct{})}
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(writer), WithAsync(10))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		logger.Info("Pending entry %d", i)
+	}
+
+	// Nothing can be written while the writer is blocked, Close must still deliver everything
+	time.AfterFunc(50*time.Millisecond, func() { close(writer.release) })
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if got := strings.Count(writer.String(), "Pending entry"); got != 5 {
+		t.Errorf("Entries written after Close = %d, want 5", got)
+	}
+
+	// Entries logged after Close are dropped instead of panicking
+	logger.Info("After close")
+	logger.Flush()
+}
+
+// TestAsyncBlocksWhenFull tests the block policy: a full queue makes logging wait instead of dropping entries
+func TestAsyncBlocksWhenFull(t *testing.T) {
+	writer := &blockingWriter{release: make(chan struct{})}
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(writer), WithAsync(1))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// One entry is being written, one fills the queue, the third has to wait
+		for i := 0; i < 3; i++ {
+			logger.Info("Blocking entry %d", i)
+		}
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("Logging returned while the queue was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(writer.release)
+	<-done
+	logger.Flush()
+
+	if got := strings.Count(writer.String(), "Blocking entry"); got != 3 {
+		t.Errorf("Entries written = %d, want 3", got)
+	}
+}
+
+// TestAsyncHooksRunAfterWrite tests that hooks see the entry already written in async mode
+func TestAsyncHooksRunAfterWrite(t *testing.T) {
+	writer := &blockingWriter{release: make(chan struct{})}
+	time.AfterFunc(50*time.Millisecond, func() { close(writer.release) })
+
+	var seen []string
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithWriter(writer),
+		WithAsync(8),
+		WithHook(func(level LogLevel, message string) {
+			seen = append(seen, writer.String())
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	logger.Info("First entry")
+	logger.Info("Second entry")
+
+	if len(seen) != 2 || !strings.Contains(seen[0], "First entry") || !strings.Contains(seen[1], "Second entry") {
+		t.Errorf("Writer contents seen by the hook = %q, want each entry written before its hook", seen)
+	}
+}
+
+// TestAsyncConcurrent logs from several goroutines, run with -race
+func TestAsyncConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf), WithAsync(4))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				logger.Info("Concurrent entry %d", j)
+			}
+		}()
+	}
+	wg.Wait()
+	logger.Close()
+
+	if got := strings.Count(buf.String(), "Concurrent entry"); got != 200 {
+		t.Errorf("Entries written = %d, want 200", got)
+	}
+}
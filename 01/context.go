@@ -0,0 +1,60 @@
+package logger
+
+import "context"
+
+// contextField is a context key registered with WithContextKey
+type contextField struct {
+	key   any
+	field string
+}
+
+// WithContextKey adds the value stored in a context under key as field to the entries
+// of the *Ctx methods and of slog records, contexts without the key add nothing
+func WithContextKey(key any, field string) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.contextFields = append(c.contextFields, contextField{key: key, field: field})
+	}
+}
+
+// fromContext returns a logger with the registered context values as fields, or l when there are none
+func (l *Logger) fromContext(ctx context.Context) *Logger {
+	if ctx == nil || len(l.contextFields) == 0 {
+		return l
+	}
+
+	var fields map[string]interface{}
+	for _, cf := range l.contextFields {
+		value := ctx.Value(cf.key)
+		if value == nil {
+			continue
+		}
+		if fields == nil {
+			fields = make(map[string]interface{}, len(l.contextFields))
+		}
+		fields[cf.field] = value
+	}
+	if fields == nil {
+		return l
+	}
+	return l.WithFields(fields)
+}
+
+// DebugCtx logs a message with DEBUG level and the values of the registered context keys
+func (l *Logger) DebugCtx(ctx context.Context, message interface{}, args ...interface{}) {
+	l.fromContext(ctx).log(callerSkip, DEBUG, formatMessage(message, args...))
+}
+
+// InfoCtx logs a message with INFO level and the values of the registered context keys
+func (l *Logger) InfoCtx(ctx context.Context, message interface{}, args ...interface{}) {
+	l.fromContext(ctx).log(callerSkip, INFO, formatMessage(message, args...))
+}
+
+// WarningCtx logs a message with WARNING level and the values of the registered context keys
+func (l *Logger) WarningCtx(ctx context.Context, message interface{}, args ...interface{}) {
+	l.fromContext(ctx).log(callerSkip, WARNING, formatMessage(message, args...))
+}
+
+// ErrorCtx logs a message with ERROR level and the values of the registered context keys
+func (l *Logger) ErrorCtx(ctx context.Context, message interface{}, args ...interface{}) {
+	l.fromContext(ctx).log(callerSkip, ERROR, formatMessage(message, args...))
+}
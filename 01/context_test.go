@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+type contextKey string
+
+const (
+	requestIDKey contextKey = "request_id"
+	userKey      contextKey = "user"
+)
+
+// newContextLogger creates a logger writing to buf that reads the request ID and user from contexts
+func newContextLogger(t *testing.T, buf *bytes.Buffer) *Logger {
+	t.Helper()
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithWriter(buf),
+		WithContextKey(requestIDKey, "request_id"),
+		WithContextKey(userKey, "user"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	return logger
+}
+
+// TestContextLogging tests that context values become fields and missing keys are skipped
+func TestContextLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newContextLogger(t, &buf)
+
+	ctx := context.WithValue(context.Background(), requestIDKey, "abc123")
+	logger.InfoCtx(ctx, "request done in %dms", 12)
+	logger.ErrorCtx(context.WithValue(ctx, userKey, "alice"), "request failed")
+	logger.WarningCtx(context.Background(), "no request")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Log lines = %d, want 3:\n%s", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "[INFO] ") || !strings.HasSuffix(lines[0], ": request done in 12ms request_id=abc123") {
+		t.Errorf("Line %q doesn't contain the request ID", lines[0])
+	}
+	if !strings.Contains(lines[0], "context_test.go:") {
+		t.Errorf("Line %q doesn't report the caller", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], ": request failed request_id=abc123 user=alice") {
+		t.Errorf("Line %q doesn't contain both values", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], ": no request") {
+		t.Errorf("Line %q has fields for a context without values", lines[2])
+	}
+}
+
+// TestContextLoggingSlog tests that slog records get the context values too
+func TestContextLoggingSlog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newContextLogger(t, &buf)
+
+	ctx := context.WithValue(context.Background(), requestIDKey, "abc123")
+	slog.New(NewSlogHandler(logger)).InfoContext(ctx, "from slog", "status", 200)
+
+	if line := strings.TrimSpace(buf.String()); !strings.HasSuffix(line, ": from slog request_id=abc123 status=200") {
+		t.Errorf("Line %q doesn't contain the request ID", line)
+	}
+}
@@ -0,0 +1,116 @@
+package logger
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxDedupEntries bounds the number of distinct messages WithDedup keeps track of,
+// entries of other messages are written normally until expired ones make room
+const maxDedupEntries = 1024
+
+// dedupKey identifies identical entries, the fields of the entry are not part of it
+type dedupKey struct {
+	level   LogLevel
+	message string
+}
+
+// dedupEntry is a message written at start, repeats counts the copies dropped since then
+type dedupEntry struct {
+	start   time.Time
+	repeats int
+}
+
+// dedupSummary is a "repeated N times" notice that is due
+type dedupSummary struct {
+	key     dedupKey
+	repeats int
+}
+
+// checkDedup reports whether the entry repeats one written within the dedup window and must be dropped,
+// and returns the notices of messages whose window has passed, l.mu must be held
+func (l *Logger) checkDedup(now time.Time, level LogLevel, message string) (bool, []dedupSummary) {
+	// Expired entries are swept at most once per window so that the cost doesn't grow with every entry
+	var due []dedupSummary
+	if now.Sub(l.dedupSwept) >= l.dedupWindow {
+		due = l.expireDedup(now, false)
+		l.dedupSwept = now
+	}
+
+	key := dedupKey{level: level, message: message}
+	if e, ok := l.dedup[key]; ok {
+		if now.Sub(e.start) < l.dedupWindow {
+			e.repeats++
+			return true, due
+		}
+		if e.repeats > 0 {
+			due = append(due, dedupSummary{key: key, repeats: e.repeats})
+		}
+		e.start, e.repeats = now, 0
+		return false, due
+	}
+
+	if len(l.dedup) >= maxDedupEntries {
+		due = append(due, l.expireDedup(now, false)...)
+		if len(l.dedup) >= maxDedupEntries {
+			return false, due
+		}
+	}
+	l.dedup[key] = &dedupEntry{start: now}
+	return false, due
+}
+
+// expireDedup forgets the messages whose window has passed, or all of them when all is true,
+// and returns the notices for those that were repeated, l.mu must be held
+func (l *Logger) expireDedup(now time.Time, all bool) []dedupSummary {
+	var due []dedupSummary
+	for key, e := range l.dedup {
+		if !all && now.Sub(e.start) < l.dedupWindow {
+			continue
+		}
+		if e.repeats > 0 {
+			due = append(due, dedupSummary{key: key, repeats: e.repeats})
+		}
+		delete(l.dedup, key)
+	}
+	return due
+}
+
+// writeRepeats logs a "repeated N times" notice per summary at the level of the message,
+// it must be called without the lock
+func (l *Logger) writeRepeats(due []dedupSummary) {
+	// The notice belongs to the logger itself, like the rate limit notice
+	root := &Logger{loggerCore: l.loggerCore, derived: true, unlimited: true}
+	for _, s := range due {
+		root.output(0, "dedup", s.key.level, fmt.Sprintf("repeated %d times: %s", s.repeats, s.key.message))
+	}
+}
+
+// startDedupFlush starts a goroutine that writes the notices of passed windows every dedupWindow,
+// so that they don't wait for the next entry, Close stops it
+func (l *Logger) startDedupFlush() {
+	l.stopDedup = make(chan struct{})
+	l.dedupDone = make(chan struct{})
+
+	go func() {
+		defer close(l.dedupDone)
+
+		ticker := time.NewTicker(l.dedupWindow)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.stopDedup:
+				return
+			case now := <-ticker.C:
+				l.mu.Lock()
+				due := l.expireDedup(now, false)
+				l.dedupSwept = now
+				l.mu.Unlock()
+				if len(due) > 0 {
+					l.writeRepeats(due)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDedup(t *testing.T) {
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(t.TempDir()),
+		WithDedup(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		logger.Error("connection to %s refused", "db")
+	}
+	// Same message at another level or another message is not a repeat
+	logger.Warning("connection to db refused")
+	logger.Error("connection to cache refused")
+	path := logger.GetCurrentLogFile()
+	logger.Close()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Log lines = %d, want 4:\n%s", len(lines), content)
+	}
+	if !strings.HasPrefix(lines[0], "[ERROR]") || !strings.HasSuffix(lines[0], ": connection to db refused") {
+		t.Errorf("First line = %q, want the first error", lines[0])
+	}
+	if !strings.HasPrefix(lines[3], "[ERROR]") || !strings.Contains(lines[3], "dedup: repeated 99 times: connection to db refused") {
+		t.Errorf("Last line = %q, want the repeat summary", lines[3])
+	}
+}
+
+func TestDedupWindowPassed(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf), WithDedup(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	for i := 0; i < 5; i++ {
+		logger.Info("flapping")
+	}
+	time.Sleep(60 * time.Millisecond)
+	logger.Info("flapping")
+
+	// The summary of the first window comes before the entry that starts the next one
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Output lines = %d, want 3:\n%s", len(lines), buf.String())
+	}
+	if !strings.Contains(lines[1], "repeated 4 times: flapping") || !strings.HasSuffix(lines[2], ": flapping") {
+		t.Errorf("Output = %q, want the summary then the new entry", lines)
+	}
+}
+
+func TestDedupFlushesWithoutNewEntry(t *testing.T) {
+	// The notice is written from another goroutine, the released blockingWriter makes reading it safe
+	buf := &blockingWriter{release: make(chan struct{})}
+	close(buf.release)
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(buf), WithDedup(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	for i := 0; i < 5; i++ {
+		logger.Info("flapping")
+	}
+
+	// Nothing else is logged, the notice is written once the window has passed
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(buf.String(), "repeated 4 times: flapping") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Output = %q, want the repeat summary without a new entry", buf.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDedupBounded(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf), WithDedup(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	// Messages beyond the tracked ones are still written
+	n := maxDedupEntries + 10
+	for i := 0; i < n; i++ {
+		logger.Info(fmt.Sprintf("message %d", i))
+	}
+	if got := strings.Count(buf.String(), "\n"); got != n {
+		t.Errorf("Output lines = %d, want %d", got, n)
+	}
+	if len(logger.dedup) > maxDedupEntries {
+		t.Errorf("Tracked messages = %d, want at most %d", len(logger.dedup), maxDedupEntries)
+	}
+}
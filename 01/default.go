@@ -0,0 +1,43 @@
+package logger
+
+import "sync/atomic"
+
+// defaultLogger is used by the package-level logging functions
+var defaultLogger atomic.Pointer[Logger]
+
+func init() {
+	// A console-only logger can't fail to be created
+	l, _ := NewLogger()
+	defaultLogger.Store(l)
+}
+
+// Default returns the logger used by the package-level logging functions
+func Default() *Logger {
+	return defaultLogger.Load()
+}
+
+// SetDefault replaces the logger used by the package-level logging functions
+// The previous default logger is not closed
+func SetDefault(l *Logger) {
+	defaultLogger.Store(l)
+}
+
+// Debug logs a message with DEBUG level through the default logger
+func Debug(message interface{}, args ...interface{}) {
+	Default().log(callerSkip, DEBUG, formatMessage(message, args...))
+}
+
+// Info logs a message with INFO level through the default logger
+func Info(message interface{}, args ...interface{}) {
+	Default().log(callerSkip, INFO, formatMessage(message, args...))
+}
+
+// Warning logs a message with WARNING level through the default logger
+func Warning(message interface{}, args ...interface{}) {
+	Default().log(callerSkip, WARNING, formatMessage(message, args...))
+}
+
+// Error logs a message with ERROR level through the default logger
+func Error(message interface{}, args ...interface{}) {
+	Default().log(callerSkip, ERROR, formatMessage(message, args...))
+}
@@ -0,0 +1,46 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestDefaultLogger tests the package-level logging functions through SetDefault
+func TestDefaultLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	custom, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf), WithMinLevel(DEBUG))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	previous := Default()
+	SetDefault(custom)
+	defer SetDefault(previous)
+
+	if Default() != custom {
+		t.Fatal("Default() doesn't return the logger set with SetDefault")
+	}
+
+	_, _, line, _ := runtime.Caller(0)
+	Debug("package debug")
+	Info("package %s", "info")
+	Warning("package warning")
+	Error("package error")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{"[DEBUG]", "[INFO]", "[WARNING]", "[ERROR]"}
+	messages := []string{"package debug", "package info", "package warning", "package error"}
+	if len(lines) != len(want) {
+		t.Fatalf("Log lines = %d, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, got := range lines {
+		location := fmt.Sprintf("default_test.go:%d:", line+1+i)
+		if !strings.HasPrefix(got, want[i]) || !strings.Contains(got, location) || !strings.HasSuffix(got, messages[i]) {
+			t.Errorf("Line %d = %q, want %s entry at %s with %q", i, got, want[i], location, messages[i])
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// levelFileConfig is a file requested with WithLevelFile
+type levelFileConfig struct {
+	level LogLevel
+	path  string
+}
+
+// levelFile is an extra file receiving the entries at or above a level, it rotates on its own
+type levelFile struct {
+	level LogLevel
+	path  string
+	file  *os.File
+	// size is the number of bytes in the current file
+	size int64
+}
+
+// openLevelFile opens path for appending, keeping the entries of earlier runs
+func openLevelFile(level LogLevel, path string) (*levelFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create log file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot create log file: %v", err)
+	}
+	return &levelFile{level: level, path: path, file: file, size: info.Size()}, nil
+}
+
+// write appends an entry, rotating first when it would make the file larger than maxFileSize
+func (f *levelFile) write(entry string, maxFileSize int64) error {
+	if maxFileSize > 0 && f.size > 0 && f.size+int64(len(entry)) > maxFileSize {
+		if err := f.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: automatic rotation of %s failed: %v\n", f.path, err)
+		}
+	}
+
+	n, err := io.WriteString(f.file, entry)
+	f.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write log file: %v", err)
+	}
+	return nil
+}
+
+// rotate renames the current file to <name>_<timestamp><ext> and starts a new one at the same path
+func (f *levelFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close current log file: %v", err)
+	}
+
+	ext := filepath.Ext(f.path)
+	stem := strings.TrimSuffix(f.path, ext)
+	timestamp := time.Now().Format(logFileTimeFormat)
+	rotated := fmt.Sprintf("%s_%s%s", stem, timestamp, ext)
+	for index := 1; fileExists(rotated); index++ {
+		rotated = fmt.Sprintf("%s_%s%s", stem, fmt.Sprintf(logFileIndexFormat, timestamp, index), ext)
+	}
+	renameErr := os.Rename(f.path, rotated)
+
+	// Reopen even when the rename failed so that logging goes on
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("cannot create log file: %v", err)
+	}
+	f.file = file
+	f.size = 0
+	if renameErr != nil {
+		if info, err := file.Stat(); err == nil {
+			f.size = info.Size()
+		}
+		return fmt.Errorf("failed to rename log file: %v", renameErr)
+	}
+	return nil
+}
+
+// close closes the current file
+func (f *levelFile) close() error {
+	return f.file.Close()
+}
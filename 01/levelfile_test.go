@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLevelFile tests that a level file only receives entries at or above its level
+func TestLevelFile(t *testing.T) {
+	tempDir := t.TempDir()
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(tempDir),
+		WithLevelFile(ERROR, "errors.log"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	mainFile := logger.GetCurrentLogFile()
+
+	logger.Info("service started")
+	logger.Error("database unreachable")
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Failed to close logger: %v", err)
+	}
+
+	errorLog, err := os.ReadFile(filepath.Join(tempDir, "errors.log"))
+	if err != nil {
+		t.Fatalf("Failed to read level file: %v", err)
+	}
+	if strings.Count(string(errorLog), "\n") != 1 || !strings.Contains(string(errorLog), "[ERROR]") || !strings.Contains(string(errorLog), "database unreachable") {
+		t.Errorf("Level file = %q, want only the error", errorLog)
+	}
+
+	main, err := os.ReadFile(mainFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(main), "service started") || !strings.Contains(string(main), "database unreachable") {
+		t.Errorf("Main file = %q, want both entries", main)
+	}
+}
+
+// TestLevelFileRotation tests that a level file rotates by size independently of the main file
+func TestLevelFileRotation(t *testing.T) {
+	tempDir := t.TempDir()
+	levelPath := filepath.Join(tempDir, "errors", "errors.log")
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(tempDir),
+		WithMaxFileSize(200),
+		WithLevelFile(ERROR, levelPath),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	// Info entries fill the main file without touching the level file
+	for i := 0; i < 5; i++ {
+		logger.Info("filling the main log file %d", i)
+	}
+	if rotated, _ := filepath.Glob(filepath.Join(tempDir, "errors", "errors_*.log")); len(rotated) != 0 {
+		t.Fatalf("Level file rotated by info entries: %v", rotated)
+	}
+
+	for i := 0; i < 5; i++ {
+		logger.Error("filling the error log file %d", i)
+	}
+	rotated, _ := filepath.Glob(filepath.Join(tempDir, "errors", "errors_*.log"))
+	if len(rotated) == 0 {
+		t.Fatal("Level file didn't rotate")
+	}
+
+	info, err := os.Stat(levelPath)
+	if err != nil {
+		t.Fatalf("Level file missing after rotation: %v", err)
+	}
+	if info.Size() > 200 {
+		t.Errorf("Level file size = %d, want at most 200", info.Size())
+	}
+}
@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// logfmtReservedKeys are the keys of the standard logfmt values, fields can't override them
+var logfmtReservedKeys = map[string]bool{
+	"level": true,
+	"ts":    true,
+	"loc":   true,
+	"msg":   true,
+	"stack": true,
+}
+
+// formatLogfmt formats a log entry as a logfmt line: level=INFO ts=... loc=file.go:12 msg="..."
+// Fields follow the standard keys in their sorted order, seq is the sequence number of the entry, 0 leaves it out
+func formatLogfmt(levelStr string, seq uint64, timestamp time.Time, location, message, stackTrace string, fields []logField) string {
+	stackTrace = strings.TrimSuffix(strings.TrimPrefix(stackTrace, "\nStack Trace:\n"), "\n")
+
+	var builder strings.Builder
+	if seq > 0 {
+		fmt.Fprintf(&builder, "seq=%d ", seq)
+	}
+	builder.WriteString("level=" + levelStr)
+	writeLogfmtPair(&builder, "ts", timestamp.Format(time.RFC3339))
+	writeLogfmtPair(&builder, "loc", location)
+	writeLogfmtPair(&builder, "msg", message)
+	if stackTrace != "" {
+		writeLogfmtPair(&builder, "stack", stackTrace)
+	}
+
+	for _, field := range fields {
+		if logfmtReservedKeys[field.key] || (seq > 0 && field.key == "seq") {
+			continue
+		}
+		writeLogfmtPair(&builder, logfmtKey(field.key), fmt.Sprint(field.value))
+	}
+	builder.WriteByte('\n')
+	return builder.String()
+}
+
+// writeLogfmtPair appends " key=value" to b, quoting the value when needed
+func writeLogfmtPair(b *strings.Builder, key, value string) {
+	b.WriteByte(' ')
+	b.WriteString(key)
+	b.WriteByte('=')
+	b.WriteString(logfmtValue(value))
+}
+
+// logfmtValue quotes values that are empty or contain spaces, quotes, '=' or control characters,
+// so that every entry stays on one line and splits back into the same pairs
+func logfmtValue(value string) string {
+	if value == "" {
+		return `""`
+	}
+	for _, r := range value {
+		if r == '"' || r == '=' || r == '\\' || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return strconv.Quote(value)
+		}
+	}
+	return value
+}
+
+// logfmtKey replaces the characters a logfmt key can't contain with '_'
+func logfmtKey(key string) string {
+	if key == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '"' || r == '=' || unicode.IsSpace(r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, key)
+}
@@ -0,0 +1,138 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseLogfmt splits a logfmt line into its key-value pairs, unquoting quoted values
+func parseLogfmt(t *testing.T, line string) map[string]string {
+	t.Helper()
+
+	pairs := make(map[string]string)
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimLeft(line, " ") {
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 {
+			t.Fatalf("Missing key in %q", line)
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			quoted, err := strconv.QuotedPrefix(line)
+			if err != nil {
+				t.Fatalf("Bad quoted value in %q: %v", line, err)
+			}
+			value, _ = strconv.Unquote(quoted)
+			line = line[len(quoted):]
+		} else {
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+			value, line = line[:end], line[end:]
+		}
+		pairs[key] = value
+	}
+	return pairs
+}
+
+func TestLogfmtFormat(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithWriter(&buf),
+		WithLogfmt(true),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	_, _, line, _ := runtime.Caller(0)
+	logger.WithFields(map[string]interface{}{"user id": 42, "path": "/a b", "msg": "ignored"}).Info(`Upload "scan.png" failed: disk full`)
+
+	out := buf.String()
+	if strings.Count(out, "\n") != 1 {
+		t.Fatalf("Output = %q, want one line", out)
+	}
+	if !strings.HasPrefix(out, "level=INFO ts=") {
+		t.Errorf("Output = %q, want it to start with level=INFO ts=", out)
+	}
+
+	pairs := parseLogfmt(t, out)
+	want := map[string]string{
+		"level":   "INFO",
+		"loc":     fmt.Sprintf("logfmt_test.go:%d", line+1),
+		"msg":     `Upload "scan.png" failed: disk full`,
+		"user_id": "42",
+		"path":    "/a b",
+	}
+	for key, value := range want {
+		if pairs[key] != value {
+			t.Errorf("%s = %q, want %q in %q", key, pairs[key], value, out)
+		}
+	}
+	if _, err := time.Parse(time.RFC3339, pairs["ts"]); err != nil {
+		t.Errorf("ts = %q is not RFC3339: %v", pairs["ts"], err)
+	}
+	if len(pairs) != len(want)+1 {
+		t.Errorf("Pairs = %v, want only the standard keys and fields", pairs)
+	}
+}
+
+func TestLogfmtValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"plain", "plain"},
+		{"", `""`},
+		{"two words", `"two words"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"a=b", `"a=b"`},
+		{"line\nbreak", `"line\nbreak"`},
+		{`C:\temp`, `"C:\\temp"`},
+	}
+
+	for _, tt := range tests {
+		if got := logfmtValue(tt.value); got != tt.want {
+			t.Errorf("logfmtValue(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLogfmtAndJSONLastOptionWins(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []LoggerOption
+		json    bool
+	}{
+		{"json then logfmt", []LoggerOption{WithJSONFormat(true), WithLogfmt(true)}, false},
+		{"logfmt then json", []LoggerOption{WithLogfmt(true), WithJSONFormat(true)}, true},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		logger, err := NewLogger(append([]LoggerOption{WithConsoleOutput(false), WithWriter(&buf)}, tt.options...)...)
+		if err != nil {
+			t.Fatalf("%s: failed to create logger: %v", tt.name, err)
+		}
+		logger.Info("hello")
+		logger.Close()
+
+		if got := strings.HasPrefix(buf.String(), "{"); got != tt.json {
+			t.Errorf("%s: output = %q, want JSON %v", tt.name, buf.String(), tt.json)
+		}
+		if !tt.json && !strings.HasPrefix(buf.String(), "level=INFO") {
+			t.Errorf("%s: output = %q, want logfmt", tt.name, buf.String())
+		}
+	}
+}
@@ -1,12 +1,19 @@
 package logger
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -15,27 +22,91 @@ const (
 	defaultLogDir     = "logs"
 	logFileTimeFormat = "2006-01-02_15-04-05"
 	logFileNameFormat = "%s.log"
+	// defaultTimeFormat is the timestamp layout of log entries
+	defaultTimeFormat = "2006-01-02 15:04:05"
+	// logFileIndexFormat is used when several files are created within the same second
+	logFileIndexFormat = "%s_%d"
 )
 
 // LogLevel defines logging levels
 type LogLevel int
 
+// DEBUG is below INFO so that the zero value of LogLevel stays INFO
 const (
-	INFO LogLevel = iota
+	DEBUG LogLevel = iota - 1
+	INFO
 	WARNING
 	ERROR
 )
 
+// String returns the name of the level as it appears in log entries
+func (level LogLevel) String() string {
+	switch level {
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARNING:
+		return "WARNING"
+	case ERROR:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(level))
+	}
+}
+
+// ParseLevel converts a level name such as "info" or "WARN" into a LogLevel
+func ParseLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return DEBUG, nil
+	case "info":
+		return INFO, nil
+	case "warning", "warn":
+		return WARNING, nil
+	case "error":
+		return ERROR, nil
+	default:
+		return INFO, fmt.Errorf("invalid log level: %q", s)
+	}
+}
+
 // ANSI color codes
 const (
 	colorReset  = "\033[0m"
+	colorCyan   = "\033[36m"
 	colorGreen  = "\033[32m"
 	colorYellow = "\033[33m"
 	colorRed    = "\033[31m"
 )
 
+// ansiColorPattern matches an SGR escape sequence such as "\033[1;35m"
+var ansiColorPattern = regexp.MustCompile(`^\x1b\[[0-9;]*m$`)
+
 // Logger contains necessary information for logging
+// Loggers derived with WithFields or With share the loggerCore of their root logger
 type Logger struct {
+	*loggerCore
+	// fields are added to every entry of this logger, sorted by key
+	fields []logField
+	// prefix is prepended to every message of this logger
+	prefix string
+	// derived is true for loggers created from another logger, they don't own the log file
+	derived bool
+	// unlimited bypasses the rate limit and deduplication, used for the suppression and repeat notices
+	unlimited bool
+}
+
+// logField is a key-value pair attached to log entries
+type logField struct {
+	key   string
+	value interface{}
+}
+
+// loggerCore holds the outputs and settings shared by a logger and the loggers derived from it
+type loggerCore struct {
+	// mu protects the log file and minLevel so a Logger can be shared between goroutines
+	mu               sync.Mutex
 	consoleOutput    bool
 	fileOutput       bool
 	logFile          *os.File
@@ -43,6 +114,70 @@ type Logger struct {
 	enableStackTrace bool
 	stackTraceLevel  LogLevel
 	stackTraceDepth  int
+	minLevel         LogLevel
+	maxFileSize      int64
+	// fileSize is the number of bytes written to the current log file
+	fileSize         int64
+	rotationInterval time.Duration
+	maxBackups       int
+	writers          []io.Writer
+	// errorWriter receives the console output of ERROR entries, nil means the current os.Stderr
+	errorWriter  io.Writer
+	jsonFormat   bool
+	logfmtFormat bool
+	timeFormat   string
+	utc          bool
+	// colorOutput enables ANSI colors on the console
+	colorOutput bool
+	// levelColors overrides the default color of some levels
+	levelColors map[LogLevel]string
+	// async writes entries from a background goroutine, nil for synchronous logging
+	async *asyncWriter
+	// callerSkip is added to the skipped frames when looking up the caller location
+	callerSkip int
+	// filePrefix is put in front of the timestamp in log file names
+	filePrefix string
+	// hooks are called in order after every entry is written
+	hooks []Hook
+	// rateLimit is the maximum number of entries per second, 0 means unlimited
+	rateLimit int
+	// syslog sends entries to a syslog server, nil when disabled
+	syslog *syslogWriter
+	// contextFields are the context keys added as fields by the *Ctx methods
+	contextFields []contextField
+	// ring keeps the most recent entries in memory, nil when disabled
+	ring *memoryRing
+	// levelFiles receive the entries at or above their level in addition to the other outputs
+	levelFiles []*levelFile
+	// dedupWindow collapses identical entries written within it, 0 disables deduplication
+	dedupWindow time.Duration
+	// dedup tracks the recently written messages, dedupSwept is when expired ones were last removed
+	dedup      map[dedupKey]*dedupEntry
+	dedupSwept time.Time
+	// stopDedup stops the goroutine writing the notices of passed windows, nil when it is not running
+	stopDedup chan struct{}
+	dedupDone chan struct{}
+	// rateWindow is when the current one second window started, rateCount the entries written in it
+	rateWindow time.Time
+	rateCount  int
+	// suppressed is the number of entries dropped by the rate limit since the last notice,
+	// suppressedLevel the highest level among them
+	suppressed      int
+	suppressedLevel LogLevel
+	// stopRateFlush stops the goroutine writing the suppressed notice of passed windows, nil when it is not running
+	stopRateFlush chan struct{}
+	rateFlushDone chan struct{}
+	// sequence is the number of the last entry, only used with WithSequence
+	sequenceEnabled bool
+	sequence        atomic.Uint64
+	// counts is the number of entries written per level, indexed by level - DEBUG
+	counts [ERROR - DEBUG + 1]atomic.Uint64
+	// fileOpenedAt is when the current log file was created, used for time-based rotation
+	fileOpenedAt time.Time
+	// stopRotation stops the time-based rotation goroutine, nil when it is not running
+	stopRotation chan struct{}
+	rotationDone chan struct{}
+	closeOnce    sync.Once
 }
 
 // LoggerConfig holds all logger configuration
@@ -53,6 +188,33 @@ type LoggerConfig struct {
 	enableStackTrace bool
 	stackTraceLevel  LogLevel
 	stackTraceDepth  int
+	minLevel         LogLevel
+	maxFileSize      int64
+	rotationInterval time.Duration
+	maxBackups       int
+	writers          []io.Writer
+	errorWriter      io.Writer
+	jsonFormat       bool
+	logfmtFormat     bool
+	timeFormat       string
+	utc              bool
+	// color overrides terminal detection when set
+	color       *bool
+	levelColors map[LogLevel]string
+	// asyncBufferSize enables asynchronous logging with a queue of this size
+	asyncBufferSize int
+	callerSkip      int
+	filePrefix      string
+	hooks           []Hook
+	rateLimit       int
+	dedupWindow     time.Duration
+	syslogNetwork   string
+	syslogAddr      string
+	cleanupMaxAge   time.Duration
+	sequence        bool
+	levelFiles      []levelFileConfig
+	contextFields   []contextField
+	memoryRingSize  int
 }
 
 // LoggerOption defines a function type for setting logger options
@@ -94,6 +256,209 @@ func WithStackTraceDepth(depth int) LoggerOption {
 	}
 }
 
+// WithMinLevel drops messages below the specified level
+func WithMinLevel(level LogLevel) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.minLevel = level
+	}
+}
+
+// WithMaxFileSize rotates the log file automatically once it would exceed the given size in bytes
+func WithMaxFileSize(bytes int64) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.maxFileSize = bytes
+	}
+}
+
+// WithRotationInterval rotates the log file automatically when the interval has passed since it was opened
+// It has no effect when file output is disabled
+func WithRotationInterval(d time.Duration) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.rotationInterval = d
+	}
+}
+
+// WithMaxBackups keeps at most n log files in the log directory, the oldest are deleted after each rotation
+func WithMaxBackups(n int) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.maxBackups = n
+	}
+}
+
+// WithWriter adds a sink that receives the plain text log output, it can be used several times
+func WithWriter(w io.Writer) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.writers = append(c.writers, w)
+	}
+}
+
+// WithErrorWriter sends console output of entries at or above ERROR to w instead of stdout, so that shell
+// redirection can separate errors from the rest; by default they go to stderr
+// Colors are used on both streams when enabled, it has no effect when console output is disabled
+func WithErrorWriter(w io.Writer) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.errorWriter = w
+	}
+}
+
+// WithJSONFormat writes file and writer output as one JSON object per line, console output stays colored text
+// JSON and logfmt are mutually exclusive: enabling one disables the other, so the last option given wins
+func WithJSONFormat(enabled bool) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.jsonFormat = enabled
+		if enabled {
+			c.logfmtFormat = false
+		}
+	}
+}
+
+// WithLogfmt writes file and writer output as logfmt key=value lines, console output stays colored text
+// JSON and logfmt are mutually exclusive: enabling one disables the other, so the last option given wins
+func WithLogfmt(enabled bool) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.logfmtFormat = enabled
+		if enabled {
+			c.jsonFormat = false
+		}
+	}
+}
+
+// WithTimeFormat sets the layout of the timestamp in text output, JSON and logfmt output always use RFC3339
+func WithTimeFormat(layout string) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.timeFormat = layout
+	}
+}
+
+// WithUTC renders timestamps in UTC instead of local time
+func WithUTC(enabled bool) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.utc = enabled
+	}
+}
+
+// WithColor forces ANSI colors on the console on or off, by default they are used only when stdout is a terminal
+func WithColor(enabled bool) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.color = &enabled
+	}
+}
+
+// WithAsync writes entries from a background goroutine through a queue of bufferSize entries,
+// so logging calls don't wait for disk I/O
+// When the queue is full, logging calls block until there is room: entries are never dropped
+// Close writes the queued entries before closing the log file, Flush waits for them without closing
+func WithAsync(bufferSize int) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.asyncBufferSize = bufferSize
+	}
+}
+
+// WithCallerSkip skips n more frames when reporting the caller location and stack trace,
+// so that helpers wrapping the logger report their caller instead of themselves
+func WithCallerSkip(n int) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.callerSkip = n
+	}
+}
+
+// Hook is called with the level and message of every entry the logger writes
+type Hook func(level LogLevel, message string)
+
+// WithHook adds a hook that is called synchronously after each entry is written, e.g. to send errors
+// to an alerting service, hooks run in the order they were added and a panicking hook is recovered
+// In async mode a logger with hooks waits for the background goroutine to write each entry before running them
+func WithHook(fn func(level LogLevel, message string)) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.hooks = append(c.hooks, fn)
+	}
+}
+
+// WithRateLimit drops entries once more than maxPerSecond were written in the current second,
+// the number of dropped entries is logged when the next window starts and when the logger is closed
+func WithRateLimit(maxPerSecond int) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.rateLimit = maxPerSecond
+	}
+}
+
+// WithDedup writes an entry only once when the same level and message are logged again within window,
+// the dropped copies are reported by a "repeated N times" entry once the window has passed
+// The notice is written when the message comes again, before a later entry, by a background check
+// at most one more window later, or when the logger is closed
+func WithDedup(window time.Duration) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.dedupWindow = window
+	}
+}
+
+// WithSyslog also sends entries to the syslog server at addr, network is "udp", "tcp" or "unix"
+// NewLogger fails when the server can't be reached, later write failures reconnect once
+func WithSyslog(network, addr string) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.syslogNetwork = network
+		c.syslogAddr = addr
+	}
+}
+
+// WithCleanupOnStart removes log files older than maxAge from the log directory when the logger is created,
+// the age is taken from the timestamp in the file name and files with other names are kept
+func WithCleanupOnStart(maxAge time.Duration) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.cleanupMaxAge = maxAge
+	}
+}
+
+// WithSequence starts every entry with a number that increases by one per written entry,
+// so that entries with the same timestamp can still be ordered
+func WithSequence(enabled bool) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.sequence = enabled
+	}
+}
+
+// WithLevelColor replaces the console color of level with ansiCode, an SGR escape sequence such as "\033[35m"
+// NewLogger rejects other strings since the code is written to the terminal verbatim
+func WithLevelColor(level LogLevel, ansiCode string) LoggerOption {
+	return func(c *LoggerConfig) {
+		if c.levelColors == nil {
+			c.levelColors = make(map[LogLevel]string)
+		}
+		c.levelColors[level] = ansiCode
+	}
+}
+
+// WithLevelFile also writes entries at or above level to path, e.g. errors to errors.log
+// A relative path is inside the log directory, the file is appended to across runs and
+// rotates on its own when WithMaxFileSize is set
+func WithLevelFile(level LogLevel, path string) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.levelFiles = append(c.levelFiles, levelFileConfig{level: level, path: path})
+	}
+}
+
+// WithMemoryRing keeps the last n entries in memory for RecentLogs, in the format of the file output,
+// whatever other outputs are enabled
+func WithMemoryRing(n int) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.memoryRingSize = n
+	}
+}
+
+// WithFilePrefix names log files <prefix>_<timestamp>.log, so that several services can share a log directory
+// Rotation and WithMaxBackups only consider files with the same prefix
+func WithFilePrefix(prefix string) LoggerOption {
+	return func(c *LoggerConfig) {
+		c.filePrefix = prefix
+	}
+}
+
+// isTerminal reports whether f is a terminal rather than a file or a pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 // createLogFile creates a new log file with the timestamp
 func (l *Logger) createLogFile() error {
 	// Create a logs directory if it doesn't exist
@@ -101,10 +466,20 @@ func (l *Logger) createLogFile() error {
 		return fmt.Errorf("failed to create log directory: %v", err)
 	}
 
-	// Generate filename with timestamp
+	// Generate filename with timestamp, add an index when rotating several times within a second
+	// The index keeps growing within the same second so names stay in creation order even after old files are removed
 	timestamp := time.Now().Format(logFileTimeFormat)
-	filename := fmt.Sprintf(logFileNameFormat, timestamp)
-	logPath := filepath.Join(l.logDir, filename)
+	index := 0
+	if l.logFile != nil {
+		if current, ok := parseLogFileName(filepath.Base(l.logFile.Name()), l.filePrefix); ok && current.timestamp.Format(logFileTimeFormat) == timestamp {
+			index = current.index + 1
+		}
+	}
+	logPath := filepath.Join(l.logDir, logFileName(l.filePrefix, timestamp, index))
+	for fileExists(logPath) {
+		index++
+		logPath = filepath.Join(l.logDir, logFileName(l.filePrefix, timestamp, index))
+	}
 
 	// Open the log file
 	file, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -113,6 +488,42 @@ func (l *Logger) createLogFile() error {
 	}
 
 	l.logFile = file
+	l.fileSize = 0
+	l.fileOpenedAt = time.Now()
+	return nil
+}
+
+// logFileName returns the log file name for a timestamp, index 0 means no index
+// A non-empty prefix is put in front of the timestamp: <prefix>_<timestamp>.log
+func logFileName(prefix, timestamp string, index int) string {
+	if index > 0 {
+		timestamp = fmt.Sprintf(logFileIndexFormat, timestamp, index)
+	}
+	if prefix != "" {
+		timestamp = prefix + "_" + timestamp
+	}
+	return fmt.Sprintf(logFileNameFormat, timestamp)
+}
+
+// fileExists reports whether a file exists at path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// validate rejects configurations that can't work, e.g. a logger without any output
+func (c *LoggerConfig) validate() error {
+	if !c.consoleOutput && !c.fileOutput && len(c.writers) == 0 && c.syslogAddr == "" && len(c.levelFiles) == 0 && c.memoryRingSize <= 0 {
+		return errors.New("invalid logger configuration: no output enabled")
+	}
+	if c.enableStackTrace && c.stackTraceDepth <= 0 {
+		return fmt.Errorf("invalid logger configuration: stack trace depth must be positive, got %d", c.stackTraceDepth)
+	}
+	for level, code := range c.levelColors {
+		if !ansiColorPattern.MatchString(code) {
+			return fmt.Errorf("invalid color %q for level %v: not an ANSI SGR escape sequence", code, level)
+		}
+	}
 	return nil
 }
 
@@ -126,6 +537,8 @@ func NewLogger(options ...LoggerOption) (*Logger, error) {
 		enableStackTrace: false,
 		stackTraceLevel:  ERROR,
 		stackTraceDepth:  10,
+		minLevel:         INFO,
+		timeFormat:       defaultTimeFormat,
 	}
 
 	// Apply all options
@@ -133,28 +546,213 @@ func NewLogger(options ...LoggerOption) (*Logger, error) {
 		option(config)
 	}
 
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
 	// Create logger instance
-	logger := &Logger{
+	logger := &Logger{loggerCore: &loggerCore{
 		consoleOutput:    config.consoleOutput,
 		fileOutput:       config.fileOutput,
 		logDir:           config.logDir,
 		enableStackTrace: config.enableStackTrace,
 		stackTraceLevel:  config.stackTraceLevel,
 		stackTraceDepth:  config.stackTraceDepth,
+		minLevel:         config.minLevel,
+		maxFileSize:      config.maxFileSize,
+		rotationInterval: config.rotationInterval,
+		maxBackups:       config.maxBackups,
+		writers:          config.writers,
+		errorWriter:      config.errorWriter,
+		jsonFormat:       config.jsonFormat,
+		logfmtFormat:     config.logfmtFormat,
+		timeFormat:       config.timeFormat,
+		utc:              config.utc,
+		callerSkip:       config.callerSkip,
+		filePrefix:       config.filePrefix,
+		hooks:            config.hooks,
+		rateLimit:        config.rateLimit,
+		dedupWindow:      config.dedupWindow,
+		sequenceEnabled:  config.sequence,
+		levelColors:      config.levelColors,
+		contextFields:    config.contextFields,
+	}}
+
+	// Color codes end up as garbage when the console is redirected to a file or a pipe
+	if config.color != nil {
+		logger.colorOutput = *config.color
+	} else {
+		logger.colorOutput = isTerminal(os.Stdout)
+	}
+
+	if config.cleanupMaxAge > 0 {
+		if err := logger.removeExpiredLogFiles(config.cleanupMaxAge); err != nil {
+			return nil, err
+		}
+	}
+
+	// Connect before creating the log file so that a failure doesn't leave an open file behind
+	if config.syslogAddr != "" {
+		w, err := newSyslogWriter(config.syslogNetwork, config.syslogAddr)
+		if err != nil {
+			return nil, err
+		}
+		logger.syslog = w
+	}
+
+	for _, fc := range config.levelFiles {
+		path := fc.path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(config.logDir, path)
+		}
+		f, err := openLevelFile(fc.level, path)
+		if err != nil {
+			logger.closeOutputs()
+			return nil, err
+		}
+		logger.levelFiles = append(logger.levelFiles, f)
 	}
 
 	// Create a log file if file output is enabled
 	if config.fileOutput {
 		if err := logger.createLogFile(); err != nil {
+			logger.closeOutputs()
 			return nil, err
 		}
+
+		if config.rotationInterval > 0 {
+			logger.startRotation()
+		}
+	}
+
+	if config.memoryRingSize > 0 {
+		logger.ring = newMemoryRing(config.memoryRingSize)
+	}
+
+	if config.asyncBufferSize > 0 {
+		logger.async = newAsyncWriter(logger, config.asyncBufferSize)
+	}
+
+	if config.dedupWindow > 0 {
+		logger.dedup = make(map[dedupKey]*dedupEntry)
+		logger.startDedupFlush()
+	}
+
+	if config.rateLimit > 0 {
+		logger.startRateFlush()
 	}
 
 	return logger, nil
 }
 
+// startRotation starts a goroutine that rotates the log file every rotationInterval, Close stops it
+func (l *Logger) startRotation() {
+	l.stopRotation = make(chan struct{})
+	l.rotationDone = make(chan struct{})
+
+	go func() {
+		defer close(l.rotationDone)
+
+		timer := time.NewTimer(l.rotationInterval)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-l.stopRotation:
+				return
+			case <-timer.C:
+			}
+
+			// The file may have been rotated in the meantime (manually or by size), so wait for the remaining time
+			l.mu.Lock()
+			remaining := l.rotationInterval - time.Since(l.fileOpenedAt)
+			if remaining <= 0 {
+				if err := l.rotate(); err != nil {
+					fmt.Fprintf(os.Stderr, "logger: automatic rotation failed: %v\n", err)
+				}
+				remaining = l.rotationInterval
+			}
+			l.mu.Unlock()
+
+			timer.Reset(remaining)
+		}
+	}()
+}
+
+// WithFields returns a derived logger that adds the given fields to every entry
+// The derived logger shares outputs with l, its fields are copied so neither logger affects the other
+func (l *Logger) WithFields(fields map[string]interface{}) *Logger {
+	merged := make(map[string]interface{}, len(l.fields)+len(fields))
+	for _, field := range l.fields {
+		merged[field.key] = field.value
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+
+	derived := &Logger{loggerCore: l.loggerCore, prefix: l.prefix, derived: true}
+	for key, value := range merged {
+		derived.fields = append(derived.fields, logField{key, value})
+	}
+	sort.Slice(derived.fields, func(i, j int) bool {
+		return derived.fields[i].key < derived.fields[j].key
+	})
+	return derived
+}
+
+// With returns a derived logger that prepends prefix to every message, e.g. a request ID
+// The derived logger writes to the same outputs as l and keeps its fields, closing it leaves l open
+func (l *Logger) With(prefix string) *Logger {
+	return &Logger{
+		loggerCore: l.loggerCore,
+		fields:     l.fields,
+		prefix:     l.prefix + prefix + " ",
+		derived:    true,
+	}
+}
+
+// formatFields formats the fields as " key=value" pairs for text output
+func (l *Logger) formatFields() string {
+	var builder strings.Builder
+	for _, field := range l.fields {
+		value := fmt.Sprint(field.value)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = strconv.Quote(value)
+		}
+		fmt.Fprintf(&builder, " %s=%s", field.key, value)
+	}
+	return builder.String()
+}
+
+// SetMinLevel changes the minimum level at runtime, it is safe to call while other goroutines are logging
+func (l *Logger) SetMinLevel(level LogLevel) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.minLevel = level
+}
+
+// GetMinLevel returns the current minimum level
+func (l *Logger) GetMinLevel() LogLevel {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.minLevel
+}
+
+// Stats returns a snapshot of how many entries were written at each level, entries below
+// the minimum level aren't counted, derived loggers share the counters of their parent
+func (l *Logger) Stats() map[LogLevel]uint64 {
+	stats := make(map[LogLevel]uint64, len(l.counts))
+	for i := range l.counts {
+		stats[DEBUG+LogLevel(i)] = l.counts[i].Load()
+	}
+	return stats
+}
+
 // GetCurrentLogFile returns the path of the current log file
 func (l *Logger) GetCurrentLogFile() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	if l.logFile == nil {
 		return ""
 	}
@@ -163,6 +761,14 @@ func (l *Logger) GetCurrentLogFile() string {
 
 // RotateLogFile closes the current log file and creates a new one
 func (l *Logger) RotateLogFile() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rotate()
+}
+
+// rotate closes the current log file and creates a new one, l.mu must be held
+func (l *Logger) rotate() error {
 	// Check if the file output is enabled
 	if !l.fileOutput {
 		return fmt.Errorf("file output is not enabled")
@@ -176,16 +782,132 @@ func (l *Logger) RotateLogFile() error {
 	}
 
 	// Create a new log file
-	return l.createLogFile()
+	if err := l.createLogFile(); err != nil {
+		return err
+	}
+
+	if l.maxBackups > 0 {
+		return l.removeOldLogFiles()
+	}
+	return nil
+}
+
+// logFileInfo is a log file name parsed into its timestamp and index
+type logFileInfo struct {
+	name      string
+	timestamp time.Time
+	index     int
+}
+
+// parseLogFileName parses a name created by createLogFile with the given prefix,
+// the second return value is false for other files, including those of other prefixes
+func parseLogFileName(name, prefix string) (logFileInfo, bool) {
+	base, ok := strings.CutSuffix(name, filepath.Ext(logFileNameFormat))
+	if !ok {
+		return logFileInfo{}, false
+	}
+	if prefix != "" {
+		if base, ok = strings.CutPrefix(base, prefix+"_"); !ok {
+			return logFileInfo{}, false
+		}
+	}
+
+	info := logFileInfo{name: name}
+	if len(base) > len(logFileTimeFormat) {
+		suffix, ok := strings.CutPrefix(base[len(logFileTimeFormat):], "_")
+		index, err := strconv.Atoi(suffix)
+		if !ok || err != nil || index < 1 {
+			return logFileInfo{}, false
+		}
+		info.index = index
+		base = base[:len(logFileTimeFormat)]
+	}
+
+	timestamp, err := time.ParseInLocation(logFileTimeFormat, base, time.Local)
+	if err != nil {
+		return logFileInfo{}, false
+	}
+	info.timestamp = timestamp
+	return info, true
+}
+
+// listLogFiles returns the log files of this logger in logDir, other files are left out
+func (l *Logger) listLogFiles() ([]logFileInfo, error) {
+	entries, err := os.ReadDir(l.logDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log directory: %v", err)
+	}
+
+	var files []logFileInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if info, ok := parseLogFileName(entry.Name(), l.filePrefix); ok {
+			files = append(files, info)
+		}
+	}
+	return files, nil
+}
+
+// removeExpiredLogFiles removes log files whose name has a timestamp older than maxAge,
+// a missing log directory is not an error
+func (l *Logger) removeExpiredLogFiles(maxAge time.Duration) error {
+	if _, err := os.Stat(l.logDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	files, err := l.listLogFiles()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	for _, file := range files {
+		if file.timestamp.Before(cutoff) {
+			if err := os.Remove(filepath.Join(l.logDir, file.name)); err != nil {
+				return fmt.Errorf("failed to remove expired log file: %v", err)
+			}
+		}
+	}
+	return nil
 }
 
-// getStackTrace returns the stack trace as a string
-func (l *Logger) getStackTrace() string {
+// removeOldLogFiles deletes the oldest log files until only maxBackups remain
+// Files are ordered by the timestamp in their name rather than mtime so the result is deterministic
+func (l *Logger) removeOldLogFiles() error {
+	files, err := l.listLogFiles()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].timestamp.Equal(files[j].timestamp) {
+			return files[i].timestamp.Before(files[j].timestamp)
+		}
+		return files[i].index < files[j].index
+	})
+
+	for len(files) > l.maxBackups {
+		if err := os.Remove(filepath.Join(l.logDir, files[0].name)); err != nil {
+			return fmt.Errorf("failed to remove old log file: %v", err)
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// callerSkip is the number of frames between log and the user's call site:
+// log itself and the exported logging method (Info, Infof, ...)
+const callerSkip = 2
+
+// getStackTrace returns the stack trace as a string, starting skip frames above log
+func (l *Logger) getStackTrace(skip int) string {
 	var builder strings.Builder
 	builder.WriteString("\nStack Trace:\n")
 
-	// Skip 3 frames: getStackTrace, log, and the logging function (Info/Warning/Error)
-	skip := 3
+	// Skip one more frame for getStackTrace itself
+	skip++
 	for i := 0; i < l.stackTraceDepth; i++ {
 		pc, file, line, ok := runtime.Caller(skip + i)
 		if !ok {
@@ -200,67 +922,403 @@ func (l *Logger) getStackTrace() string {
 	return builder.String()
 }
 
-// log performs the actual logging operation
-func (l *Logger) log(level LogLevel, message interface{}, args ...interface{}) {
-	var finalMessage string
+// formatMessage builds the log message from a format string or an arbitrary value
+func formatMessage(message interface{}, args ...interface{}) string {
 	switch msg := message.(type) {
 	case string:
 		if len(args) > 0 {
-			finalMessage = fmt.Sprintf(msg, args...)
-		} else {
-			finalMessage = msg
+			return fmt.Sprintf(msg, args...)
 		}
+		return msg
 	default:
-		finalMessage = fmt.Sprint(message)
+		return fmt.Sprint(message)
+	}
+}
+
+// log performs the actual logging operation
+// skip is the number of frames above log where the user's call site is, usually callerSkip
+func (l *Logger) log(skip int, level LogLevel, finalMessage string) error {
+	return l.output(skip+1, "", level, finalMessage)
+}
+
+// output writes an entry to all sinks, location is computed from skip when empty
+// It returns the first write error, always nil in async mode since the write happens later
+func (l *Logger) output(skip int, location string, level LogLevel, finalMessage string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if level < l.minLevel {
+		return nil
+	}
+
+	now := time.Now()
+	if l.dedupWindow > 0 && !l.unlimited {
+		drop, due := l.checkDedup(now, level, l.prefix+finalMessage)
+		if len(due) > 0 {
+			l.mu.Unlock()
+			l.writeRepeats(due)
+			l.mu.Lock()
+		}
+		if drop {
+			return nil
+		}
+	}
+
+	if l.rateLimit > 0 && !l.unlimited {
+		if now.Sub(l.rateWindow) >= time.Second {
+			l.rateWindow, l.rateCount = now, 0
+			if l.suppressed > 0 {
+				l.mu.Unlock()
+				l.writeSuppressed()
+				l.mu.Lock()
+			}
+		}
+		if l.rateCount >= l.rateLimit {
+			if l.suppressed == 0 || level > l.suppressedLevel {
+				l.suppressedLevel = level
+			}
+			l.suppressed++
+			return nil
+		}
+		l.rateCount++
 	}
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	location := getLocation()
-	levelStr := getLevelStr(level)
+	if level >= DEBUG && level <= ERROR {
+		l.counts[level-DEBUG].Add(1)
+	}
+	finalMessage = l.prefix + finalMessage
+	skip += l.callerSkip
+
+	if l.utc {
+		now = now.UTC()
+	}
+	timestamp := now.Format(l.timeFormat)
+	if location == "" {
+		location = getLocation(skip)
+	}
+	levelStr := level.String()
 
 	var stackTrace string
 	if l.enableStackTrace && level >= l.stackTraceLevel {
-		stackTrace = l.getStackTrace()
+		stackTrace = l.getStackTrace(skip)
 	}
 
-	coloredLogMessage := fmt.Sprintf("%s[%s]%s %s - %s: %s%s\n",
-		getLevelColor(level),
+	textMessage := finalMessage + l.formatFields()
+
+	// The number is taken under the lock so that it follows the order of the entries
+	var seq uint64
+	var seqPrefix string
+	if l.sequenceEnabled {
+		seq = l.sequence.Add(1)
+		seqPrefix = fmt.Sprintf("#%d ", seq)
+	}
+
+	coloredLogMessage := fmt.Sprintf("%s%s[%s]%s %s - %s: %s%s\n",
+		seqPrefix,
+		l.levelColor(level),
 		levelStr,
 		colorReset,
 		timestamp,
 		location,
-		finalMessage,
+		textMessage,
 		stackTrace,
 	)
 
-	plainLogMessage := fmt.Sprintf("[%s] %s - %s: %s%s\n",
+	plainLogMessage := fmt.Sprintf("%s[%s] %s - %s: %s%s\n",
+		seqPrefix,
 		levelStr,
 		timestamp,
 		location,
-		finalMessage,
+		textMessage,
 		stackTrace,
 	)
 
+	// File and writer output can be JSON or logfmt, console output stays text
+	outputMessage := plainLogMessage
+	switch {
+	case l.jsonFormat:
+		outputMessage = formatJSON(levelStr, seq, now, location, finalMessage, stackTrace, l.fields)
+	case l.logfmtFormat:
+		outputMessage = formatLogfmt(levelStr, seq, now, location, finalMessage, stackTrace, l.fields)
+	}
+
+	console := plainLogMessage
+	if l.colorOutput {
+		console = coloredLogMessage
+	}
+	e := logEntry{level: level, time: now, console: console, output: outputMessage}
+
+	// In async mode the entry is written by the background goroutine, the lock is released
+	// before queueing so that the goroutine can take it while the queue is full
+	// With hooks the call waits for the write so that hooks only see entries that are already written
+	var err error
+	if l.async != nil {
+		l.mu.Unlock()
+		l.async.enqueue(e, len(l.hooks) > 0)
+		l.mu.Lock()
+	} else {
+		err = l.writeEntry(e)
+	}
+
+	// Hooks run without the lock so that they may log themselves
+	if len(l.hooks) > 0 {
+		l.mu.Unlock()
+		l.runHooks(level, finalMessage)
+		l.mu.Lock()
+	}
+	return err
+}
+
+// writeSuppressed logs how many entries the rate limit dropped, at the highest level among them so that
+// the notice passes the minimum level, it must be called without the lock
+func (l *Logger) writeSuppressed() {
+	l.mu.Lock()
+	n, level := l.suppressed, l.suppressedLevel
+	l.suppressed = 0
+	l.mu.Unlock()
+	if n == 0 {
+		return
+	}
+
+	// The notice belongs to the logger itself, not to the prefix and fields of the caller
+	root := &Logger{loggerCore: l.loggerCore, derived: true, unlimited: true}
+	root.output(0, "rate limit", level, fmt.Sprintf("%d messages suppressed", n))
+}
+
+// startRateFlush starts a goroutine that writes the suppressed notice once per second after the window
+// it belongs to has passed, so that it doesn't wait for the next entry, Close stops it
+func (l *Logger) startRateFlush() {
+	l.stopRateFlush = make(chan struct{})
+	l.rateFlushDone = make(chan struct{})
+
+	go func() {
+		defer close(l.rateFlushDone)
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.stopRateFlush:
+				return
+			case now := <-ticker.C:
+				l.mu.Lock()
+				due := l.suppressed > 0 && now.Sub(l.rateWindow) >= time.Second
+				l.mu.Unlock()
+				if due {
+					l.writeSuppressed()
+				}
+			}
+		}
+	}()
+}
+
+// runHooks calls every hook in order, a panic in one hook is reported on stderr
+// and doesn't stop the others or reach the caller
+func (l *Logger) runHooks(level LogLevel, message string) {
+	for i, hook := range l.hooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					fmt.Fprintf(os.Stderr, "logger: hook %d panicked: %v\n", i, r)
+				}
+			}()
+			hook(level, message)
+		}()
+	}
+}
+
+// logEntry is a formatted entry ready to be written to the sinks
+type logEntry struct {
+	level LogLevel
+	time  time.Time
+	// console is the text written to stdout, colored if enabled
+	console string
+	// output is the text written to the file and writers, JSON or logfmt if enabled
+	output string
+}
+
+// writeEntry writes an entry to all sinks and returns the first write error, l.mu must be held
+// A failing sink doesn't prevent writing to the others
+func (l *Logger) writeEntry(e logEntry) error {
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if l.ring != nil {
+		l.ring.add(e.output)
+	}
+
 	if l.consoleOutput {
-		fmt.Print(coloredLogMessage)
+		_, err := io.WriteString(l.consoleWriter(e.level), e.console)
+		keep(err)
 	}
 
 	if l.fileOutput && l.logFile != nil {
-		log.New(l.logFile, "", 0).Print(plainLogMessage)
+		// Rotate before the write that would exceed the limit, a single oversized entry still gets its own file
+		if l.maxFileSize > 0 && l.fileSize > 0 && l.fileSize+int64(len(e.output)) > l.maxFileSize {
+			if err := l.rotate(); err != nil {
+				fmt.Fprintf(os.Stderr, "logger: automatic rotation failed: %v\n", err)
+			}
+		}
+
+		n, err := io.WriteString(l.logFile, e.output)
+		l.fileSize += int64(n)
+		if err != nil {
+			keep(fmt.Errorf("failed to write log file: %v", err))
+		}
+	}
+
+	for _, w := range l.writers {
+		_, err := io.WriteString(w, e.output)
+		keep(err)
+	}
+
+	for _, f := range l.levelFiles {
+		if e.level >= f.level {
+			keep(f.write(e.output, l.maxFileSize))
+		}
+	}
+
+	if l.syslog != nil {
+		keep(l.syslog.write(e.level, e.time, e.output))
+	}
+	return firstErr
+}
+
+// consoleWriter returns the console stream of an entry: the error writer for ERROR entries, stdout for the others
+// The standard streams are looked up on every write so that a redirected os.Stdout or os.Stderr is honored
+func (l *Logger) consoleWriter(level LogLevel) io.Writer {
+	if level < ERROR {
+		return os.Stdout
+	}
+	if l.errorWriter != nil {
+		return l.errorWriter
+	}
+	return os.Stderr
+}
+
+// jsonLogEntry is one line of JSON log output
+type jsonLogEntry struct {
+	Seq        uint64 `json:"seq,omitempty"`
+	Level      string `json:"level"`
+	Timestamp  string `json:"timestamp"`
+	Location   string `json:"location"`
+	Message    string `json:"message"`
+	StackTrace string `json:"stack_trace,omitempty"`
+}
+
+// jsonReservedKeys are the keys of jsonLogEntry, fields can't override them, "seq" only when sequence numbers are enabled
+var jsonReservedKeys = map[string]bool{
+	"level":       true,
+	"timestamp":   true,
+	"location":    true,
+	"message":     true,
+	"stack_trace": true,
+}
+
+// formatJSON formats a log entry as a JSON line, the stack trace keeps only the frames
+// Fields are merged into the object after the standard keys, which take precedence on conflicts
+// seq is the sequence number of the entry, 0 leaves it out
+func formatJSON(levelStr string, seq uint64, timestamp time.Time, location, message, stackTrace string, fields []logField) string {
+	stackTrace = strings.TrimSuffix(strings.TrimPrefix(stackTrace, "\nStack Trace:\n"), "\n")
+
+	// Marshaling a struct of strings can't fail
+	data, _ := json.Marshal(jsonLogEntry{
+		Seq:        seq,
+		Level:      levelStr,
+		Timestamp:  timestamp.Format(time.RFC3339),
+		Location:   location,
+		Message:    message,
+		StackTrace: stackTrace,
+	})
+	if len(fields) == 0 {
+		return string(data) + "\n"
+	}
+
+	var builder strings.Builder
+	builder.Write(data[:len(data)-1])
+	for _, field := range fields {
+		if jsonReservedKeys[field.key] || (seq > 0 && field.key == "seq") {
+			continue
+		}
+		key, _ := json.Marshal(field.key)
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprint(field.value))
+		}
+		builder.WriteByte(',')
+		builder.Write(key)
+		builder.WriteByte(':')
+		builder.Write(value)
 	}
+	builder.WriteString("}\n")
+	return builder.String()
 }
 
-// Close closes the log file if it's being used
+// Close closes the log file if it's being used, it does nothing for derived loggers
 func (l *Logger) Close() error {
+	// Only the root logger owns the log file
+	if l.derived {
+		return nil
+	}
+
+	// Stop the background goroutines before taking the lock they may be waiting for,
+	// queued entries are written before the file is closed
+	l.closeOnce.Do(func() {
+		if l.stopDedup != nil {
+			close(l.stopDedup)
+			<-l.dedupDone
+		}
+		if l.dedupWindow > 0 {
+			l.mu.Lock()
+			due := l.expireDedup(time.Now(), true)
+			l.mu.Unlock()
+			l.writeRepeats(due)
+		}
+		if l.stopRateFlush != nil {
+			close(l.stopRateFlush)
+			<-l.rateFlushDone
+		}
+		if l.rateLimit > 0 {
+			l.writeSuppressed()
+		}
+		if l.async != nil {
+			l.async.close()
+		}
+		if l.stopRotation != nil {
+			close(l.stopRotation)
+			<-l.rotationDone
+		}
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closeOutputs()
 	if l.logFile != nil {
 		return l.logFile.Close()
 	}
 	return nil
 }
 
-// getLocation retrieves the caller's file location and line number
-func getLocation() string {
-	_, file, line, ok := runtime.Caller(3)
+// closeOutputs closes the syslog connection and the level files
+func (l *Logger) closeOutputs() {
+	if l.syslog != nil {
+		l.syslog.close()
+	}
+	for _, f := range l.levelFiles {
+		f.close()
+	}
+}
+
+// getLocation retrieves the caller's file location and line number, skip frames above log
+func getLocation(skip int) string {
+	// Skip one more frame for getLocation itself
+	_, file, line, ok := runtime.Caller(skip + 1)
 	if !ok {
 		return "unknown location"
 	}
@@ -270,6 +1328,8 @@ func getLocation() string {
 // getLevelColor returns the color code for the log level
 func getLevelColor(level LogLevel) string {
 	switch level {
+	case DEBUG:
+		return colorCyan
 	case WARNING:
 		return colorYellow
 	case ERROR:
@@ -279,32 +1339,137 @@ func getLevelColor(level LogLevel) string {
 	}
 }
 
-// getLevelStr returns the string representation of the log level
-func getLevelStr(level LogLevel) string {
-	switch level {
-	case WARNING:
-		return "WARNING"
-	case ERROR:
-		return "ERROR"
-	default:
-		return "INFO"
+// levelColor returns the color code for the log level, taking WithLevelColor into account
+func (l *Logger) levelColor(level LogLevel) string {
+	if code, ok := l.levelColors[level]; ok {
+		return code
+	}
+	return getLevelColor(level)
+}
+
+// levelWriter is an io.Writer that logs every line written to it
+type levelWriter struct {
+	logger *Logger
+	level  LogLevel
+}
+
+// Writer returns an io.Writer that logs each written line at the given level,
+// e.g. for log.SetOutput or http.Server.ErrorLog
+// The location of the entries is the code calling Write, such as the standard log package
+func (l *Logger) Writer(level LogLevel) io.Writer {
+	return &levelWriter{logger: l, level: level}
+}
+
+// Write logs each line of p as a separate entry, empty lines are skipped
+func (w *levelWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+		if err := w.logger.log(callerSkip, w.level, line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Log logs a message at the given level and returns an error if writing to a sink failed
+// It can be used with or without format arguments, in async mode the error is always nil
+func (l *Logger) Log(level LogLevel, message interface{}, args ...interface{}) error {
+	return l.log(callerSkip, level, formatMessage(message, args...))
+}
+
+// ErrorErr logs err with ERROR level, a nil error is logged as "<nil error>"
+// When stack traces are enabled for ERROR, the messages of the wrapped errors are listed too
+func (l *Logger) ErrorErr(err error) {
+	if err == nil {
+		l.log(callerSkip, ERROR, "<nil error>")
+		return
+	}
+
+	message := err.Error()
+	if l.enableStackTrace && ERROR >= l.stackTraceLevel {
+		message += formatErrorChain(err)
 	}
+	l.log(callerSkip, ERROR, message)
+}
+
+// WithError returns a derived logger that adds err as the "error" field to every entry
+func (l *Logger) WithError(err error) *Logger {
+	value := "<nil error>"
+	if err != nil {
+		value = err.Error()
+	}
+	return l.WithFields(map[string]interface{}{"error": value})
+}
+
+// formatErrorChain lists the message of err and of every error it wraps, including joined errors
+func formatErrorChain(err error) string {
+	var builder strings.Builder
+	builder.WriteString("\nError Chain:")
+
+	var walk func(err error, depth int)
+	walk = func(err error, depth int) {
+		fmt.Fprintf(&builder, "\n%s%s", strings.Repeat("\t", depth+1), err.Error())
+		switch wrapped := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, inner := range wrapped.Unwrap() {
+				if inner != nil {
+					walk(inner, depth+1)
+				}
+			}
+		default:
+			if inner := errors.Unwrap(err); inner != nil {
+				walk(inner, depth+1)
+			}
+		}
+	}
+	walk(err, 0)
+
+	return builder.String()
+}
+
+// Debug logs a message with DEBUG level
+// It can be used with or without format arguments
+func (l *Logger) Debug(message interface{}, args ...interface{}) {
+	l.log(callerSkip, DEBUG, formatMessage(message, args...))
 }
 
 // Info logs a message with INFO level
 // It can be used with or without format arguments
 func (l *Logger) Info(message interface{}, args ...interface{}) {
-	l.log(INFO, message, args...)
+	l.log(callerSkip, INFO, formatMessage(message, args...))
 }
 
 // Warning logs a message with WARNING level
 // It can be used with or without format arguments
 func (l *Logger) Warning(message interface{}, args ...interface{}) {
-	l.log(WARNING, message, args...)
+	l.log(callerSkip, WARNING, formatMessage(message, args...))
 }
 
 // Error logs a message with ERROR level
 // It can be used with or without format arguments
 func (l *Logger) Error(message interface{}, args ...interface{}) {
-	l.log(ERROR, message, args...)
+	l.log(callerSkip, ERROR, formatMessage(message, args...))
+}
+
+// Debugf logs a formatted message with DEBUG level
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.log(callerSkip, DEBUG, fmt.Sprintf(format, args...))
+}
+
+// Infof logs a formatted message with INFO level
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.log(callerSkip, INFO, fmt.Sprintf(format, args...))
+}
+
+// Warningf logs a formatted message with WARNING level
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	l.log(callerSkip, WARNING, fmt.Sprintf(format, args...))
+}
+
+// Errorf logs a formatted message with ERROR level
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.log(callerSkip, ERROR, fmt.Sprintf(format, args...))
 }
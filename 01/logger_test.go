@@ -2,8 +2,21 @@ package logger
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -49,6 +62,45 @@ func TestNewLogger(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Writer output only",
+			options: []LoggerOption{
+				WithConsoleOutput(false),
+				WithWriter(io.Discard),
+			},
+			wantErr: false,
+		},
+		{
+			name: "No output",
+			options: []LoggerOption{
+				WithConsoleOutput(false),
+				WithFileOutput(false),
+			},
+			wantErr: true,
+		},
+		{
+			name: "Zero stack trace depth",
+			options: []LoggerOption{
+				WithStackTrace(ERROR),
+				WithStackTraceDepth(0),
+			},
+			wantErr: true,
+		},
+		{
+			name: "Negative stack trace depth",
+			options: []LoggerOption{
+				WithStackTrace(ERROR),
+				WithStackTraceDepth(-1),
+			},
+			wantErr: true,
+		},
+		{
+			name: "Zero stack trace depth without stack traces",
+			options: []LoggerOption{
+				WithStackTraceDepth(0),
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -177,6 +229,506 @@ func TestConsoleOutput(t *testing.T) {
 	}
 }
 
+// TestWithWriter tests logging to additional writers
+func TestWithWriter(t *testing.T) {
+	var first, second bytes.Buffer
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithWriter(&first),
+		WithWriter(&second),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	logger.Warning("Test writer output %d", 1)
+
+	for name, buf := range map[string]*bytes.Buffer{"first": &first, "second": &second} {
+		line := buf.String()
+		if !strings.HasPrefix(line, "[WARNING] ") || !strings.HasSuffix(line, "Test writer output 1\n") {
+			t.Errorf("%s writer got %q, want a plain WARNING line", name, line)
+		}
+		if strings.Contains(line, colorReset) {
+			t.Errorf("%s writer got colored output: %q", name, line)
+		}
+	}
+}
+
+// TestJSONFormat tests JSON output to the log file and writers
+func TestJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(t.TempDir()),
+		WithWriter(&buf),
+		WithJSONFormat(true),
+		WithStackTrace(ERROR),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	_, _, line, _ := runtime.Caller(0)
+	logger.Info("Test JSON %s", "message")
+	logger.Error("Test JSON error")
+
+	content, err := os.ReadFile(logger.GetCurrentLogFile())
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if string(content) != buf.String() {
+		t.Errorf("File and writer output differ:\n%s\n%s", content, buf.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Log lines = %d, want 2:\n%s", len(lines), content)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("Cannot decode log line %q: %v", lines[0], err)
+	}
+	if entry["level"] != "INFO" {
+		t.Errorf("level = %v, want INFO", entry["level"])
+	}
+	if entry["message"] != "Test JSON message" {
+		t.Errorf("message = %v, want Test JSON message", entry["message"])
+	}
+	if want := fmt.Sprintf("logger_test.go:%d", line+1); entry["location"] != want {
+		t.Errorf("location = %v, want %s", entry["location"], want)
+	}
+	if timestamp, _ := entry["timestamp"].(string); timestamp == "" {
+		t.Error("timestamp is missing")
+	} else if _, err := time.Parse(time.RFC3339, timestamp); err != nil {
+		t.Errorf("timestamp %q is not RFC3339: %v", timestamp, err)
+	}
+	if _, ok := entry["stack_trace"]; ok {
+		t.Error("stack_trace should be omitted when empty")
+	}
+
+	var errorEntry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &errorEntry); err != nil {
+		t.Fatalf("Cannot decode log line %q: %v", lines[1], err)
+	}
+	if trace, _ := errorEntry["stack_trace"].(string); !strings.Contains(trace, "logger_test.go") {
+		t.Errorf("stack_trace = %q, want frames from the test", trace)
+	}
+}
+
+// TestWithFields tests that derived loggers add their own fields without affecting others
+func TestWithFields(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	first := logger.WithFields(map[string]interface{}{"user_id": 42, "request_id": "abc"})
+	second := logger.WithFields(map[string]interface{}{"user_id": 7})
+	nested := first.WithFields(map[string]interface{}{"user_id": 43, "step": "upload file"})
+
+	first.Info("first")
+	second.Info("second")
+	nested.Info("nested")
+	logger.Info("root")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{
+		"first request_id=abc user_id=42",
+		"second user_id=7",
+		`nested request_id=abc step="upload file" user_id=43`,
+		"root",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("Log lines = %d, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, ": "+want[i]) {
+			t.Errorf("Line %d = %q, want suffix %q", i, line, want[i])
+		}
+	}
+
+	// Closing a derived logger doesn't close the shared outputs
+	if err := first.Close(); err != nil {
+		t.Errorf("Close() on derived logger error = %v", err)
+	}
+}
+
+// TestWithFieldsJSON tests that fields are merged into JSON entries
+func TestWithFieldsJSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf), WithJSONFormat(true))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	logger.WithFields(map[string]interface{}{"user_id": 42, "message": "ignored"}).Warning("with fields")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Cannot decode log line %q: %v", buf.String(), err)
+	}
+	if entry["user_id"] != float64(42) {
+		t.Errorf("user_id = %v, want 42", entry["user_id"])
+	}
+	if entry["message"] != "with fields" {
+		t.Errorf("message = %v, want the log message", entry["message"])
+	}
+}
+
+// TestWithPrefix tests child loggers created with With
+func TestWithPrefix(t *testing.T) {
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(t.TempDir()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	child := logger.With("[req-1]")
+	child.Info("child message")
+	child.With("[upload]").WithFields(map[string]interface{}{"size": 10}).Warning("nested message")
+
+	// Closing the child must not close the file owned by the parent
+	if err := child.Close(); err != nil {
+		t.Fatalf("Close() on child error = %v", err)
+	}
+	logger.Info("parent message")
+
+	content, err := os.ReadFile(logger.GetCurrentLogFile())
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	want := []string{
+		": [req-1] child message",
+		": [req-1] [upload] nested message size=10",
+		": parent message",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("Log lines = %d, want %d:\n%s", len(lines), len(want), content)
+	}
+	for i, line := range lines {
+		if !strings.HasSuffix(line, want[i]) {
+			t.Errorf("Line %d = %q, want suffix %q", i, line, want[i])
+		}
+	}
+	if child.GetCurrentLogFile() != logger.GetCurrentLogFile() {
+		t.Error("Child logger doesn't share the parent's log file")
+	}
+}
+
+// TestTimeFormat tests custom timestamp layouts and UTC rendering
+func TestTimeFormat(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithWriter(&buf),
+		WithTimeFormat("2006-01-02T15:04:05.000000Z07:00"),
+		WithUTC(true),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	logger.Info("Test time format")
+
+	pattern := regexp.MustCompile(`^\[INFO\] \d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6}Z - logger_test\.go:\d+: Test time format\n$`)
+	if !pattern.MatchString(buf.String()) {
+		t.Errorf("Log line %q doesn't match %s", buf.String(), pattern)
+	}
+}
+
+// TestDefaultTimeFormat tests that the default timestamp layout is unchanged
+func TestDefaultTimeFormat(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	logger.Info("Test default time format")
+
+	pattern := regexp.MustCompile(`^\[INFO\] \d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} - `)
+	if !pattern.MatchString(buf.String()) {
+		t.Errorf("Log line %q doesn't match %s", buf.String(), pattern)
+	}
+}
+
+// captureStdout runs fn with stdout redirected to a pipe and returns what was written
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	oldStdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	os.Stdout = w
+	defer func() { os.Stdout = oldStdout }()
+
+	fn()
+	w.Close()
+
+	output, _ := io.ReadAll(r)
+	return string(output)
+}
+
+// TestColorOutput tests that colors are disabled for non-terminal stdout unless forced
+func TestColorOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   []LoggerOption
+		wantColor bool
+	}{
+		{"Pipe without override", nil, false},
+		{"Forced on", []LoggerOption{WithColor(true)}, true},
+		{"Forced off", []LoggerOption{WithColor(false)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := captureStdout(t, func() {
+				// Errors go to stderr by default, send them to the captured stdout
+				logger, err := NewLogger(append([]LoggerOption{WithErrorWriter(os.Stdout)}, tt.options...)...)
+				if err != nil {
+					t.Fatalf("Failed to create logger: %v", err)
+				}
+				logger.Error("Test color output")
+			})
+
+			if !strings.Contains(output, "Test color output") {
+				t.Fatalf("Console output doesn't contain the message: %q", output)
+			}
+			if hasColor := strings.Contains(output, "\033["); hasColor != tt.wantColor {
+				t.Errorf("Escape sequences present = %v, want %v: %q", hasColor, tt.wantColor, output)
+			}
+		})
+	}
+}
+
+// TestParseLevel tests parsing level names from configuration
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    LogLevel
+		wantErr bool
+	}{
+		{"debug", DEBUG, false},
+		{"info", INFO, false},
+		{"warning", WARNING, false},
+		{"error", ERROR, false},
+		{"warn", WARNING, false},
+		{"WARN", WARNING, false},
+		{"Info", INFO, false},
+		{" ERROR ", ERROR, false},
+		{"verbose", INFO, true},
+		{"", INFO, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.input)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%q", tt.input)) {
+				t.Errorf("ParseLevel(%q) error = %v, want an error naming the input", tt.input, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+// TestLevelString tests that level names round-trip through ParseLevel
+func TestLevelString(t *testing.T) {
+	for _, level := range []LogLevel{DEBUG, INFO, WARNING, ERROR} {
+		parsed, err := ParseLevel(level.String())
+		if err != nil || parsed != level {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", level.String(), parsed, err, level)
+		}
+	}
+	if got := LogLevel(7).String(); got != "LogLevel(7)" {
+		t.Errorf("LogLevel(7).String() = %q, want LogLevel(7)", got)
+	}
+}
+
+// TestDebugLevel tests that DEBUG messages are only written when enabled
+func TestDebugLevel(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	logger.Debug("Dropped by default")
+	logger.SetMinLevel(DEBUG)
+	logger.Debugf("Debug %s", "enabled")
+
+	if strings.Contains(buf.String(), "Dropped") {
+		t.Errorf("DEBUG message written with the default min level: %q", buf.String())
+	}
+	if !strings.HasPrefix(buf.String(), "[DEBUG] ") || !strings.Contains(buf.String(), "Debug enabled") {
+		t.Errorf("DEBUG message not found: %q", buf.String())
+	}
+}
+
+// TestWriter tests bridging the standard log package through Writer
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	oldOutput, oldFlags := log.Writer(), log.Flags()
+	log.SetOutput(logger.Writer(ERROR))
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(oldOutput)
+		log.SetFlags(oldFlags)
+	}()
+
+	log.Print("std log message")
+	log.Print("first line\nsecond line")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{"std log message", "first line", "second line"}
+	if len(lines) != len(want) {
+		t.Fatalf("Log lines = %d, want %d:\n%s", len(lines), len(want), buf.String())
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "[ERROR] ") || !strings.HasSuffix(line, ": "+want[i]) {
+			t.Errorf("Line %d = %q, want an ERROR entry with %q", i, line, want[i])
+		}
+	}
+}
+
+// TestLogReturnsWriteErrors tests that Log surfaces failed writes to the file
+func TestLogReturnsWriteErrors(t *testing.T) {
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(t.TempDir()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	if err := logger.Log(WARNING, "Written %d", 1); err != nil {
+		t.Fatalf("Log() error = %v, want nil", err)
+	}
+	if err := logger.Log(DEBUG, "Filtered"); err != nil {
+		t.Errorf("Log() of a filtered level error = %v, want nil", err)
+	}
+
+	// Simulate a failing disk by closing the file handle under the logger
+	logger.logFile.Close()
+	if err := logger.Log(ERROR, "Lost message"); err == nil {
+		t.Error("Log() error = nil after the log file was closed")
+	}
+}
+
+// TestErrorErr tests logging error values with their wrapped chain
+func TestErrorErr(t *testing.T) {
+	inner := errors.New("connection refused")
+	err := fmt.Errorf("outer: %w", fmt.Errorf("dial: %w", inner))
+
+	var buf bytes.Buffer
+	logger, createErr := NewLogger(WithConsoleOutput(false), WithWriter(&buf), WithStackTrace(ERROR))
+	if createErr != nil {
+		t.Fatalf("Failed to create logger: %v", createErr)
+	}
+
+	logger.ErrorErr(err)
+	output := buf.String()
+
+	for _, want := range []string{
+		": outer: dial: connection refused\n",
+		"Error Chain:\n\touter: dial: connection refused\n\t\tdial: connection refused\n\t\t\tconnection refused\n",
+		"Stack Trace:",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Output doesn't contain %q:\n%s", want, output)
+		}
+	}
+
+	// A nil error is clearly marked instead of panicking
+	buf.Reset()
+	logger.ErrorErr(nil)
+	if !strings.Contains(buf.String(), "<nil error>") {
+		t.Errorf("Output for nil error = %q, want <nil error>", buf.String())
+	}
+}
+
+// TestErrorErrWithoutStackTrace tests that the chain is only listed when stack traces are enabled
+func TestErrorErrWithoutStackTrace(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	logger.ErrorErr(fmt.Errorf("outer: %w", errors.New("inner")))
+	logger.WithError(errors.New("disk full")).Warning("upload failed")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Log lines = %d, want 2:\n%s", len(lines), buf.String())
+	}
+	if !strings.HasSuffix(lines[0], ": outer: inner") {
+		t.Errorf("Line = %q, want the error message only", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], `: upload failed error="disk full"`) {
+		t.Errorf("Line = %q, want the error field", lines[1])
+	}
+}
+
+// logRequest is a helper wrapping the logger like application code does
+func logRequest(l *Logger, path string) {
+	l.Info("request %s", path)
+}
+
+// TestCallerSkip tests that WithCallerSkip reports the caller of a wrapper
+func TestCallerSkip(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithWriter(&buf),
+		WithCallerSkip(1),
+		WithStackTrace(INFO),
+		WithStackTraceDepth(1),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	_, _, line, _ := runtime.Caller(0)
+	logRequest(logger, "/ocr")
+
+	location := fmt.Sprintf("logger_test.go:%d", line+1)
+	if !strings.Contains(buf.String(), location+": request /ocr") {
+		t.Errorf("Output = %q, want location %s", buf.String(), location)
+	}
+	if !strings.Contains(buf.String(), "\t"+location+" - logger.TestCallerSkip") {
+		t.Errorf("Stack trace doesn't start at the wrapper's caller:\n%s", buf.String())
+	}
+}
+
 // TestStackTrace tests the stack trace functionality
 func TestStackTrace(t *testing.T) {
 	tempDir := t.TempDir()
@@ -352,12 +904,796 @@ func TestRotateLogFile(t *testing.T) {
 	}
 }
 
-// Helper function to get the last line of a string
-func getLastLine(s string) string {
-	scanner := bufio.NewScanner(strings.NewReader(s))
+// TestFormattedLogging tests the formatted logging methods and their caller location
+func TestFormattedLogging(t *testing.T) {
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(t.TempDir()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	_, _, line, _ := runtime.Caller(0)
+	logger.Infof("processed %d items in %s", 3, "1s")
+	checkLastLine(t, logger, "INFO", "processed 3 items in 1s", line+1)
+
+	_, _, line, _ = runtime.Caller(0)
+	logger.Warningf("retry %d of %d", 1, 3)
+	checkLastLine(t, logger, "WARNING", "retry 1 of 3", line+1)
+
+	_, _, line, _ = runtime.Caller(0)
+	logger.Errorf("request %q failed", "abc")
+	checkLastLine(t, logger, "ERROR", `request "abc" failed`, line+1)
+
+	// The plain methods must report the same caller location
+	_, _, line, _ = runtime.Caller(0)
+	logger.Info("plain %s", "info")
+	checkLastLine(t, logger, "INFO", "plain info", line+1)
+}
+
+// checkLastLine verifies the level, message and caller line of the last log entry
+func checkLastLine(t *testing.T, logger *Logger, levelStr, message string, line int) {
+	t.Helper()
+
+	content, err := os.ReadFile(logger.GetCurrentLogFile())
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	lastLine := getLastLine(string(content))
+
+	if !strings.Contains(lastLine, "["+levelStr+"]") {
+		t.Errorf("Log level not found, got: %s, want: %s", lastLine, levelStr)
+	}
+	if !strings.Contains(lastLine, message) {
+		t.Errorf("Log message not found, got: %s, want: %s", lastLine, message)
+	}
+	if location := fmt.Sprintf("logger_test.go:%d:", line); !strings.Contains(lastLine, location) {
+		t.Errorf("Caller location not found, got: %s, want: %s", lastLine, location)
+	}
+}
+
+// TestMinLevel tests that messages below the minimum level are dropped
+func TestMinLevel(t *testing.T) {
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(t.TempDir()),
+		WithMinLevel(ERROR),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	logger.Info("Dropped info message")
+	logger.Warningf("Dropped %s message", "warning")
+	logger.Error("Kept error message")
+
+	content, err := os.ReadFile(logger.GetCurrentLogFile())
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+
+	if strings.Contains(string(content), "Dropped") {
+		t.Errorf("Messages below ERROR reached the log file:\n%s", content)
+	}
+	if !strings.Contains(string(content), "Kept error message") {
+		t.Errorf("Error message not found in log file:\n%s", content)
+	}
+}
+
+// TestSetMinLevel tests changing the minimum level at runtime
+func TestSetMinLevel(t *testing.T) {
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(t.TempDir()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	if got := logger.GetMinLevel(); got != INFO {
+		t.Errorf("Default min level = %v, want %v", got, INFO)
+	}
+
+	logger.SetMinLevel(WARNING)
+	if got := logger.GetMinLevel(); got != WARNING {
+		t.Errorf("Min level = %v, want %v", got, WARNING)
+	}
+	logger.Info("Dropped after SetMinLevel")
+
+	logger.SetMinLevel(INFO)
+	logger.Info("Kept after lowering the level")
+
+	content, err := os.ReadFile(logger.GetCurrentLogFile())
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if strings.Contains(string(content), "Dropped") {
+		t.Errorf("Message below the min level reached the log file:\n%s", content)
+	}
+	if !strings.Contains(string(content), "Kept after lowering the level") {
+		t.Errorf("Message not found after lowering the level:\n%s", content)
+	}
+}
+
+// TestSetMinLevelConcurrent changes the level while other goroutines log, run with -race
+func TestSetMinLevelConcurrent(t *testing.T) {
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(t.TempDir()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Info("info %d", j)
+				logger.Warning("warning %d", j)
+				logger.Error("error %d", j)
+			}
+		}()
+	}
+
+	levels := []LogLevel{INFO, WARNING, ERROR}
+	for i := 0; i < 100; i++ {
+		logger.SetMinLevel(levels[i%len(levels)])
+		logger.GetMinLevel()
+	}
+	wg.Wait()
+
+	// Every line must be complete, concurrent writes must not interleave
+	content, err := os.ReadFile(logger.GetCurrentLogFile())
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		if !strings.HasPrefix(line, "[") {
+			t.Fatalf("Malformed log line: %q", line)
+		}
+	}
+}
+
+// TestMaxFileSize tests automatic rotation once the log file reaches the size limit
+func TestMaxFileSize(t *testing.T) {
+	tempDir := t.TempDir()
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(tempDir),
+		WithMaxFileSize(300),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	firstFile := logger.GetCurrentLogFile()
+	for i := 0; i < 10; i++ {
+		logger.Info("Size rotation entry %d", i)
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read log directory: %v", err)
+	}
+	if len(entries) < 2 {
+		t.Fatalf("Log files = %d, want at least 2 after crossing the size limit", len(entries))
+	}
+
+	for _, entry := range entries {
+		info, _ := entry.Info()
+		if info.Size() > 300 {
+			t.Errorf("Log file %s has %d bytes, want at most 300", entry.Name(), info.Size())
+		}
+	}
+
+	lastFile := logger.GetCurrentLogFile()
+	if lastFile == firstFile {
+		t.Fatal("Current log file did not change after crossing the size limit")
+	}
+	content, err := os.ReadFile(lastFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(content), "Size rotation entry 9") {
+		t.Errorf("Latest log file doesn't contain the later entries:\n%s", content)
+	}
+	firstContent, _ := os.ReadFile(firstFile)
+	if !strings.Contains(string(firstContent), "Size rotation entry 0") || strings.Contains(string(firstContent), "Size rotation entry 9") {
+		t.Errorf("First log file has unexpected content:\n%s", firstContent)
+	}
+}
+
+// TestRotationInterval tests time-based rotation and that Close stops it
+func TestRotationInterval(t *testing.T) {
+	tempDir := t.TempDir()
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(tempDir),
+		WithRotationInterval(100*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	firstFile := logger.GetCurrentLogFile()
+	logger.Info("Before rotation")
+	time.Sleep(250 * time.Millisecond)
+	logger.Info("After rotation")
+
+	secondFile := logger.GetCurrentLogFile()
+	if secondFile == firstFile {
+		t.Fatal("Log file was not rotated after the interval passed")
+	}
+	content, err := os.ReadFile(secondFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if !strings.Contains(string(content), "After rotation") {
+		t.Errorf("Current log file doesn't contain the later entry:\n%s", content)
+	}
+
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// No more files are created once the logger is closed
+	entries, _ := os.ReadDir(tempDir)
+	time.Sleep(250 * time.Millisecond)
+	if after, _ := os.ReadDir(tempDir); len(after) != len(entries) {
+		t.Errorf("Log files = %d after Close, want %d", len(after), len(entries))
+	}
+}
+
+// TestRotationIntervalWithoutFileOutput tests that the option is a no-op without file output
+func TestRotationIntervalWithoutFileOutput(t *testing.T) {
+	logDir := filepath.Join(t.TempDir(), "logs")
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(false),
+		WithWriter(io.Discard),
+		WithLogDirectory(logDir),
+		WithRotationInterval(10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	logger.Info("No file output")
+	time.Sleep(50 * time.Millisecond)
+
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(logDir); !os.IsNotExist(err) {
+		t.Errorf("Log directory was created without file output: %v", err)
+	}
+}
+
+// TestMaxBackups tests that only the newest log files are kept after rotation
+func TestMaxBackups(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Files from earlier runs and unrelated files in the log directory
+	for _, name := range []string{"2020-01-01_00-00-00.log", "2020-01-01_00-00-00_1.log", "notes.txt", "app.log"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), nil, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(tempDir),
+		WithMaxBackups(2),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	var created []string
+	for i := 0; i < 4; i++ {
+		logger.Info("Entry %d", i)
+		if err := logger.RotateLogFile(); err != nil {
+			t.Fatalf("Failed to rotate log file: %v", err)
+		}
+		created = append(created, filepath.Base(logger.GetCurrentLogFile()))
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read log directory: %v", err)
+	}
+	var logFiles []string
+	for _, entry := range entries {
+		if _, ok := parseLogFileName(entry.Name(), ""); ok {
+			logFiles = append(logFiles, entry.Name())
+		}
+	}
+
+	want := created[len(created)-2:]
+	if len(logFiles) != 2 || !slices.Contains(logFiles, want[0]) || !slices.Contains(logFiles, want[1]) {
+		t.Errorf("Remaining log files = %v, want %v", logFiles, want)
+	}
+
+	// Files that don't match the log file name format are left alone
+	for _, name := range []string{"notes.txt", "app.log"} {
+		if _, err := os.Stat(filepath.Join(tempDir, name)); err != nil {
+			t.Errorf("Unrelated file %s was removed", name)
+		}
+	}
+}
+
+// TestStats tests that the per-level counters are exact under concurrent logging
+func TestStats(t *testing.T) {
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(io.Discard), WithMinLevel(DEBUG))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	derived := logger.With("[worker] ")
+
+	const goroutines, perGoroutine = 8, 250
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				logger.Debug("debug %d", j)
+				logger.Info("info %d", j)
+				derived.Warning("warning %d", j)
+				if j%5 == 0 {
+					derived.Error("error %d", j)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	want := map[LogLevel]uint64{
+		DEBUG:   goroutines * perGoroutine,
+		INFO:    goroutines * perGoroutine,
+		WARNING: goroutines * perGoroutine,
+		ERROR:   goroutines * perGoroutine / 5,
+	}
+	if stats := logger.Stats(); !maps.Equal(stats, want) {
+		t.Errorf("Stats() = %v, want %v", stats, want)
+	}
+
+	// Entries below the minimum level are not counted
+	logger.SetMinLevel(ERROR)
+	logger.Info("dropped")
+	if got := logger.Stats()[INFO]; got != want[INFO] {
+		t.Errorf("INFO count = %d after a dropped entry, want %d", got, want[INFO])
+	}
+}
+
+// TestHooks tests that hooks receive every entry in order and that a panicking hook is recovered
+func TestHooks(t *testing.T) {
+	type call struct {
+		hook    string
+		level   LogLevel
+		message string
+	}
+	var calls []call
+	record := func(name string) func(LogLevel, string) {
+		return func(level LogLevel, message string) {
+			calls = append(calls, call{name, level, message})
+		}
+	}
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithWriter(io.Discard),
+		WithHook(record("first")),
+		WithHook(func(LogLevel, string) { panic("hook failed") }),
+		WithHook(record("second")),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	logger.Info("started")
+	logger.With("[db]").Error("connection lost: %s", "timeout")
+	logger.Debug("below the min level")
+
+	want := []call{
+		{"first", INFO, "started"},
+		{"second", INFO, "started"},
+		{"first", ERROR, "[db] connection lost: timeout"},
+		{"second", ERROR, "[db] connection lost: timeout"},
+	}
+	if !slices.Equal(calls, want) {
+		t.Errorf("Hook calls = %+v, want %+v", calls, want)
+	}
+}
+
+// TestRateLimit tests that entries over the per-second budget are dropped and reported in a notice
+func TestRateLimit(t *testing.T) {
+	tempDir := t.TempDir()
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithFileOutput(true),
+		WithLogDirectory(tempDir),
+		WithMinLevel(ERROR),
+		WithRateLimit(10),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	logFile := logger.GetCurrentLogFile()
+
+	const total = 1000
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < total/4; j++ {
+				logger.Error("flood %d", j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Close writes the notice for the current window
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Failed to close logger: %v", err)
+	}
+
+	content, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+
+	written := strings.Count(string(content), ": flood ")
+	suppressed := 0
+	for _, match := range regexp.MustCompile(`\[ERROR\] .* - rate limit: (\d+) messages suppressed`).FindAllStringSubmatch(string(content), -1) {
+		n, _ := strconv.Atoi(match[1])
+		suppressed += n
+	}
+
+	// The loop normally fits in one window, a slow run may start a second one
+	if written < 10 || written > 20 {
+		t.Errorf("Written entries = %d, want about 10", written)
+	}
+	if written+suppressed != total {
+		t.Errorf("Written %d + suppressed %d = %d, want %d:\n%s", written, suppressed, written+suppressed, total, content)
+	}
+}
+
+// TestRateLimitFlushesWithoutNewEntry tests that the suppressed notice is written once the window
+// has passed even when nothing else is logged
+func TestRateLimitFlushesWithoutNewEntry(t *testing.T) {
+	// The notice is written from another goroutine, the released blockingWriter makes reading it safe
+	buf := &blockingWriter{release: make(chan struct{})}
+	close(buf.release)
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(buf), WithRateLimit(2))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	for i := 0; i < 5; i++ {
+		logger.Info("burst %d", i)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !strings.Contains(buf.String(), "rate limit: 3 messages suppressed") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Output = %q, want the suppressed notice without a new entry", buf.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestCleanupOnStart tests that only log files with an old timestamp in their name are removed
+func TestCleanupOnStart(t *testing.T) {
+	tempDir := t.TempDir()
+
+	recent := logFileName("", time.Now().Add(-time.Hour).Format(logFileTimeFormat), 0)
+	recentIndexed := logFileName("", time.Now().Add(-time.Hour).Format(logFileTimeFormat), 2)
+	old := []string{"2020-01-01_00-00-00.log", "2020-01-01_00-00-00_1.log"}
+	// Names the logger can't parse or that belong to another prefix are kept however old they are
+	kept := []string{recent, recentIndexed, "2020-01-01.log", "notes.txt", "api_2020-01-01_00-00-00.log"}
+
+	for _, name := range append(slices.Clone(old), kept...) {
+		if err := os.WriteFile(filepath.Join(tempDir, name), nil, 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithWriter(io.Discard),
+		WithLogDirectory(tempDir),
+		WithCleanupOnStart(24*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read log directory: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	slices.Sort(names)
+	slices.Sort(kept)
+	if !slices.Equal(names, kept) {
+		t.Errorf("Remaining files = %v, want %v", names, kept)
+	}
+}
+
+// TestCleanupOnStartMissingDirectory tests that a log directory that doesn't exist yet is not an error
+func TestCleanupOnStartMissingDirectory(t *testing.T) {
+	logger, err := NewLogger(
+		WithConsoleOutput(false),
+		WithWriter(io.Discard),
+		WithLogDirectory(filepath.Join(t.TempDir(), "missing")),
+		WithCleanupOnStart(time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+	logger.Close()
+}
+
+// TestSequence tests that sequence numbers increase by one per entry across goroutines
+func TestSequence(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf), WithSequence(true))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	const goroutines, perGoroutine = 4, 200
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perGoroutine; j++ {
+				logger.Info("entry %d", j)
+				// Dropped entries don't take a number
+				logger.Debug("dropped")
+			}
+		}()
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != goroutines*perGoroutine {
+		t.Fatalf("Log lines = %d, want %d", len(lines), goroutines*perGoroutine)
+	}
+	for i, line := range lines {
+		if want := fmt.Sprintf("#%d [INFO] ", i+1); !strings.HasPrefix(line, want) {
+			t.Fatalf("Line %d = %q, want prefix %q", i, line, want)
+		}
+	}
+}
+
+// TestSequenceJSON tests that the sequence number is a JSON key
+func TestSequenceJSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf), WithSequence(true), WithJSONFormat(true))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	logger.WithFields(map[string]interface{}{"seq": "overridden"}).Info("first")
+	logger.Info("second")
+
+	decoder := json.NewDecoder(&buf)
+	for want := 1.0; want <= 2; want++ {
+		var entry map[string]interface{}
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatalf("Cannot decode log line: %v", err)
+		}
+		if entry["seq"] != want {
+			t.Errorf("seq = %v, want %v", entry["seq"], want)
+		}
+	}
+}
+
+// TestLevelColor tests that a custom color replaces the default of its level only
+func TestLevelColor(t *testing.T) {
+	const magenta = "\033[1;35m"
+
+	output := captureStdout(t, func() {
+		logger, err := NewLogger(WithColor(true), WithLevelColor(WARNING, magenta), WithErrorWriter(os.Stdout))
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+		logger.Warning("custom color")
+		logger.Error("default color")
+	})
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Console output = %q, want 2 lines", output)
+	}
+	if !strings.HasPrefix(lines[0], magenta+"[WARNING]") {
+		t.Errorf("Warning line = %q, want the custom color", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], colorRed+"[ERROR]") {
+		t.Errorf("Error line = %q, want the default color", lines[1])
+	}
+}
+
+// TestLevelColorInvalid tests that codes other than SGR escape sequences are rejected
+func TestLevelColorInvalid(t *testing.T) {
+	for _, code := range []string{"magenta", "\033[35m\n", "\033]0;title\007", ""} {
+		if _, err := NewLogger(WithLevelColor(INFO, code)); err == nil {
+			t.Errorf("NewLogger() accepted color %q", code)
+		}
+	}
+}
+
+// TestFilePrefix tests that loggers with different prefixes only rotate and clean their own files
+func TestFilePrefix(t *testing.T) {
+	tempDir := t.TempDir()
+
+	newPrefixed := func(prefix string) *Logger {
+		logger, err := NewLogger(
+			WithConsoleOutput(false),
+			WithFileOutput(true),
+			WithLogDirectory(tempDir),
+			WithFilePrefix(prefix),
+			WithMaxBackups(1),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+		return logger
+	}
+
+	api := newPrefixed("api")
+	defer api.Close()
+	worker := newPrefixed("worker")
+	defer worker.Close()
+
+	if name := filepath.Base(api.GetCurrentLogFile()); !strings.HasPrefix(name, "api_") {
+		t.Errorf("Log file name = %s, want prefix api_", name)
+	}
+
+	workerFile := worker.GetCurrentLogFile()
+	for i := 0; i < 3; i++ {
+		if err := api.RotateLogFile(); err != nil {
+			t.Fatalf("Failed to rotate log file: %v", err)
+		}
+	}
+
+	// The api logger keeps only its newest file and doesn't touch the worker's file
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read log directory: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(names) != 2 || !slices.Contains(names, filepath.Base(api.GetCurrentLogFile())) || !slices.Contains(names, filepath.Base(workerFile)) {
+		t.Errorf("Log files = %v, want the current api and worker files", names)
+	}
+}
+
+// TestParseLogFileName tests parsing of generated log file names
+func TestParseLogFileName(t *testing.T) {
+	tests := []struct {
+		name      string
+		prefix    string
+		wantOK    bool
+		wantIndex int
+	}{
+		{"2024-05-01_10-20-30.log", "", true, 0},
+		{"2024-05-01_10-20-30_3.log", "", true, 3},
+		{"2024-05-01_10-20-30_x.log", "", false, 0},
+		{"2024-05-01_10-20-305.log", "", false, 0},
+		{"2024-05-01.log", "", false, 0},
+		{"app.log", "", false, 0},
+		{"2024-05-01_10-20-30.txt", "", false, 0},
+		{"api_2024-05-01_10-20-30.log", "api", true, 0},
+		{"api_2024-05-01_10-20-30_2.log", "api", true, 2},
+		{"api_2024-05-01_10-20-30.log", "", false, 0},
+		{"worker_2024-05-01_10-20-30.log", "api", false, 0},
+		{"2024-05-01_10-20-30.log", "api", false, 0},
+	}
+
+	for _, tt := range tests {
+		info, ok := parseLogFileName(tt.name, tt.prefix)
+		if ok != tt.wantOK || info.index != tt.wantIndex {
+			t.Errorf("parseLogFileName(%q, %q) = %+v, %v, want index %d, %v", tt.name, tt.prefix, info, ok, tt.wantIndex, tt.wantOK)
+		}
+	}
+}
+
+// Helper function to get the last line of a string
+func getLastLine(s string) string {
+	scanner := bufio.NewScanner(strings.NewReader(s))
 	var lastLine string
 	for scanner.Scan() {
 		lastLine = scanner.Text()
 	}
 	return lastLine
 }
+
+// TestErrorWriter tests that console output of errors goes to the error writer and the rest to stdout
+func TestErrorWriter(t *testing.T) {
+	var errBuf bytes.Buffer
+	output := captureStdout(t, func() {
+		logger, err := NewLogger(WithColor(true), WithErrorWriter(&errBuf))
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+		logger.Info("routine info")
+		logger.Warning("routine warning")
+		logger.Error("disk failure")
+	})
+
+	if !strings.Contains(output, "routine info") || !strings.Contains(output, "routine warning") {
+		t.Errorf("Stdout = %q, want the info and warning entries", output)
+	}
+	if strings.Contains(output, "disk failure") {
+		t.Errorf("Stdout = %q, want no error entry", output)
+	}
+
+	errOutput := errBuf.String()
+	if strings.Count(errOutput, "\n") != 1 || !strings.HasPrefix(errOutput, colorRed+"[ERROR]") || !strings.Contains(errOutput, "disk failure") {
+		t.Errorf("Error writer = %q, want only the colored error entry", errOutput)
+	}
+}
+
+// TestErrorWriterDefaultsToStderr tests that errors go to stderr when no error writer is given
+func TestErrorWriterDefaultsToStderr(t *testing.T) {
+	oldStderr := os.Stderr
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	os.Stderr = w
+
+	output := captureStdout(t, func() {
+		logger, err := NewLogger()
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+		logger.Error("to stderr")
+	})
+	w.Close()
+	os.Stderr = oldStderr
+	errOutput, _ := io.ReadAll(r)
+
+	if strings.Contains(output, "to stderr") || !strings.Contains(string(errOutput), "[ERROR]") {
+		t.Errorf("Stdout = %q, stderr = %q, want the error on stderr only", output, errOutput)
+	}
+}
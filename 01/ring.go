@@ -0,0 +1,46 @@
+package logger
+
+import "strings"
+
+// memoryRing keeps the most recent entries in a fixed-size circular buffer
+type memoryRing struct {
+	entries []string
+	// next is where the next entry goes, the oldest entry once the ring is full
+	next int
+	full bool
+}
+
+// newMemoryRing creates a ring holding up to size entries
+func newMemoryRing(size int) *memoryRing {
+	return &memoryRing{entries: make([]string, size)}
+}
+
+// add stores an entry, replacing the oldest one when the ring is full
+func (r *memoryRing) add(entry string) {
+	r.entries[r.next] = strings.TrimSuffix(entry, "\n")
+	r.next++
+	if r.next == len(r.entries) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// snapshot returns a copy of the entries, oldest first
+func (r *memoryRing) snapshot() []string {
+	if !r.full {
+		return append([]string(nil), r.entries[:r.next]...)
+	}
+	return append(append(make([]string, 0, len(r.entries)), r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// RecentLogs returns the last entries kept by WithMemoryRing, oldest first, or nil without a ring
+// In async mode entries appear once the background goroutine has written them
+func (l *Logger) RecentLogs() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ring == nil {
+		return nil
+	}
+	return l.ring.snapshot()
+}
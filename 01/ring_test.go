@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestMemoryRing tests that RecentLogs returns exactly the last entries, oldest first
+func TestMemoryRing(t *testing.T) {
+	logger, err := NewLogger(WithConsoleOutput(false), WithMemoryRing(5))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	logger.Info("entry 0")
+	logger.Info("entry 1")
+	if recent := logger.RecentLogs(); len(recent) != 2 || !strings.HasSuffix(recent[1], ": entry 1") {
+		t.Fatalf("RecentLogs() before wrapping = %q, want 2 entries", recent)
+	}
+
+	for i := 2; i < 12; i++ {
+		logger.Info("entry %d", i)
+	}
+
+	recent := logger.RecentLogs()
+	if len(recent) != 5 {
+		t.Fatalf("RecentLogs() = %d entries, want 5", len(recent))
+	}
+	for i, line := range recent {
+		if want := fmt.Sprintf(": entry %d", i+7); !strings.HasPrefix(line, "[INFO] ") || !strings.HasSuffix(line, want) {
+			t.Errorf("Entry %d = %q, want suffix %q", i, line, want)
+		}
+	}
+
+	// The result is a copy
+	recent[0] = "changed"
+	if logger.RecentLogs()[0] == "changed" {
+		t.Error("RecentLogs() returned the internal buffer")
+	}
+}
+
+// TestMemoryRingConcurrent tests the ring under concurrent logging and reading
+func TestMemoryRingConcurrent(t *testing.T) {
+	logger, err := NewLogger(WithConsoleOutput(false), WithMemoryRing(50))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Info("entry %d", j)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if recent := logger.RecentLogs(); len(recent) > 50 {
+					t.Errorf("RecentLogs() = %d entries, want at most 50", len(recent))
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if recent := logger.RecentLogs(); len(recent) != 50 {
+		t.Errorf("RecentLogs() = %d entries, want 50", len(recent))
+	}
+}
+
+// TestMemoryRingDisabled tests that RecentLogs returns nil without a ring
+func TestMemoryRingDisabled(t *testing.T) {
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&strings.Builder{}))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	logger.Info("not kept")
+	if recent := logger.RecentLogs(); recent != nil {
+		t.Errorf("RecentLogs() = %q, want nil", recent)
+	}
+}
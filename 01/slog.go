@@ -0,0 +1,116 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// slogHandler is a slog.Handler that writes records through a Logger
+type slogHandler struct {
+	logger *Logger
+	// attrs are the attributes added with WithAttrs, keys already carry their group prefix
+	attrs map[string]interface{}
+	// groupPrefix is prepended to the keys of later attributes, e.g. "request.user."
+	groupPrefix string
+}
+
+// NewSlogHandler returns a slog.Handler backed by l, so slog records use the same outputs,
+// rotation and formatting as the logger
+// Attributes become fields of the entry and keys in groups are prefixed with the group name
+func NewSlogHandler(l *Logger) slog.Handler {
+	return &slogHandler{logger: l}
+}
+
+// slogLevel maps a slog level to the closest LogLevel
+func slogLevel(level slog.Level) LogLevel {
+	switch {
+	case level < slog.LevelInfo:
+		return DEBUG
+	case level < slog.LevelWarn:
+		return INFO
+	case level < slog.LevelError:
+		return WARNING
+	default:
+		return ERROR
+	}
+}
+
+// Enabled reports whether the logger writes records at the given level
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return slogLevel(level) >= h.logger.GetMinLevel()
+}
+
+// Handle writes a record with its attributes and the registered context values as fields
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make(map[string]interface{}, len(h.attrs)+r.NumAttrs())
+	for key, value := range h.attrs {
+		fields[key] = value
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		addSlogAttr(fields, h.groupPrefix, attr)
+		return true
+	})
+
+	l := h.logger.fromContext(ctx)
+	if len(fields) > 0 {
+		l = l.WithFields(fields)
+	}
+
+	// The record knows where slog was called, the frames above the handler belong to slog itself
+	location := "unknown location"
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		location = fmt.Sprintf("%s:%d", filepath.Base(frame.File), frame.Line)
+	}
+
+	return l.output(1, location, slogLevel(r.Level), r.Message)
+}
+
+// WithAttrs returns a handler that adds attrs to every record
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	merged := make(map[string]interface{}, len(h.attrs)+len(attrs))
+	for key, value := range h.attrs {
+		merged[key] = value
+	}
+	for _, attr := range attrs {
+		addSlogAttr(merged, h.groupPrefix, attr)
+	}
+	return &slogHandler{logger: h.logger, attrs: merged, groupPrefix: h.groupPrefix}
+}
+
+// WithGroup returns a handler that prefixes the keys of later attributes with name
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{logger: h.logger, attrs: h.attrs, groupPrefix: h.groupPrefix + name + "."}
+}
+
+// addSlogAttr adds attr to fields, attributes of a group are flattened into "group.key"
+func addSlogAttr(fields map[string]interface{}, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		// A group without a key is inlined into the current group
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, groupAttr := range attr.Value.Group() {
+			addSlogAttr(fields, prefix, groupAttr)
+		}
+		return
+	}
+
+	fields[strings.TrimSuffix(prefix+attr.Key, ".")] = attr.Value.Any()
+}
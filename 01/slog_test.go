@@ -0,0 +1,118 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/slogtest"
+)
+
+// TestSlogHandler tests logging through slog with attributes and groups
+func TestSlogHandler(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	slogger := slog.New(NewSlogHandler(logger))
+	slogger.Info("request done", "status", 200, "path", "/ocr")
+	slogger.With("request_id", "abc").WithGroup("user").Warn("slow request", "id", 42, slog.Group("plan", "name", "free"))
+	slogger.Debug("dropped by the default min level")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Log lines = %d, want 2:\n%s", len(lines), buf.String())
+	}
+
+	if !strings.HasPrefix(lines[0], "[INFO] ") || !strings.Contains(lines[0], "slog_test.go:") {
+		t.Errorf("Line %q, want an INFO entry with the slog call site", lines[0])
+	}
+	if !strings.HasSuffix(lines[0], ": request done path=/ocr status=200") {
+		t.Errorf("Line %q doesn't contain the attributes", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "[WARNING] ") || !strings.HasSuffix(lines[1], ": slow request request_id=abc user.id=42 user.plan.name=free") {
+		t.Errorf("Line %q doesn't contain the grouped attributes", lines[1])
+	}
+}
+
+// TestSlogHandlerJSON tests that slog attributes become JSON fields
+func TestSlogHandlerJSON(t *testing.T) {
+	var buf bytes.Buffer
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithWriter(&buf), WithJSONFormat(true))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	slog.New(NewSlogHandler(logger)).Error("failed", "attempt", 3)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Cannot decode log line %q: %v", buf.String(), err)
+	}
+	if entry["level"] != "ERROR" || entry["message"] != "failed" || entry["attempt"] != float64(3) {
+		t.Errorf("Entry = %v, want an ERROR entry with attempt=3", entry)
+	}
+}
+
+// TestSlogHandlerConformance runs the standard library handler checks
+func TestSlogHandlerConformance(t *testing.T) {
+	var buf *bytes.Buffer
+
+	newHandler := func(t *testing.T) slog.Handler {
+		buf = new(bytes.Buffer)
+		logger, err := NewLogger(WithConsoleOutput(false), WithWriter(buf), WithJSONFormat(true))
+		if err != nil {
+			t.Fatalf("Failed to create logger: %v", err)
+		}
+		return NewSlogHandler(logger)
+	}
+
+	result := func(t *testing.T) map[string]any {
+		// Every entry has a timestamp, even for records without a time
+		if strings.HasSuffix(t.Name(), "/zero-time") {
+			t.Skip("entries always carry a timestamp")
+		}
+
+		var flat map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &flat); err != nil {
+			t.Fatalf("Cannot decode log line %q: %v", buf.String(), err)
+		}
+		return unflatten(flat)
+	}
+
+	slogtest.Run(t, newHandler, result)
+}
+
+// unflatten turns "group.key" fields back into nested maps and renames the standard keys
+// to the names slogtest expects
+func unflatten(flat map[string]any) map[string]any {
+	entry := map[string]any{
+		slog.LevelKey:   flat["level"],
+		slog.MessageKey: flat["message"],
+		slog.TimeKey:    flat["timestamp"],
+	}
+	for key, value := range flat {
+		switch key {
+		case "level", "message", "timestamp", "location", "stack_trace":
+			continue
+		}
+
+		parts := strings.Split(key, ".")
+		group := entry
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := group[part].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				group[part] = next
+			}
+			group = next
+		}
+		group[parts[len(parts)-1]] = value
+	}
+	return entry
+}
@@ -0,0 +1,120 @@
+package logger
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// syslogFacilityUser is the facility of user-level messages
+const syslogFacilityUser = 1
+
+// syslogWriter sends entries to a syslog server in the RFC 5424 format
+type syslogWriter struct {
+	network  string
+	addr     string
+	hostname string
+	appName  string
+	// conn is nil after a failed write until the next reconnect
+	conn net.Conn
+}
+
+// newSyslogWriter connects to the syslog server at addr, network is "udp", "tcp" or "unix"
+func newSyslogWriter(network, addr string) (*syslogWriter, error) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	w := &syslogWriter{
+		network:  network,
+		addr:     addr,
+		hostname: hostname,
+		appName:  filepath.Base(os.Args[0]),
+	}
+	if err := w.connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog server: %v", err)
+	}
+	return w, nil
+}
+
+// connect opens a new connection to the server
+func (w *syslogWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// syslogSeverity maps a level to the syslog severity
+func syslogSeverity(level LogLevel) int {
+	switch {
+	case level <= DEBUG:
+		return 7 // debug
+	case level == INFO:
+		return 6 // informational
+	case level == WARNING:
+		return 4 // warning
+	default:
+		return 3 // error
+	}
+}
+
+// format builds an RFC 5424 message, stream connections use octet counting framing from RFC 6587
+func (w *syslogWriter) format(level LogLevel, t time.Time, message string) []byte {
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		syslogFacilityUser*8+syslogSeverity(level),
+		t.Format(time.RFC3339Nano),
+		w.hostname,
+		w.appName,
+		os.Getpid(),
+		strings.TrimRight(message, "\n"),
+	)
+	if w.isStream() {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	return []byte(msg)
+}
+
+// isStream reports whether the connection is a byte stream, where messages need framing
+func (w *syslogWriter) isStream() bool {
+	return !strings.HasPrefix(w.network, "udp") && w.network != "unixgram"
+}
+
+// write sends one entry, a failed write is retried once on a new connection
+func (w *syslogWriter) write(level LogLevel, t time.Time, message string) error {
+	packet := w.format(level, t, message)
+
+	if w.conn != nil {
+		if _, err := w.conn.Write(packet); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	if err := w.connect(); err != nil {
+		return fmt.Errorf("failed to write to syslog: %v", err)
+	}
+	if _, err := w.conn.Write(packet); err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return fmt.Errorf("failed to write to syslog: %v", err)
+	}
+	return nil
+}
+
+// close closes the connection
+func (w *syslogWriter) close() error {
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestSyslog tests that entries reach a syslog server as RFC 5424 messages with the mapped severity
+func TestSyslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	logger, err := NewLogger(WithConsoleOutput(false), WithSyslog("udp", conn.LocalAddr().String()))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	if err := logger.Log(WARNING, "disk almost full"); err != nil {
+		t.Fatalf("Log() error = %v", err)
+	}
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Failed to read syslog message: %v", err)
+	}
+
+	message := string(buf[:n])
+	match := regexp.MustCompile(`^<(\d+)>1 (\S+) \S+ \S+ \d+ - - (.*)$`).FindStringSubmatch(message)
+	if match == nil {
+		t.Fatalf("Message %q isn't in the RFC 5424 format", message)
+	}
+	// Facility user (1) and severity warning (4)
+	if pri, _ := strconv.Atoi(match[1]); pri != 12 {
+		t.Errorf("PRI = %d, want 12", pri)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, match[2]); err != nil {
+		t.Errorf("Timestamp %q isn't RFC 3339: %v", match[2], err)
+	}
+	if !regexp.MustCompile(`^\[WARNING\] .*: disk almost full$`).MatchString(match[3]) {
+		t.Errorf("MSG = %q, want the log entry", match[3])
+	}
+}
+
+// TestSyslogConnectionFailure tests that NewLogger fails when the server is unreachable
+func TestSyslogConnectionFailure(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	if _, err := NewLogger(WithConsoleOutput(false), WithSyslog("tcp", addr)); err == nil {
+		t.Error("NewLogger() succeeded with an unreachable syslog server")
+	}
+}
+
+// TestSyslogSeverity tests the mapping of levels to syslog severities
+func TestSyslogSeverity(t *testing.T) {
+	tests := map[LogLevel]int{DEBUG: 7, INFO: 6, WARNING: 4, ERROR: 3}
+	for level, want := range tests {
+		if got := syslogSeverity(level); got != want {
+			t.Errorf("syslogSeverity(%v) = %d, want %d", level, got, want)
+		}
+	}
+}
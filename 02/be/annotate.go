@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// annotateOptions là màu và độ dày nét dùng để vẽ bounding box
+type annotateOptions struct {
+	color     color.RGBA
+	thickness int
+}
+
+// parseAnnotateOptions đọc tham số color (hex rrggbb) và thickness (pixel) từ request
+func parseAnnotateOptions(r *http.Request) (annotateOptions, error) {
+	opts := annotateOptions{
+		color:     color.RGBA{R: 255, A: 255},
+		thickness: 2,
+	}
+
+	if value := r.FormValue("color"); value != "" {
+		b, err := hex.DecodeString(strings.TrimPrefix(value, "#"))
+		if err != nil || len(b) != 3 {
+			return opts, fmt.Errorf("invalid color %q, expected rrggbb", value)
+		}
+		opts.color = color.RGBA{R: b[0], G: b[1], B: b[2], A: 255}
+	}
+
+	if value := r.FormValue("thickness"); value != "" {
+		thickness, err := strconv.Atoi(value)
+		if err != nil || thickness < 1 || thickness > 20 {
+			return opts, fmt.Errorf("invalid thickness %q, expected 1-20", value)
+		}
+		opts.thickness = thickness
+	}
+
+	return opts, nil
+}
+
+// drawBoxes vẽ đa giác Coords của từng kết quả, tọa độ được nhân với scale để khớp kích thước ảnh
+func drawBoxes(img draw.Image, results []OCRResult, scaleX, scaleY float64, opts annotateOptions) {
+	for _, result := range results {
+		for i := range result.Coords {
+			from := result.Coords[i]
+			to := result.Coords[(i+1)%len(result.Coords)]
+			drawLine(img,
+				int(from[0]*scaleX), int(from[1]*scaleY),
+				int(to[0]*scaleX), int(to[1]*scaleY),
+				opts.color, opts.thickness)
+		}
+	}
+}
+
+// drawLine vẽ đoạn thẳng bằng thuật toán Bresenham với nét vuông có độ dày thickness
+func drawLine(img draw.Image, x0, y0, x1, y1 int, c color.Color, thickness int) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	brush := image.Rect(-thickness/2, -thickness/2, thickness-thickness/2, thickness-thickness/2)
+	err := dx + dy
+	for {
+		draw.Draw(img, brush.Add(image.Pt(x0, y0)).Intersect(img.Bounds()), image.NewUniform(c), image.Point{}, draw.Src)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// decodeUpload decode ảnh đã upload để vẽ kết quả OCR lên
+func decodeUpload(upload *ocrUpload) (image.Image, error) {
+	file, err := os.Open(upload.path)
+	if err != nil {
+		return nil, &requestError{http.StatusInternalServerError, "Error opening uploaded image: " + err.Error()}
+	}
+	defer file.Close()
+
+	src, _, err := image.Decode(file)
+	if err != nil {
+		return nil, &requestError{http.StatusBadRequest, "Unsupported image format: " + err.Error()}
+	}
+	return src, nil
+}
+
+// handleOCRAnnotate chạy OCR rồi trả về ảnh PNG có vẽ bounding box của các kết quả để debug trực quan
+func (s *server) handleOCRAnnotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	upload, err := s.receiveUpload(w, r)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	defer upload.remove()
+
+	opts, err := parseAnnotateOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	src, err := decodeUpload(upload)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	results, _, err := s.recognize(r.Context(), upload)
+	if err != nil {
+		s.writeOCRError(w, r, "Error processing image with PaddleOCR", err)
+		return
+	}
+
+	// Vẽ lên bản sao của ảnh gốc, Coords nằm trong không gian ảnh sau khi resize nên cần scale lại
+	bounds := src.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), src, bounds.Min, draw.Src)
+
+	width, height := processedDimensions(bounds.Dx(), bounds.Dy(), upload.maxWidth, upload.maxHeight)
+	drawBoxes(canvas, results, float64(bounds.Dx())/float64(width), float64(bounds.Dy())/float64(height), opts)
+
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, canvas)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// serveAnnotate gửi ảnh tới /ocr/annotate và decode ảnh PNG trả về
+func serveAnnotate(t *testing.T, srv *server, content []byte, fields map[string]string) image.Image {
+	t.Helper()
+
+	req := newUploadRequest(t, "image.png", content, fields)
+	req.URL.Path = "/ocr/annotate"
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Content-Type = %q, want image/png", ct)
+	}
+
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("Response is not a valid PNG: %v", err)
+	}
+	return img
+}
+
+func TestHandleOCRAnnotate(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	img := serveAnnotate(t, srv, encodePNG(t, 40, 20), map[string]string{"color": "00ff00", "thickness": "1"})
+
+	if size := img.Bounds().Size(); size != image.Pt(40, 20) {
+		t.Errorf("Annotated image size = %v, want 40x20", size)
+	}
+
+	// Script giả lập trả về box (0,0)-(10,10)
+	green := color.RGBA{G: 255, A: 255}
+	if got := color.RGBAModel.Convert(img.At(5, 0)); got != green {
+		t.Errorf("Pixel on box edge = %v, want %v", got, green)
+	}
+	if got := color.RGBAModel.Convert(img.At(5, 5)); got == green {
+		t.Error("Pixel inside the box should not be drawn")
+	}
+}
+
+func TestHandleOCRAnnotateScalesResizedCoords(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	// Ảnh 200x100 được OCR ở 100x50 nên box (0,0)-(10,10) tương ứng (0,0)-(20,20) trên ảnh gốc
+	img := serveAnnotate(t, srv, encodePNG(t, 200, 100), map[string]string{"max_width": "100", "thickness": "1"})
+
+	red := color.RGBA{R: 255, A: 255}
+	if got := color.RGBAModel.Convert(img.At(20, 10)); got != red {
+		t.Errorf("Pixel on scaled box edge = %v, want %v", got, red)
+	}
+}
+
+func TestHandleOCRAnnotateInvalidOptions(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	req := newUploadRequest(t, "image.png", encodePNG(t, 10, 10), map[string]string{"color": "red"})
+	req.URL.Path = "/ocr/annotate"
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
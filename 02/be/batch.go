@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ndjsonContentType là Content-Type của response batch dạng stream, mỗi dòng là một batchResult
+const ndjsonContentType = "application/x-ndjson"
+
+// maxBatchFiles là số ảnh tối đa trong một request /ocr/batch
+const maxBatchFiles = 32
+
+// batchResult là kết quả OCR của một file trong batch, Error khác rỗng khi file đó bị lỗi
+type batchResult struct {
+	Filename string      `json:"filename"`
+	Results  []OCRResult `json:"results"`
+	// Truncated là true khi kết quả bị cắt bớt theo tham số limit
+	Truncated bool `json:"truncated,omitempty"`
+	// Stats chỉ có khi client gửi stats=true
+	Stats *confidenceStats `json:"stats,omitempty"`
+	Error string           `json:"error,omitempty"`
+	// Code phân loại Error giống trường code của response lỗi /ocr
+	Code string `json:"code,omitempty"`
+}
+
+// fail ghi lỗi của file vào kết quả, code lấy theo loại lỗi giống response lỗi của /ocr
+func (b *batchResult) fail(err error) {
+	b.Error = err.Error()
+
+	var reqErr *requestError
+	var oe *ocrError
+	switch {
+	case errors.As(err, &reqErr):
+		b.Code = statusErrorCode(reqErr.status)
+	case errors.Is(err, errOCRTimeout):
+		b.Code = ocrErrorCode(ocrErrorTimeout)
+	case errors.Is(err, errOCRBusy):
+		b.Code = ocrErrorCode(ocrErrorBusy)
+	case errors.As(err, &oe):
+		b.Code = ocrErrorCode(oe.kind)
+	default:
+		b.Code = ocrErrorCode(ocrErrorScriptFailed)
+	}
+}
+
+// handleOCRBatch OCR nhiều ảnh gửi cùng trường "image" trong một form multipart
+// Mỗi file được xử lý độc lập, file lỗi chỉ có Error trong kết quả mà không làm hỏng cả batch
+func (s *server) handleOCRBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxUploadSize)
+	files, extra, err := s.readMultipart(r, maxBatchFiles)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	// Xóa các file tạm khi kết thúc, kể cả khi request bị từ chối trước khi OCR
+	defer func() {
+		for _, file := range files {
+			os.Remove(file.path)
+		}
+	}()
+
+	if extra > 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Too many files: at most %d images per batch", maxBatchFiles))
+		return
+	}
+	if len(files) == 0 {
+		writeRequestError(w, &requestError{http.StatusBadRequest, "Error retrieving the file: " + http.ErrMissingFile.Error()})
+		return
+	}
+
+	// Các tham số dùng chung cho mọi file nên được kiểm tra một lần trước khi OCR
+	opts, err := parseOutputOptions(r)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	if opts.plainText {
+		writeError(w, http.StatusBadRequest, "output=text is not supported in batch requests")
+		return
+	}
+	if opts.format != "" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("format=%s is not supported in batch requests", opts.format))
+		return
+	}
+	// Kết quả batch chỉ có danh sách box, lines/paragraphs sẽ bị bỏ qua nên từ chối thay vì im lặng
+	if opts.group != "" {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("group=%s is not supported in batch requests", opts.group))
+		return
+	}
+	if lang := r.FormValue("lang"); lang != "" && !supportedLanguages[lang] {
+		writeError(w, http.StatusBadRequest, "Unsupported language: "+lang)
+		return
+	}
+
+	stream, err := wantsBatchStream(r)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	if stream {
+		s.streamBatch(w, r, files, opts)
+		return
+	}
+
+	results := make([]batchResult, 0, len(files))
+	for _, file := range files {
+		results = append(results, s.recognizeBatchFile(r, file, opts))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// wantsBatchStream cho biết client muốn nhận kết quả batch dạng NDJSON, qua trường stream=true
+// hoặc header "Accept: application/x-ndjson"
+func wantsBatchStream(r *http.Request) (bool, error) {
+	switch stream := r.FormValue("stream"); stream {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "":
+		return strings.Contains(r.Header.Get("Accept"), ndjsonContentType), nil
+	default:
+		return false, &requestError{http.StatusBadRequest, "Invalid stream value: " + stream + " (expected true or false)"}
+	}
+}
+
+// streamBatch ghi kết quả của từng file thành một dòng JSON ngay khi file đó OCR xong
+// Response được flush sau mỗi dòng nếu ResponseWriter hỗ trợ http.Flusher, nếu không thì
+// các dòng vẫn đúng định dạng NDJSON nhưng được gửi khi buffer của server đầy hoặc khi kết thúc
+func (s *server) streamBatch(w http.ResponseWriter, r *http.Request, files []*uploadedFile, opts outputOptions) {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for _, file := range files {
+		// Client ngắt kết nối thì dừng luôn, không OCR các file còn lại
+		if r.Context().Err() != nil {
+			s.logger.Warning("[%s] Client disconnected, stopping batch stream", requestID(r.Context()))
+			return
+		}
+		if err := encoder.Encode(s.recognizeBatchFile(r, file, opts)); err != nil {
+			s.logger.Warning("[%s] Error writing batch stream: %v", requestID(r.Context()), err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// recognizeBatchFile OCR một file trong batch và áp dụng các tùy chọn output giống /ocr
+func (s *server) recognizeBatchFile(r *http.Request, file *uploadedFile, opts outputOptions) batchResult {
+	result := batchResult{Filename: file.filename}
+
+	upload, err := s.prepareUpload(r, file)
+	if err != nil {
+		result.fail(err)
+		return result
+	}
+	defer upload.remove()
+
+	// PDF và ảnh nhiều frame cho kết quả theo từng trang nên không vừa với batchResult
+	if err := checkSinglePage(upload, "batch requests"); err != nil {
+		result.fail(err)
+		return result
+	}
+
+	ocr, _, err := s.recognize(r.Context(), upload)
+	if err != nil {
+		s.logger.Error("[%s] OCR failed for %s: %v", requestID(r.Context()), file.filename, err)
+		result.fail(err)
+		return result
+	}
+	ocr = filterByConfidence(ocr, opts.minConfidence)
+
+	if opts.normalizedCoords {
+		width, height := processedDimensions(upload.width, upload.height, upload.maxWidth, upload.maxHeight)
+		if width == 0 || height == 0 {
+			result.fail(&requestError{http.StatusUnprocessableEntity, "Cannot normalize coordinates: unknown image dimensions"})
+			return result
+		}
+		ocr = normalizeCoords(ocr, width, height)
+	} else if opts.originalCoords {
+		width, height := processedDimensions(upload.width, upload.height, upload.maxWidth, upload.maxHeight)
+		if width == 0 || height == 0 {
+			result.fail(&requestError{http.StatusUnprocessableEntity, "Cannot scale coordinates: unknown image dimensions"})
+			return result
+		}
+		ocr = toOriginalCoords(ocr, upload, width, height)
+	}
+
+	result.Results, result.Truncated = limitResults(ocr, opts.limit, opts.limitBy)
+	if opts.stats {
+		result.Stats = computeConfidenceStats(result.Results)
+	}
+	return result
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+)
+
+// newBatchRequest tạo request multipart với nhiều file cùng trường "image"
+func newBatchRequest(t testing.TB, files map[string][]byte, order []string, fields map[string]string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, name := range order {
+		part, err := writer.CreateFormFile("image", name)
+		if err != nil {
+			t.Fatalf("Failed to create form file: %v", err)
+		}
+		part.Write(files[name])
+	}
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/ocr/batch", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+// serveBatch gửi request tới handleOCRBatch và trả về response đã ghi lại
+func serveBatch(srv *server, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	srv.handleOCRBatch(rec, req)
+	return rec
+}
+
+func TestHandleOCRBatch(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	files := map[string][]byte{
+		"first.png":  encodePNG(t, 30, 20),
+		"crash.png":  encodePNG(t, 40, 20),
+		"second.png": encodePNG(t, 50, 20),
+	}
+	req := newBatchRequest(t, files, []string{"first.png", "crash.png", "second.png"}, map[string]string{"lang": "en"})
+
+	rec := serveBatch(srv, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var results []batchResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Cannot decode response: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Results = %+v, want 3", results)
+	}
+
+	// Script giả lập trả về tên file tạm làm text, mỗi file có kết quả riêng
+	for _, i := range []int{0, 2} {
+		if results[i].Error != "" || len(results[i].Results) != 1 {
+			t.Errorf("Result %d = %+v, want one OCR result", i, results[i])
+		}
+	}
+	if results[0].Filename != "first.png" || results[2].Filename != "second.png" || results[0].Results[0].Text == results[2].Results[0].Text {
+		t.Errorf("Results = %+v, want independent results for first.png and second.png", results)
+	}
+
+	// File làm script lỗi không làm hỏng cả batch
+	if results[1].Filename != "crash.png" || results[1].Error == "" || results[1].Code != "ocr_failed" || results[1].Results != nil {
+		t.Errorf("Result for crash.png = %+v, want an error", results[1])
+	}
+
+	if calls := readCalls(t, script); len(calls) != 3 || calls[0].Lang != "en" {
+		t.Errorf("Script calls = %+v, want 3 calls with lang en", calls)
+	}
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after the batch", len(entries))
+	}
+}
+
+func TestHandleOCRBatchSameFilename(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	// Hai file trùng tên không được ghi đè lên nhau trong thư mục tạm
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, width := range []int{30, 40} {
+		part, _ := writer.CreateFormFile("image", "scan.png")
+		part.Write(encodePNG(t, width, 20))
+	}
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/ocr/batch", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	rec := serveBatch(srv, req)
+	var results []batchResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Cannot decode response %q: %v", rec.Body.String(), err)
+	}
+	if len(results) != 2 || results[0].Error != "" || results[1].Error != "" || results[0].Results[0].Text == results[1].Results[0].Text {
+		t.Errorf("Results = %+v, want two independent results", results)
+	}
+}
+
+func TestHandleOCRBatchRejectsPagedFiles(t *testing.T) {
+	pdf, err := os.ReadFile("testdata/two_pages.pdf")
+	if err != nil {
+		t.Fatalf("Failed to read PDF fixture: %v", err)
+	}
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	files := map[string][]byte{
+		"scan.tiff":    encodeTIFFDirectories(2),
+		"document.pdf": pdf,
+		"image.png":    encodePNG(t, 30, 20),
+	}
+	rec := serveBatch(srv, newBatchRequest(t, files, []string{"scan.tiff", "document.pdf", "image.png"}, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var results []batchResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || len(results) != 3 {
+		t.Fatalf("Response = %s, want 3 results", rec.Body.String())
+	}
+	// Ảnh nhiều frame và PDF bị từ chối riêng từng file thay vì bị OCR như một ảnh
+	for _, result := range results[:2] {
+		if result.Error == "" || result.Code != "unsupported_media_type" || result.Results != nil {
+			t.Errorf("Result for %s = %+v, want an unsupported_media_type error", result.Filename, result)
+		}
+	}
+	if results[2].Error != "" || len(results[2].Results) != 1 {
+		t.Errorf("Result for image.png = %+v, want the OCR result", results[2])
+	}
+	if calls := readCalls(t, script); len(calls) != 1 {
+		t.Errorf("Script ran %d times, want only for the single-frame image", len(calls))
+	}
+}
+
+func TestHandleOCRBatchValidation(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	tooMany := make(map[string][]byte)
+	var order []string
+	for i := 0; i <= maxBatchFiles; i++ {
+		name := string(rune('a'+i%26)) + string(rune('a'+i/26)) + ".png"
+		tooMany[name] = []byte("image")
+		order = append(order, name)
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+	}{
+		{"no files", newBatchRequest(t, nil, nil, map[string]string{"lang": "en"})},
+		{"too many files", newBatchRequest(t, tooMany, order, nil)},
+		{"invalid stream", newBatchRequest(t, map[string][]byte{"a.png": []byte("image")}, []string{"a.png"}, map[string]string{"stream": "yes"})},
+		{"unsupported language", newBatchRequest(t, map[string][]byte{"a.png": []byte("image")}, []string{"a.png"}, map[string]string{"lang": "xx"})},
+		{"output text", newBatchRequest(t, map[string][]byte{"a.png": []byte("image")}, []string{"a.png"}, map[string]string{"output": "text"})},
+		{"format", newBatchRequest(t, map[string][]byte{"a.png": []byte("image")}, []string{"a.png"}, map[string]string{"format": "hocr"})},
+		{"group lines", newBatchRequest(t, map[string][]byte{"a.png": []byte("image")}, []string{"a.png"}, map[string]string{"group": "lines"})},
+		{"group paragraphs", newBatchRequest(t, map[string][]byte{"a.png": []byte("image")}, []string{"a.png"}, map[string]string{"group": "paragraphs"})},
+	}
+
+	for _, tt := range tests {
+		if rec := serveBatch(srv, tt.req); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tt.name, rec.Code)
+		}
+	}
+
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after rejected batches", len(entries))
+	}
+}
+
+func TestHandleOCRBatchStream(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+	ts := httptest.NewServer(srv.routes())
+	defer ts.Close()
+
+	files := map[string][]byte{
+		"first.png":  encodePNG(t, 30, 20),
+		"crash.png":  encodePNG(t, 40, 20),
+		"second.png": encodePNG(t, 50, 20),
+	}
+	order := []string{"first.png", "crash.png", "second.png"}
+	req := newBatchRequest(t, files, order, map[string]string{"stream": "true"})
+	req.RequestURI = ""
+	req.URL, _ = url.Parse(ts.URL + "/ocr/batch")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != ndjsonContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ndjsonContentType)
+	}
+
+	// Mỗi file là một dòng JSON riêng, theo đúng thứ tự upload
+	scanner := bufio.NewScanner(resp.Body)
+	var lines int
+	for ; scanner.Scan(); lines++ {
+		var result batchResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("Line %d %q is not a JSON object: %v", lines, scanner.Text(), err)
+		}
+		if lines < len(order) && result.Filename != order[lines] {
+			t.Errorf("Line %d filename = %q, want %q", lines, result.Filename, order[lines])
+		}
+		if (result.Filename == "crash.png") != (result.Error != "") {
+			t.Errorf("Line %d = %+v", lines, result)
+		}
+	}
+	if lines != len(order) {
+		t.Errorf("Stream has %d lines, want %d", lines, len(order))
+	}
+}
+
+func TestHandleOCRBatchStreamFlushes(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	// Response được flush qua các middleware, kể cả khi client chấp nhận gzip
+	for _, acceptEncoding := range []string{"", "gzip"} {
+		req := newBatchRequest(t, map[string][]byte{"a.png": encodePNG(t, 20, 20)}, []string{"a.png"}, nil)
+		req.Header.Set("Accept", ndjsonContentType)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+
+		if !rec.Flushed {
+			t.Errorf("Accept-Encoding %q: response was not flushed", acceptEncoding)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != ndjsonContentType {
+			t.Errorf("Accept-Encoding %q: Content-Type = %q", acceptEncoding, ct)
+		}
+	}
+}
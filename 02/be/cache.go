@@ -0,0 +1,90 @@
+package main
+
+import (
+	"container/list"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// cacheEntry là một kết quả OCR được lưu trong cache
+type cacheEntry struct {
+	key     string
+	results []OCRResult
+	expires time.Time
+}
+
+// resultCache là cache LRU có TTL cho kết quả OCR, an toàn khi dùng đồng thời
+type resultCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+// newResultCache tạo cache chứa tối đa size phần tử, mỗi phần tử sống trong ttl (0 = không hết hạn)
+func newResultCache(size int, ttl time.Duration) *resultCache {
+	return &resultCache{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// cacheKey tạo key từ hash nội dung ảnh, kích thước xử lý và ngôn ngữ
+func cacheKey(hash []byte, maxWidth, maxHeight int, lang string) string {
+	return fmt.Sprintf("%s:%dx%d:%s", hex.EncodeToString(hash), maxWidth, maxHeight, lang)
+}
+
+// Get trả về kết quả đã lưu nếu còn hạn
+func (c *resultCache) Get(key string) ([]OCRResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if c.ttl > 0 && c.now().After(entry.expires) {
+		c.removeElement(elem)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry.results, true
+}
+
+// Add lưu kết quả vào cache, loại bỏ phần tử ít được dùng nhất khi đầy
+func (c *resultCache) Add(key string, results []OCRResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.results = results
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, results: results, expires: expires})
+
+	for c.order.Len() > c.size {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// removeElement xóa một phần tử khỏi cache, caller phải giữ mutex
+func (c *resultCache) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*cacheEntry).key)
+}
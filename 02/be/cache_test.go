@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResultCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newResultCache(2, 0)
+
+	cache.Add("a", []OCRResult{{Text: "a"}})
+	cache.Add("b", []OCRResult{{Text: "b"}})
+
+	// Truy cập "a" để "b" trở thành phần tử ít được dùng nhất
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("Expected cache hit for a")
+	}
+	cache.Add("c", []OCRResult{{Text: "c"}})
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if results, ok := cache.Get(key); !ok || results[0].Text != key {
+			t.Errorf("Expected cache hit for %s, got %v %v", key, results, ok)
+		}
+	}
+}
+
+func TestResultCacheExpiresEntries(t *testing.T) {
+	now := time.Now()
+	cache := newResultCache(10, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Add("a", []OCRResult{{Text: "a"}})
+
+	now = now.Add(30 * time.Second)
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("Expected cache hit before TTL")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Expected cache miss after TTL")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strings"
+)
+
+// gzipMinSize là kích thước body tối thiểu (byte) để nén, body nhỏ hơn nén không có lợi
+const gzipMinSize = 1024
+
+// acceptsGzip cho biết client chấp nhận response nén gzip qua header Accept-Encoding
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter giữ lại phần đầu body tới khi đủ gzipMinSize mới quyết định có nén hay không
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status int
+	buf    []byte
+	gz     *gzip.Writer
+	// decided là true khi header đã được gửi, sau đó body được ghi thẳng qua gz hoặc ResponseWriter
+	decided bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.decided {
+		if w.gz != nil {
+			return w.gz.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= gzipMinSize {
+		if err := w.start(compressible(w.Header())); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// start gửi header và phần body đã giữ lại, nén nếu compress là true
+func (w *gzipResponseWriter) start(compress bool) error {
+	w.decided = true
+	if compress {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if w.gz != nil {
+		_, err := w.gz.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush gửi ngay phần body đã ghi, body chưa đủ gzipMinSize thì quyết định nén theo Content-Type
+// vì response dạng stream không biết trước kích thước
+func (w *gzipResponseWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		if err := w.start(compressible(w.Header())); err != nil {
+			return
+		}
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish gửi phần còn lại sau khi handler trả về, body nhỏ được gửi nguyên vẹn
+func (w *gzipResponseWriter) finish() {
+	if !w.decided {
+		if w.status == 0 {
+			return
+		}
+		w.start(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
+
+// compressible cho biết response có nên nén không: ảnh, PDF và body đã được encode sẵn thì bỏ qua
+func compressible(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	return !strings.HasPrefix(contentType, "image/") && contentType != "application/pdf"
+}
+
+// Middleware nén response bằng gzip khi client gửi "Accept-Encoding: gzip" và body đủ lớn
+// Chỉ bọc response nên không ảnh hưởng việc đọc body multipart của request upload
+func gzipMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.finish()
+		next(gw, r)
+	}
+}
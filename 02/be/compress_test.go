@@ -0,0 +1,82 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// denseOCRScript giả lập tài liệu dày chữ với 200 box
+const denseOCRScript = `
+import json
+print(json.dumps([
+    {"coords": [[0, i * 10], [100, i * 10], [100, i * 10 + 8], [0, i * 10 + 8]], "text": "line %d" % i, "confidence": 0.9}
+    for i in range(200)
+]))
+`
+
+// serveRoutes gửi request upload tới /ocr qua đầy đủ middleware của server
+func serveRoutes(t *testing.T, srv *server, acceptEncoding string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil)
+	req.URL.Path = "/ocr"
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestGzipLargeResponses(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, denseOCRScript), 0)
+
+	rec := serveRoutes(t, srv, "deflate, gzip;q=0.8")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Response is not gzip-encoded: %v", err)
+	}
+	var results []OCRResult
+	if err := json.NewDecoder(gz).Decode(&results); err != nil {
+		t.Fatalf("Cannot decode decompressed body: %v", err)
+	}
+	if len(results) != 200 {
+		t.Errorf("Results = %d, want 200", len(results))
+	}
+
+	// Client không chấp nhận gzip nhận body không nén
+	for _, acceptEncoding := range []string{"", "gzip;q=0"} {
+		rec = serveRoutes(t, srv, acceptEncoding)
+		if got := rec.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("Accept-Encoding %q: Content-Encoding = %q, want none", acceptEncoding, got)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || len(results) != 200 {
+			t.Errorf("Accept-Encoding %q: cannot decode body: %v", acceptEncoding, err)
+		}
+	}
+}
+
+func TestGzipSkipsSmallResponses(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	rec := serveRoutes(t, srv, "gzip")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q, want none for a small body", got)
+	}
+	var results []OCRResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || len(results) != 1 {
+		t.Errorf("Body = %s, want one result", rec.Body.String())
+	}
+}
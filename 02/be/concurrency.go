@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// errOCRBusy được trả về khi đã có quá nhiều lần OCR đang chạy và chờ, hoặc chờ quá lâu
+var errOCRBusy = errors.New("OCR server is busy")
+
+// concurrencyLimiter giới hạn số lần OCR chạy đồng thời, các lần khác xếp hàng chờ có giới hạn
+type concurrencyLimiter struct {
+	// slots có dung lượng bằng số lần OCR được chạy cùng lúc
+	slots chan struct{}
+	// queue có dung lượng bằng số lần OCR được phép chờ
+	queue chan struct{}
+	wait  time.Duration
+}
+
+// newConcurrencyLimiter tạo limiter cho phép max lần OCR cùng lúc, tối đa queueSize lần chờ mỗi lần không quá wait
+func newConcurrencyLimiter(max, queueSize int, wait time.Duration) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		slots: make(chan struct{}, max),
+		queue: make(chan struct{}, queueSize),
+		wait:  wait,
+	}
+}
+
+// acquire lấy một slot, trả về errOCRBusy nếu hàng chờ đã đầy hoặc chờ quá thời gian
+// và ctx.Err() nếu ctx bị hủy trong lúc chờ
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	// Còn slot trống thì chạy ngay, không cần xếp hàng
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	select {
+	case l.queue <- struct{}{}:
+	default:
+		return errOCRBusy
+	}
+	defer func() { <-l.queue }()
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return errOCRBusy
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// running trả về số lần OCR đang giữ slot
+func (l *concurrencyLimiter) running() int {
+	return len(l.slots)
+}
+
+// queued trả về số lần OCR đang chờ slot
+func (l *concurrencyLimiter) queued() int {
+	return len(l.queue)
+}
+
+// release trả slot đã lấy bằng acquire
+func (l *concurrencyLimiter) release() {
+	<-l.slots
+}
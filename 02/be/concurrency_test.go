@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingOCRScript giả lập ocr.py chạy lâu, ghi số tiến trình đang chạy cùng lúc vào file live_counts
+const countingOCRScript = `
+import sys, os, time, json
+
+stub_dir = os.path.dirname(os.path.abspath(__file__))
+live_dir = os.path.join(stub_dir, "live")
+os.makedirs(live_dir, exist_ok=True)
+
+marker = os.path.join(live_dir, str(os.getpid()))
+open(marker, "w").close()
+with open(os.path.join(stub_dir, "live_counts"), "a") as f:
+    f.write("%d\n" % len(os.listdir(live_dir)))
+time.sleep(float(os.environ.get("STUB_RUN_SECONDS", "0.3")))
+os.remove(marker)
+
+print(json.dumps([{"coords": [[0, 0], [10, 0], [10, 10], [0, 10]], "text": "ok", "confidence": 0.9}]))
+`
+
+// newLimitedServer tạo server chạy script mỗi request với giới hạn số lần OCR đồng thời
+func newLimitedServer(t *testing.T, scriptPath string, maxConcurrency, maxQueue int, queueTimeout time.Duration) *server {
+	t.Helper()
+	cfg := defaultConfig()
+	cfg.TempDir = t.TempDir()
+	cfg.ScriptPath = scriptPath
+	cfg.Workers = 0
+	cfg.CacheSize = 0
+	cfg.MaxConcurrency = maxConcurrency
+	cfg.MaxQueue = maxQueue
+	cfg.QueueTimeout = queueTimeout
+
+	srv, err := newServer(cfg, newTestLogger(t))
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// serveConcurrently gửi n request upload cùng lúc và trả về status code của từng request
+func serveConcurrently(t *testing.T, srv *server, n int) []int {
+	t.Helper()
+
+	codes := make([]int, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		req := newUploadRequest(t, "image.png", encodePNG(t, 20+i, 20), nil)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = serveOCR(srv, req).Code
+		}()
+	}
+	wg.Wait()
+	return codes
+}
+
+func TestMaxConcurrency(t *testing.T) {
+	script := writeStubScript(t, countingOCRScript)
+	srv := newLimitedServer(t, script, 2, 10, 30*time.Second)
+
+	codes := serveConcurrently(t, srv, 6)
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("Request %d: status = %d, want 200", i, code)
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(script), "live_counts"))
+	if err != nil {
+		t.Fatalf("Failed to read live counts: %v", err)
+	}
+	counts := strings.Fields(string(content))
+	if len(counts) != 6 {
+		t.Fatalf("Script ran %d times, want 6", len(counts))
+	}
+	for _, count := range counts {
+		if n, _ := strconv.Atoi(count); n > 2 {
+			t.Errorf("%d OCR processes ran at the same time, want at most 2", n)
+		}
+	}
+}
+
+func TestMaxConcurrencyQueueFull(t *testing.T) {
+	srv := newLimitedServer(t, writeStubScript(t, countingOCRScript), 1, 1, 30*time.Second)
+
+	// Một request chạy, một request chờ, các request còn lại bị từ chối ngay
+	codes := serveConcurrently(t, srv, 4)
+	ok, busy := 0, 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusOK:
+			ok++
+		case http.StatusServiceUnavailable:
+			busy++
+		}
+	}
+	if ok < 2 || busy < 1 || ok+busy != 4 {
+		t.Errorf("Statuses = %v, want at least 2 OK and the rest 503", codes)
+	}
+}
+
+func TestMaxConcurrencyQueueTimeout(t *testing.T) {
+	t.Setenv("STUB_RUN_SECONDS", "1")
+	srv := newLimitedServer(t, writeStubScript(t, countingOCRScript), 1, 10, 100*time.Millisecond)
+
+	codes := serveConcurrently(t, srv, 2)
+	if !(codes[0] == http.StatusOK && codes[1] == http.StatusServiceUnavailable) && !(codes[1] == http.StatusOK && codes[0] == http.StatusServiceUnavailable) {
+		t.Errorf("Statuses = %v, want one OK and one 503 after waiting too long", codes)
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l := newConcurrencyLimiter(1, 0, time.Second)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire() with a free slot error = %v", err)
+	}
+	if err := l.acquire(context.Background()); err != errOCRBusy {
+		t.Errorf("acquire() without queue error = %v, want errOCRBusy", err)
+	}
+	l.release()
+	if err := l.acquire(context.Background()); err != nil {
+		t.Errorf("acquire() after release error = %v", err)
+	}
+}
+
+func TestConcurrencyLimiterCanceledWhileQueued(t *testing.T) {
+	l := newConcurrencyLimiter(1, 1, 30*time.Second)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire() with a free slot error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if err := l.acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("acquire() canceled while queued error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("acquire() returned after %v, want soon after the cancel", elapsed)
+	}
+	if l.running() != 1 || l.queued() != 0 {
+		t.Errorf("running = %d, queued = %d after the cancel, want 1 and 0", l.running(), l.queued())
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config chứa cấu hình của OCR server
+type Config struct {
+	// Port là cổng HTTP server lắng nghe
+	Port int
+	// TempDir là thư mục lưu ảnh upload trong lúc xử lý
+	TempDir string
+	// TempMaxAge là tuổi tối thiểu để file upload còn sót trong TempDir bị xóa khi dọn dẹp
+	TempMaxAge time.Duration
+	// TempSweepInterval là chu kỳ dọn file upload cũ trong TempDir, 0 nghĩa là chỉ dọn khi khởi động
+	TempSweepInterval time.Duration
+	// ScriptPath là đường dẫn tới script OCR
+	ScriptPath string
+	// Python là trình thông dịch chạy script OCR, ví dụ python3 hay đường dẫn trong virtualenv
+	Python string
+	// PythonArgs là các tham số thêm cho trình thông dịch, đặt trước đường dẫn script (ví dụ -u)
+	PythonArgs []string
+	// SelfCheck chạy "python <script> --selfcheck" khi khởi động để phát hiện môi trường Python bị hỏng
+	SelfCheck bool
+	// RequireSelfCheck dừng server ngay nếu self-check thất bại thay vì chỉ ghi log và báo qua /ready
+	RequireSelfCheck bool
+	// ResultsDir là thư mục lưu mỗi kết quả OCR thành file JSON để xem lại qua /results/{id}, rỗng nghĩa là không lưu
+	// Kết quả theo trang của PDF và ảnh nhiều frame không được lưu
+	ResultsDir string
+	// Workers là số tiến trình Python chạy thường trực, 0 nghĩa là chạy script mới cho mỗi request
+	Workers int
+	// CacheSize là số kết quả OCR tối đa được cache, 0 nghĩa là tắt cache
+	CacheSize int
+	// CacheTTL là thời gian sống của một kết quả trong cache
+	CacheTTL time.Duration
+	// APIKeys là danh sách API key hợp lệ, rỗng nghĩa là không yêu cầu xác thực
+	APIKeys []string
+	// CORSOrigins là danh sách origin được phép gọi API từ trình duyệt, rỗng nghĩa là cho phép mọi origin ("*")
+	CORSOrigins []string
+	// RateLimit là số request/giây cho phép mỗi IP, 0 nghĩa là không giới hạn
+	RateLimit float64
+	// RateBurst là số request tối đa một IP được gửi dồn dập
+	RateBurst int
+	// TrustProxy cho phép lấy IP client từ X-Forwarded-For khi chạy sau reverse proxy
+	TrustProxy bool
+	// PDFTool là công cụ render trang PDF thành ảnh, dùng cú pháp tham số của pdftoppm
+	PDFTool string
+	// MaxPDFPages là số trang PDF tối đa được xử lý trong một request
+	MaxPDFPages int
+	// MaxFrames là số frame tối đa của ảnh TIFF nhiều trang hay GIF động được xử lý trong một request
+	MaxFrames int
+	// ImageConverter là công cụ chuyển WebP/TIFF/HEIC/AVIF sang PNG, gọi dạng "<tool> <input> <output.png>",
+	// với TIFF nhiều trang output chứa mẫu "%03d" để ghi mỗi frame ra một file
+	ImageConverter string
+	// OCRTimeout là thời gian tối đa cho một lần chạy OCR, quá thời gian thì tiến trình Python bị kill
+	OCRTimeout time.Duration
+	// OCRRetries là số lần chạy lại OCR khi gặp lỗi tạm thời như thiếu bộ nhớ
+	OCRRetries int
+	// Debug cho phép request gửi debug=true nhận stdout/stderr thô của script OCR, chỉ dùng khi phát triển
+	Debug bool
+	// MaxConcurrency là số lần OCR được chạy đồng thời, 0 nghĩa là không giới hạn
+	MaxConcurrency int
+	// MaxQueue là số lần OCR được xếp hàng chờ khi đã đủ MaxConcurrency, vượt quá thì trả về 503
+	MaxQueue int
+	// QueueTimeout là thời gian chờ tối đa trong hàng, quá thời gian thì trả về 503
+	QueueTimeout time.Duration
+	// MaxPendingJobs là số job bất đồng bộ chưa xong tối đa, vượt quá thì /ocr/jobs trả về 503, 0 nghĩa là không giới hạn
+	MaxPendingJobs int
+	// MaxUploadSize là kích thước tối đa (byte) của body request upload và ảnh tải từ image_url
+	MaxUploadSize int64
+	// JobTTL là thời gian giữ kết quả của job bất đồng bộ đã xong, 0 nghĩa là giữ mãi mãi
+	JobTTL time.Duration
+	// WebhookSecret là khóa ký HMAC-SHA256 cho callback của job bất đồng bộ, rỗng nghĩa là không ký
+	WebhookSecret string
+	// WebhookRetries là số lần gửi lại callback khi receiver lỗi hoặc không kết nối được
+	WebhookRetries int
+	// WebhookTimeout là thời gian tối đa cho một lần gửi callback
+	WebhookTimeout time.Duration
+	// ShutdownTimeout là thời gian tối đa chờ các request đang chạy xong khi tắt server
+	ShutdownTimeout time.Duration
+	// FetchTimeout là thời gian tối đa để tải ảnh từ image_url
+	FetchTimeout time.Duration
+	// FetchAllowedHosts là danh sách host được tải ảnh qua image_url, rỗng nghĩa là mọi host http(s) không phải địa chỉ nội bộ
+	// Host trong danh sách được tải cả khi trỏ tới loopback, mạng riêng hay link-local
+	FetchAllowedHosts []string
+	// CallbackAllowedHosts là danh sách host được nhận callback dù trỏ tới địa chỉ nội bộ (loopback, mạng riêng, link-local)
+	CallbackAllowedHosts []string
+}
+
+// defaultConfig trả về cấu hình mặc định
+func defaultConfig() Config {
+	return Config{
+		Port:              8080,
+		TempDir:           "./temp",
+		TempMaxAge:        time.Hour,
+		TempSweepInterval: 10 * time.Minute,
+		ScriptPath:        "ocr.py",
+		Python:            "python",
+		SelfCheck:         true,
+		Workers:           2,
+		CacheSize:         128,
+		CacheTTL:          10 * time.Minute,
+		RateLimit:         0,
+		RateBurst:         5,
+		PDFTool:           "pdftoppm",
+		MaxPDFPages:       20,
+		MaxFrames:         20,
+		ImageConverter:    "convert",
+		OCRTimeout:        30 * time.Second,
+		OCRRetries:        2,
+		MaxQueue:          64,
+		QueueTimeout:      30 * time.Second,
+		MaxPendingJobs:    256,
+		MaxUploadSize:     defaultMaxUploadSize,
+		FetchTimeout:      10 * time.Second,
+		ShutdownTimeout:   30 * time.Second,
+		JobTTL:            time.Hour,
+		WebhookRetries:    3,
+		WebhookTimeout:    10 * time.Second,
+	}
+}
+
+// parseConfig đọc cấu hình từ tham số dòng lệnh
+func parseConfig(args []string) (Config, error) {
+	cfg := defaultConfig()
+
+	port, err := envIntOrDefault("OCR_PORT", cfg.Port)
+	if err != nil {
+		return Config{}, err
+	}
+
+	fs := flag.NewFlagSet("ocr-server", flag.ContinueOnError)
+	fs.IntVar(&cfg.Port, "port", port, "HTTP port to listen on (env OCR_PORT)")
+	fs.StringVar(&cfg.TempDir, "temp-dir", envOrDefault("OCR_TEMP_DIR", cfg.TempDir), "directory for uploaded images while they are processed (env OCR_TEMP_DIR)")
+	fs.DurationVar(&cfg.TempMaxAge, "temp-max-age", cfg.TempMaxAge, "age after which leftover uploads in the temp directory are deleted")
+	fs.DurationVar(&cfg.TempSweepInterval, "temp-sweep-interval", cfg.TempSweepInterval, "how often leftover uploads are deleted from the temp directory (0 = only on startup)")
+	fs.StringVar(&cfg.ScriptPath, "script-path", envOrDefault("OCR_SCRIPT_PATH", cfg.ScriptPath), "path to the Python OCR script (env OCR_SCRIPT_PATH)")
+	fs.StringVar(&cfg.Python, "python", envOrDefault("OCR_PYTHON", cfg.Python), "Python interpreter used to run the OCR script (env OCR_PYTHON)")
+	pythonArgs := fs.String("python-args", os.Getenv("OCR_PYTHON_ARGS"), "space-separated interpreter arguments placed before the script path, e.g. -u (env OCR_PYTHON_ARGS)")
+	fs.BoolVar(&cfg.SelfCheck, "self-check", cfg.SelfCheck, "check the Python environment with <script> --selfcheck on startup")
+	fs.BoolVar(&cfg.RequireSelfCheck, "require-self-check", cfg.RequireSelfCheck, "refuse to start when the startup self-check fails")
+	fs.StringVar(&cfg.ResultsDir, "results-dir", os.Getenv("OCR_RESULTS_DIR"), "directory where every single-image OCR result is stored as JSON for GET /results/{id}, PDF and multi-frame results are not stored (env OCR_RESULTS_DIR, empty = do not store)")
+	fs.IntVar(&cfg.Workers, "workers", cfg.Workers, "number of persistent Python OCR workers (0 = spawn the script per request)")
+	fs.IntVar(&cfg.CacheSize, "cache-size", cfg.CacheSize, "maximum number of cached OCR results (0 = disable cache)")
+	fs.DurationVar(&cfg.CacheTTL, "cache-ttl", cfg.CacheTTL, "how long a cached OCR result stays valid")
+	fs.Float64Var(&cfg.RateLimit, "rate-limit", cfg.RateLimit, "requests per second allowed per client IP (0 = unlimited)")
+	fs.IntVar(&cfg.RateBurst, "rate-burst", cfg.RateBurst, "maximum burst of requests per client IP")
+	fs.BoolVar(&cfg.TrustProxy, "trust-proxy", cfg.TrustProxy, "use the last X-Forwarded-For entry, added by the proxy, to identify clients when running behind a proxy")
+	fs.StringVar(&cfg.PDFTool, "pdf-tool", cfg.PDFTool, "pdftoppm-compatible tool used to rasterize PDF pages")
+	fs.IntVar(&cfg.MaxPDFPages, "max-pdf-pages", cfg.MaxPDFPages, "maximum number of PDF pages processed per request")
+	fs.IntVar(&cfg.MaxFrames, "max-frames", cfg.MaxFrames, "maximum number of frames of a multi-page TIFF or animated GIF processed per request")
+	fs.StringVar(&cfg.ImageConverter, "image-converter", cfg.ImageConverter, "tool used to convert WebP/TIFF/HEIC/AVIF uploads to PNG, invoked as <tool> <input> <output.png> (multi-page TIFF output contains a %03d frame pattern)")
+	fs.DurationVar(&cfg.OCRTimeout, "ocr-timeout", cfg.OCRTimeout, "maximum time for one OCR run before the Python process is killed")
+	fs.IntVar(&cfg.OCRRetries, "ocr-retries", cfg.OCRRetries, "number of retries for OCR runs that fail with a transient error such as out of memory")
+	fs.BoolVar(&cfg.Debug, "debug", cfg.Debug, "let requests with debug=true receive the raw OCR script output (do not enable in production)")
+	fs.IntVar(&cfg.MaxConcurrency, "max-concurrency", cfg.MaxConcurrency, "maximum number of OCR runs at the same time (0 = unlimited)")
+	fs.IntVar(&cfg.MaxQueue, "max-queue", cfg.MaxQueue, "maximum number of OCR runs waiting for -max-concurrency before requests get 503")
+	fs.DurationVar(&cfg.QueueTimeout, "queue-timeout", cfg.QueueTimeout, "maximum time an OCR run waits for -max-concurrency before the request gets 503")
+	fs.IntVar(&cfg.MaxPendingJobs, "max-pending-jobs", cfg.MaxPendingJobs, "maximum number of async jobs pending or running before new jobs get 503 (0 = unlimited)")
+	fs.Int64Var(&cfg.MaxUploadSize, "max-upload-size", cfg.MaxUploadSize, "maximum size in bytes of an upload request body or an image fetched from image_url")
+	fs.DurationVar(&cfg.JobTTL, "job-ttl", cfg.JobTTL, "how long results of finished async jobs are kept (0 = forever)")
+	fs.StringVar(&cfg.WebhookSecret, "webhook-secret", os.Getenv("OCR_WEBHOOK_SECRET"), "key used to sign async job callbacks with HMAC-SHA256 in X-OCR-Signature (env OCR_WEBHOOK_SECRET, empty = unsigned)")
+	fs.IntVar(&cfg.WebhookRetries, "webhook-retries", cfg.WebhookRetries, "number of retries when delivering an async job callback fails")
+	fs.DurationVar(&cfg.WebhookTimeout, "webhook-timeout", cfg.WebhookTimeout, "maximum time for one async job callback delivery")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "maximum time to wait for in-flight requests on SIGINT/SIGTERM")
+	fs.DurationVar(&cfg.FetchTimeout, "fetch-timeout", cfg.FetchTimeout, "maximum time to download an image given by image_url")
+	fetchHosts := fs.String("fetch-allowed-hosts", os.Getenv("OCR_FETCH_ALLOWED_HOSTS"), "comma-separated list of hosts image_url may point to (env OCR_FETCH_ALLOWED_HOSTS, empty = any http(s) host outside loopback, private and link-local networks)")
+	apiKeys := fs.String("api-keys", os.Getenv("OCR_API_KEYS"), "comma-separated list of accepted API keys (env OCR_API_KEYS, empty = no auth)")
+	apiToken := fs.String("api-token", os.Getenv("OCR_API_TOKEN"), "single accepted bearer token, added to -api-keys (env OCR_API_TOKEN)")
+	callbackHosts := fs.String("callback-allowed-hosts", os.Getenv("OCR_CALLBACK_ALLOWED_HOSTS"), "comma-separated list of callback_url hosts allowed to resolve to loopback, private or link-local addresses (env OCR_CALLBACK_ALLOWED_HOSTS)")
+	corsOrigins := fs.String("cors-origins", os.Getenv("OCR_CORS_ORIGINS"), "comma-separated list of origins allowed to call the API from a browser (env OCR_CORS_ORIGINS, empty = allow any origin)")
+
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	cfg.PythonArgs = strings.Fields(*pythonArgs)
+	cfg.APIKeys = splitList(*apiKeys)
+	if token := strings.TrimSpace(*apiToken); token != "" {
+		cfg.APIKeys = append(cfg.APIKeys, token)
+	}
+	cfg.FetchAllowedHosts = splitList(*fetchHosts)
+	cfg.CallbackAllowedHosts = splitList(*callbackHosts)
+
+	// Origin không có dấu "/" ở cuối, bỏ đi để so khớp với header Origin của trình duyệt
+	for _, origin := range splitList(*corsOrigins) {
+		if origin == "*" {
+			return Config{}, fmt.Errorf("invalid -cors-origins value: leave it empty to allow any origin")
+		}
+		cfg.CORSOrigins = append(cfg.CORSOrigins, strings.TrimSuffix(origin, "/"))
+	}
+
+	if cfg.TempMaxAge <= 0 || cfg.TempSweepInterval < 0 {
+		return Config{}, fmt.Errorf("invalid temp cleanup: -temp-max-age %v -temp-sweep-interval %v", cfg.TempMaxAge, cfg.TempSweepInterval)
+	}
+
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return Config{}, fmt.Errorf("invalid -port value: %d", cfg.Port)
+	}
+
+	if cfg.Python == "" {
+		return Config{}, fmt.Errorf("invalid -python value: the interpreter must not be empty")
+	}
+
+	if cfg.Workers < 0 {
+		return Config{}, fmt.Errorf("invalid -workers value: %d", cfg.Workers)
+	}
+
+	if cfg.RateLimit < 0 || cfg.RateBurst < 1 {
+		return Config{}, fmt.Errorf("invalid rate limit: -rate-limit %v -rate-burst %d", cfg.RateLimit, cfg.RateBurst)
+	}
+
+	if cfg.MaxPDFPages < 1 {
+		return Config{}, fmt.Errorf("invalid -max-pdf-pages value: %d", cfg.MaxPDFPages)
+	}
+
+	if cfg.MaxFrames < 1 {
+		return Config{}, fmt.Errorf("invalid -max-frames value: %d", cfg.MaxFrames)
+	}
+
+	if cfg.MaxConcurrency < 0 || cfg.MaxQueue < 0 || cfg.QueueTimeout <= 0 {
+		return Config{}, fmt.Errorf("invalid concurrency limit: -max-concurrency %d -max-queue %d -queue-timeout %v", cfg.MaxConcurrency, cfg.MaxQueue, cfg.QueueTimeout)
+	}
+
+	if cfg.MaxPendingJobs < 0 {
+		return Config{}, fmt.Errorf("invalid -max-pending-jobs value: %d", cfg.MaxPendingJobs)
+	}
+
+	if cfg.OCRRetries < 0 {
+		return Config{}, fmt.Errorf("invalid -ocr-retries value: %d", cfg.OCRRetries)
+	}
+
+	if cfg.OCRTimeout <= 0 {
+		return Config{}, fmt.Errorf("invalid -ocr-timeout value: %v", cfg.OCRTimeout)
+	}
+
+	if cfg.MaxUploadSize <= 0 {
+		return Config{}, fmt.Errorf("invalid -max-upload-size value: %d", cfg.MaxUploadSize)
+	}
+
+	if cfg.JobTTL < 0 {
+		return Config{}, fmt.Errorf("invalid -job-ttl value: %v", cfg.JobTTL)
+	}
+
+	if cfg.WebhookRetries < 0 || cfg.WebhookTimeout <= 0 {
+		return Config{}, fmt.Errorf("invalid webhook delivery: -webhook-retries %d -webhook-timeout %v", cfg.WebhookRetries, cfg.WebhookTimeout)
+	}
+
+	if cfg.ShutdownTimeout <= 0 {
+		return Config{}, fmt.Errorf("invalid -shutdown-timeout value: %v", cfg.ShutdownTimeout)
+	}
+
+	if cfg.FetchTimeout <= 0 {
+		return Config{}, fmt.Errorf("invalid -fetch-timeout value: %v", cfg.FetchTimeout)
+	}
+
+	if cfg.CacheSize < 0 {
+		return Config{}, fmt.Errorf("invalid -cache-size value: %d", cfg.CacheSize)
+	}
+
+	return cfg, nil
+}
+
+// pythonCommand tạo lệnh chạy script OCR bằng trình thông dịch đã cấu hình,
+// thứ tự tham số là: PythonArgs, đường dẫn script rồi tới scriptArgs
+func (cfg Config) pythonCommand(ctx context.Context, scriptArgs ...string) *exec.Cmd {
+	args := append(slices.Clone(cfg.PythonArgs), cfg.ScriptPath)
+	return exec.CommandContext(ctx, cfg.Python, append(args, scriptArgs...)...)
+}
+
+// envOrDefault trả về giá trị biến môi trường hoặc giá trị mặc định nếu biến không được đặt
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envIntOrDefault trả về giá trị số nguyên của biến môi trường hoặc giá trị mặc định nếu biến không được đặt
+func envIntOrDefault(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q: %v", name, value, err)
+	}
+	return n, nil
+}
+
+// splitList tách chuỗi phân cách bởi dấu phẩy và bỏ các phần tử rỗng
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
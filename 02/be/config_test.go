@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigMaxUploadSize(t *testing.T) {
+	cfg, err := parseConfig(nil)
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+	if cfg.MaxUploadSize != defaultMaxUploadSize {
+		t.Errorf("Default MaxUploadSize = %d, want %d", cfg.MaxUploadSize, defaultMaxUploadSize)
+	}
+
+	if cfg, err = parseConfig([]string{"-max-upload-size", "1048576"}); err != nil || cfg.MaxUploadSize != 1<<20 {
+		t.Errorf("parseConfig(-max-upload-size 1048576) = %d, %v, want %d", cfg.MaxUploadSize, err, 1<<20)
+	}
+
+	for _, value := range []string{"0", "-1"} {
+		if _, err := parseConfig([]string{"-max-upload-size", value}); err == nil {
+			t.Errorf("parseConfig(-max-upload-size %s) error = nil, want an error", value)
+		}
+	}
+}
+
+func TestParseConfigPathsAndPort(t *testing.T) {
+	cfg, err := parseConfig(nil)
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+	if cfg.Port != 8080 || cfg.TempDir != "./temp" || cfg.ScriptPath != "ocr.py" {
+		t.Errorf("Defaults = port %d, temp dir %q, script %q, want 8080, ./temp, ocr.py", cfg.Port, cfg.TempDir, cfg.ScriptPath)
+	}
+
+	// Biến môi trường được dùng khi không có flag, flag được ưu tiên hơn
+	t.Setenv("OCR_PORT", "9000")
+	t.Setenv("OCR_TEMP_DIR", "/tmp/ocr-env")
+	t.Setenv("OCR_SCRIPT_PATH", "/opt/env/ocr.py")
+	cfg, err = parseConfig([]string{"-script-path", "/opt/flag/ocr.py"})
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+	if cfg.Port != 9000 || cfg.TempDir != "/tmp/ocr-env" || cfg.ScriptPath != "/opt/flag/ocr.py" {
+		t.Errorf("Config = port %d, temp dir %q, script %q, want 9000, /tmp/ocr-env, /opt/flag/ocr.py", cfg.Port, cfg.TempDir, cfg.ScriptPath)
+	}
+
+	for _, args := range [][]string{{"-port", "0"}, {"-port", "70000"}} {
+		if _, err := parseConfig(args); err == nil {
+			t.Errorf("parseConfig(%v) error = nil, want an error", args)
+		}
+	}
+	t.Setenv("OCR_PORT", "http")
+	if _, err := parseConfig(nil); err == nil {
+		t.Error("parseConfig() with OCR_PORT=http error = nil, want an error")
+	}
+}
+
+func TestConfigPropagatesToServer(t *testing.T) {
+	tempDir := filepath.Join(t.TempDir(), "uploads")
+	script := writeStubScript(t, stubOCRScript)
+	cfg, err := parseConfig([]string{"-temp-dir", tempDir, "-script-path", script, "-workers", "0"})
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+
+	srv, err := newServer(cfg, newTestLogger(t))
+	if err != nil {
+		t.Fatalf("newServer() error = %v", err)
+	}
+	defer srv.Close()
+
+	// Ảnh upload được lưu trong thư mục tạm cấu hình và được OCR bằng script cấu hình
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	calls := readCalls(t, script)
+	if len(calls) != 1 || filepath.Dir(calls[0].ImagePath) != tempDir {
+		t.Errorf("Script calls = %+v, want one call for an image in %s", calls, tempDir)
+	}
+}
+
+func TestParseConfigAPIToken(t *testing.T) {
+	cfg, err := parseConfig([]string{"-api-keys", "first,second", "-api-token", "token"})
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+	if got := strings.Join(cfg.APIKeys, ","); got != "first,second,token" {
+		t.Errorf("APIKeys = %v, want first, second and token", cfg.APIKeys)
+	}
+
+	t.Setenv("OCR_API_TOKEN", "env-token")
+	if cfg, _ = parseConfig(nil); len(cfg.APIKeys) != 1 || cfg.APIKeys[0] != "env-token" {
+		t.Errorf("APIKeys from OCR_API_TOKEN = %v, want [env-token]", cfg.APIKeys)
+	}
+}
+
+func TestParseConfigPython(t *testing.T) {
+	cfg, err := parseConfig(nil)
+	if err != nil {
+		t.Fatalf("parseConfig() error = %v", err)
+	}
+	if cfg.Python != "python" || len(cfg.PythonArgs) != 0 {
+		t.Errorf("Defaults = python %q, args %v, want python and no args", cfg.Python, cfg.PythonArgs)
+	}
+
+	t.Setenv("OCR_PYTHON", "/opt/venv/bin/python")
+	t.Setenv("OCR_PYTHON_ARGS", "-u  -X utf8")
+	if cfg, err = parseConfig(nil); err != nil || cfg.Python != "/opt/venv/bin/python" || strings.Join(cfg.PythonArgs, ",") != "-u,-X,utf8" {
+		t.Errorf("parseConfig() from env = %q %v, %v", cfg.Python, cfg.PythonArgs, err)
+	}
+	if cfg, err = parseConfig([]string{"-python", "python3", "-python-args", "-B"}); err != nil || cfg.Python != "python3" || strings.Join(cfg.PythonArgs, ",") != "-B" {
+		t.Errorf("parseConfig(-python python3 -python-args -B) = %q %v, %v", cfg.Python, cfg.PythonArgs, err)
+	}
+	if _, err := parseConfig([]string{"-python", ""}); err == nil {
+		t.Error("parseConfig(-python \"\") error = nil, want an error")
+	}
+}
+
+func TestPythonCommand(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Python = "python3"
+	cfg.PythonArgs = []string{"-u", "-X", "utf8"}
+	cfg.ScriptPath = "/srv/ocr.py"
+
+	cmd := cfg.pythonCommand(context.Background(), paddleOCRArgs("image.png", 800, 600, "en")...)
+	want := []string{"python3", "-u", "-X", "utf8", "/srv/ocr.py", "image.png", "800", "600", "en"}
+	if !slices.Equal(cmd.Args, want) {
+		t.Errorf("Command args = %v, want %v", cmd.Args, want)
+	}
+
+	// Tạo lệnh nhiều lần không được làm thay đổi PythonArgs dùng chung
+	cfg.pythonCommand(context.Background(), "--worker")
+	if !slices.Equal(cfg.PythonArgs, []string{"-u", "-X", "utf8"}) {
+		t.Errorf("PythonArgs modified: %v", cfg.PythonArgs)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+)
+
+// convertibleFormats là các định dạng ảnh cần chuyển sang PNG trước khi đưa cho ocr.py
+var convertibleFormats = map[string]bool{
+	"image/webp": true,
+	"image/tiff": true,
+	"image/heic": true,
+	"image/avif": true,
+}
+
+// supportedContentTypes là các kiểu nội dung ocr.py đọc được trực tiếp, cùng với các định dạng
+// trong convertibleFormats chúng là những file được chấp nhận để OCR
+var supportedContentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/bmp":       true,
+	"image/gif":       true,
+	"application/pdf": true,
+}
+
+// sniffContentType bổ sung cho http.DetectContentType các định dạng ảnh nó không nhận diện được (TIFF, HEIC, AVIF)
+func sniffContentType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return "image/tiff"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp" && isAVIFBrand(string(head[8:12])):
+		return "image/avif"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp" && isHEICBrand(string(head[8:12])):
+		return "image/heic"
+	}
+	return http.DetectContentType(head)
+}
+
+// isHEICBrand kiểm tra brand trong box ftyp của file HEIF/HEIC
+func isHEICBrand(brand string) bool {
+	switch brand {
+	case "heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1":
+		return true
+	}
+	return false
+}
+
+// isAVIFBrand kiểm tra brand trong box ftyp của file AVIF, AVIF cũng là HEIF nhưng nén bằng AV1
+func isAVIFBrand(brand string) bool {
+	return brand == "avif" || brand == "avis"
+}
+
+// convertToPNG chuyển ảnh upload sang PNG bằng công cụ cấu hình (mặc định ImageMagick convert)
+// Công cụ được gọi với cú pháp "<tool> <input> <output.png>"
+func (s *server) convertToPNG(upload *ocrUpload) error {
+	output := upload.path + ".png"
+
+	cmd := exec.Command(s.cfg.ImageConverter, upload.path, output)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(output)
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			return &requestError{http.StatusUnsupportedMediaType,
+				fmt.Sprintf("Cannot process %s: image converter %q is not available", upload.contentType, s.cfg.ImageConverter)}
+		}
+		return &requestError{http.StatusUnsupportedMediaType,
+			fmt.Sprintf("Cannot convert %s to PNG: %v - %s", upload.contentType, err, out)}
+	}
+
+	os.Remove(upload.path)
+	upload.path = output
+	upload.contentType = "image/png"
+	upload.width, upload.height = imageDimensions(output)
+	return nil
+}
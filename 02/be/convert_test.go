@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeWebP là header tối thiểu để được nhận diện là image/webp
+var fakeWebP = []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00")
+
+// fakeAVIF là box ftyp tối thiểu để được nhận diện là image/avif
+var fakeAVIF = []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00mif1miaf")
+
+// pngCheckOCRScript trả về "png" làm text nếu file được đưa cho script là ảnh PNG hợp lệ
+const pngCheckOCRScript = `
+import sys, json
+with open(sys.argv[1], "rb") as f:
+    text = "png" if f.read(8) == b"\x89PNG\r\n\x1a\n" else "not png"
+print(json.dumps([{"coords": [[0, 0], [10, 0], [10, 10], [0, 10]], "text": text, "confidence": 0.9}]))
+`
+
+// writeFakeConverter tạo công cụ chuyển đổi giả lập, luôn ghi ra ảnh PNG cho trước
+func writeFakeConverter(t *testing.T, pngData []byte) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	pngPath := filepath.Join(dir, "converted.png")
+	if err := os.WriteFile(pngPath, pngData, 0644); err != nil {
+		t.Fatalf("Failed to write PNG fixture: %v", err)
+	}
+
+	tool := filepath.Join(dir, "fake_convert")
+	script := "#!/bin/sh\ncp '" + pngPath + "' \"$2\"\n"
+	if err := os.WriteFile(tool, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake converter: %v", err)
+	}
+	return tool
+}
+
+func TestSniffContentType(t *testing.T) {
+	tests := []struct {
+		head []byte
+		want string
+	}{
+		{fakeWebP, "image/webp"},
+		{[]byte("II*\x00\x08\x00\x00\x00"), "image/tiff"},
+		{[]byte("MM\x00*\x00\x00\x00\x08"), "image/tiff"},
+		{[]byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00"), "image/heic"},
+		{fakeAVIF, "image/avif"},
+		{[]byte("\x00\x00\x00\x1cftypavis\x00\x00\x00\x00"), "image/avif"},
+		{[]byte("\x89PNG\r\n\x1a\n"), "image/png"},
+	}
+
+	for _, tt := range tests {
+		if got := sniffContentType(tt.head); got != tt.want {
+			t.Errorf("sniffContentType(%q) = %q, want %q", tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestHandleOCRConvertsWebPToPNG(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+	srv.cfg.ImageConverter = writeFakeConverter(t, encodePNG(t, 30, 20))
+
+	rec := serveOCR(srv, newUploadRequest(t, "photo.webp", fakeWebP, map[string]string{"verbose": "true"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	calls := readCalls(t, script)
+	if len(calls) != 1 || !strings.HasSuffix(calls[0].ImagePath, ".png") {
+		t.Fatalf("Script calls = %+v, want one call with a PNG file", calls)
+	}
+
+	// Kích thước được đọc từ ảnh PNG đã chuyển đổi
+	var resp ocrResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.OriginalWidth != 30 || resp.OriginalHeight != 20 {
+		t.Errorf("Original dimensions = %dx%d, want 30x20", resp.OriginalWidth, resp.OriginalHeight)
+	}
+
+	// Cả file gốc và file PNG đều được xóa sau khi xử lý
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp directory not cleaned up: %v", entries)
+	}
+}
+
+func TestHandleOCRConvertsAVIFToPNG(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, pngCheckOCRScript), 0)
+	srv.cfg.ImageConverter = writeFakeConverter(t, encodePNG(t, 30, 20))
+
+	for _, name := range []string{"photo.avif", "photo.webp"} {
+		content := fakeAVIF
+		if name == "photo.webp" {
+			content = fakeWebP
+		}
+		rec := serveOCR(srv, newUploadRequest(t, name, content, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body: %s", name, rec.Code, rec.Body.String())
+		}
+
+		var results []OCRResult
+		if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || len(results) != 1 || results[0].Text != "png" {
+			t.Errorf("%s: response = %s, want the script to receive a valid PNG", name, rec.Body.String())
+		}
+	}
+}
+
+func TestHandleOCRMissingConverter(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+	srv.cfg.ImageConverter = filepath.Join(t.TempDir(), "missing-converter")
+
+	rec := serveOCR(srv, newUploadRequest(t, "photo.webp", fakeWebP, nil))
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+	if !strings.Contains(rec.Body.String(), "not available") {
+		t.Errorf("Body = %q, want a message about the missing converter", rec.Body.String())
+	}
+	if calls := readCalls(t, script); len(calls) != 0 {
+		t.Errorf("Script should not be called, got %+v", calls)
+	}
+}
+
+func TestHandleOCRRejectsNonImageUpload(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "notes.png", []byte("just some plain text, not an image"), nil))
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusUnsupportedMediaType)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "text/plain") || !strings.Contains(body, "PNG, JPEG") {
+		t.Errorf("Body = %q, want the detected type and the supported formats", body)
+	}
+	if calls := readCalls(t, script); len(calls) != 0 {
+		t.Errorf("Script should not be called, got %+v", calls)
+	}
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp directory not cleaned up: %v", entries)
+	}
+}
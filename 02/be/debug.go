@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+// Nguồn của output thô trong ocrDebug
+const (
+	debugSourceScript = "script"
+	debugSourceWorker = "worker"
+)
+
+// ocrDebug là output thô của script OCR, chỉ trả về khi server chạy với -debug và client gửi debug=true
+// Output có thể chứa đường dẫn file tạm và thông tin môi trường nên không được bật ở production
+type ocrDebug struct {
+	// Source là "script" khi chạy script một lần hoặc "worker" khi OCR bằng worker thường trực
+	Source string `json:"source"`
+	Stdout string `json:"stdout"`
+	// Stderr chỉ có khi chạy script một lần, stderr của worker được ghi vào log server
+	Stderr string `json:"stderr"`
+}
+
+type debugKey struct{}
+
+// withDebug gắn nơi ghi output thô vào ctx để lần chạy OCR ghi lại stdout/stderr của script
+func withDebug(ctx context.Context) (context.Context, *ocrDebug) {
+	debug := &ocrDebug{}
+	return context.WithValue(ctx, debugKey{}, debug), debug
+}
+
+// debugFrom trả về nơi ghi output thô trong ctx, nil nếu request không bật debug
+func debugFrom(ctx context.Context) *ocrDebug {
+	debug, _ := ctx.Value(debugKey{}).(*ocrDebug)
+	return debug
+}
+
+// recordDebug ghi output thô của lần chạy OCR gần nhất nếu request bật debug
+func recordDebug(ctx context.Context, source, stdout, stderr string) {
+	if debug := debugFrom(ctx); debug != nil {
+		*debug = ocrDebug{Source: source, Stdout: stdout, Stderr: stderr}
+	}
+}
+
+// debugRequested cho biết request được nhận output thô: server phải bật -debug và client gửi debug=true
+func (s *server) debugRequested(r *http.Request) bool {
+	return s.cfg.Debug && r.FormValue("debug") == "true"
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// noisyOCRScript in cảnh báo ra stderr, ảnh tên "garbage" thì in stdout không phải JSON
+const noisyOCRScript = `
+import sys, json
+print("DeprecationWarning: noisy library", file=sys.stderr)
+if "garbage" in sys.argv[1]:
+    print("loading model... done")
+print(json.dumps([{"coords": [[0, 0], [10, 0], [10, 10], [0, 10]], "text": "noisy", "confidence": 0.9}]))
+`
+
+func TestHandleOCRDebug(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, noisyOCRScript), 0)
+	srv.cfg.Debug = true
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{"debug": "true"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var response ocrResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Cannot decode response: %v", err)
+	}
+	if response.Debug == nil || response.Debug.Source != debugSourceScript ||
+		!strings.Contains(response.Debug.Stdout, `"noisy"`) || !strings.Contains(response.Debug.Stderr, "DeprecationWarning") {
+		t.Errorf("Debug = %+v, want the raw script stdout and stderr", response.Debug)
+	}
+
+	// Output không parse được vẫn được trả về trong response lỗi
+	rec = serveOCR(srv, newUploadRequest(t, "garbage.png", encodePNG(t, 30, 20), map[string]string{"debug": "true"}))
+	var errResp ocrErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("Cannot decode error response %s: %v", rec.Body.String(), err)
+	}
+	if rec.Code != http.StatusInternalServerError || errResp.Debug == nil || !strings.Contains(errResp.Debug.Stdout, "loading model") {
+		t.Errorf("Status = %d, debug = %+v, want the unparsable stdout", rec.Code, errResp.Debug)
+	}
+}
+
+func TestHandleOCRDebugDisabled(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, noisyOCRScript), 0)
+
+	// Server không bật -debug thì debug=true bị bỏ qua, response giữ nguyên dạng mảng
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{"debug": "true"}))
+	if strings.Contains(rec.Body.String(), "DeprecationWarning") {
+		t.Errorf("Response = %s, want no raw output", rec.Body.String())
+	}
+	var results []OCRResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || len(results) != 1 {
+		t.Errorf("Response = %s, want a flat array", rec.Body.String())
+	}
+
+	rec = serveOCR(srv, newUploadRequest(t, "garbage.png", encodePNG(t, 30, 20), map[string]string{"debug": "true"}))
+	if strings.Contains(rec.Body.String(), "loading model") || strings.Contains(rec.Body.String(), `"debug"`) {
+		t.Errorf("Error response = %s, want no raw output", rec.Body.String())
+	}
+
+	// Server bật -debug nhưng request không gửi debug=true cũng không nhận output thô
+	srv.cfg.Debug = true
+	rec = serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil))
+	if strings.Contains(rec.Body.String(), "DeprecationWarning") {
+		t.Errorf("Response = %s, want no raw output", rec.Body.String())
+	}
+}
+
+func TestHandleOCRDebugWorker(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 1)
+	srv.cfg.Debug = true
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{"debug": "true"}))
+	var response ocrResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Cannot decode response %s: %v", rec.Body.String(), err)
+	}
+	if response.Debug == nil || response.Debug.Source != debugSourceWorker || !strings.Contains(response.Debug.Stdout, `"results"`) {
+		t.Errorf("Debug = %+v, want the raw worker response line", response.Debug)
+	}
+}
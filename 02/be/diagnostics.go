@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// maxDiagnosticDetail là số byte tối đa của stderr được trả về client
+const maxDiagnosticDetail = 1024
+
+// Các loại lỗi nhận diện được từ stderr của script OCR
+const (
+	ocrErrorModelNotFound     = "model_not_found"
+	ocrErrorBadImage          = "bad_image"
+	ocrErrorMissingDependency = "missing_dependency"
+	ocrErrorOutOfMemory       = "out_of_memory"
+	ocrErrorTransient         = "transient"
+	ocrErrorScriptFailed      = "script_failed"
+	ocrErrorTimeout           = "timeout"
+	ocrErrorBusy              = "busy"
+)
+
+// errOCRTimeout được trả về khi script OCR chạy quá thời gian cho phép và đã bị kill
+var errOCRTimeout = errors.New("OCR timed out")
+
+// stderrMarkers là các chuỗi đặc trưng trong stderr ứng với từng loại lỗi, so sánh không phân biệt hoa thường
+var stderrMarkers = []struct {
+	kind    string
+	markers []string
+}{
+	{ocrErrorBadImage, []string{"cannot identify image file", "unidentifiedimageerror", "error preprocessing image", "image file is truncated"}},
+	{ocrErrorModelNotFound, []string{"model not found", "model file not found", "model does not exist", "no such model"}},
+	{ocrErrorMissingDependency, []string{"modulenotfounderror", "no module named", "importerror"}},
+	{ocrErrorOutOfMemory, []string{"memoryerror", "out of memory"}},
+	{ocrErrorTransient, []string{"cuda error", "cudnn_status", "resource temporarily unavailable", "connection reset"}},
+}
+
+// ocrError là lỗi khi chạy script OCR kèm chẩn đoán rút ra từ stderr của Python
+type ocrError struct {
+	// kind là loại lỗi, một trong các hằng ocrError*
+	kind string
+	// detail là đoạn cuối stderr đã được làm sạch, an toàn để trả về client
+	detail string
+	// stderr là toàn bộ output lỗi, chỉ ghi vào log server
+	stderr string
+	err    error
+}
+
+// newOCRError phân loại lỗi dựa trên stderr của script
+func newOCRError(err error, stderr string) *ocrError {
+	return &ocrError{
+		kind:   classifyStderr(stderr),
+		detail: stderrTail(stderr, maxDiagnosticDetail),
+		stderr: stderr,
+		err:    err,
+	}
+}
+
+func (e *ocrError) Error() string {
+	return fmt.Sprintf("error executing PaddleOCR script: %v (%s)", e.err, e.kind)
+}
+
+func (e *ocrError) Unwrap() error {
+	return e.err
+}
+
+// status trả về mã HTTP tương ứng, ảnh hỏng là lỗi từ phía client
+func (e *ocrError) status() int {
+	if e.kind == ocrErrorBadImage {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// retryable cho biết lỗi có thể tự hết khi chạy lại, ví dụ thiếu bộ nhớ hay lỗi GPU tạm thời
+// Ảnh hỏng hay thiếu model thì chạy lại vẫn lỗi nên không được thử lại
+func (e *ocrError) retryable() bool {
+	return e.kind == ocrErrorOutOfMemory || e.kind == ocrErrorTransient
+}
+
+// classifyStderr tìm các chuỗi đặc trưng trong stderr để xác định loại lỗi
+func classifyStderr(stderr string) string {
+	lower := strings.ToLower(stderr)
+	for _, entry := range stderrMarkers {
+		for _, marker := range entry.markers {
+			if strings.Contains(lower, marker) {
+				return entry.kind
+			}
+		}
+	}
+	return ocrErrorScriptFailed
+}
+
+// stderrTail lấy tối đa maxBytes byte cuối của stderr, bắt đầu từ đầu một dòng,
+// và bỏ các ký tự điều khiển để không làm hỏng response
+func stderrTail(stderr string, maxBytes int) string {
+	stderr = strings.TrimSpace(strings.ToValidUTF8(stderr, ""))
+	if len(stderr) > maxBytes {
+		stderr = stderr[len(stderr)-maxBytes:]
+		if i := strings.IndexByte(stderr, '\n'); i >= 0 && i < len(stderr)-1 {
+			stderr = stderr[i+1:]
+		}
+		stderr = strings.ToValidUTF8(stderr, "")
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' || !unicode.IsControl(r) {
+			return r
+		}
+		return -1
+	}, stderr)
+}
+
+// ocrErrorCodes ánh xạ loại lỗi OCR sang code trong ocrErrorResponse, các loại khác dùng "ocr_failed"
+var ocrErrorCodes = map[string]string{
+	ocrErrorBadImage: "invalid_image",
+	ocrErrorTimeout:  "ocr_timeout",
+	ocrErrorBusy:     "ocr_busy",
+}
+
+// ocrErrorCode trả về code của loại lỗi OCR
+func ocrErrorCode(kind string) string {
+	if code, ok := ocrErrorCodes[kind]; ok {
+		return code
+	}
+	return "ocr_failed"
+}
+
+// ocrErrorResponse là body JSON trả về khi OCR thất bại
+// Error và Code giống errorResponse để client phân loại mọi lỗi theo cùng một cách
+type ocrErrorResponse struct {
+	Error  string `json:"error"`
+	Code   string `json:"code"`
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+	// Debug là output thô của script, chỉ có khi server bật -debug và client gửi debug=true
+	Debug *ocrDebug `json:"debug,omitempty"`
+}
+
+// writeOCRError ghi log đầy đủ stderr và trả về lỗi OCR dạng JSON cho client
+func (s *server) writeOCRError(w http.ResponseWriter, r *http.Request, message string, err error) {
+	id := requestID(r.Context())
+
+	// Client đã ngắt kết nối nên không còn ai nhận response
+	if errors.Is(err, context.Canceled) {
+		s.logger.Warning("[%s] OCR canceled: client disconnected", id)
+		return
+	}
+	s.logger.Error("[%s] OCR failed: %v", id, err)
+
+	resp := ocrErrorResponse{Error: message, Kind: ocrErrorScriptFailed, Detail: err.Error()}
+	// Lỗi xảy ra trước khi script chạy, ví dụ hàng đợi đầy, thì không có output thô
+	if debug := debugFrom(r.Context()); debug != nil && debug.Source != "" {
+		resp.Debug = debug
+	}
+	status := http.StatusInternalServerError
+
+	var oe *ocrError
+	switch {
+	case errors.Is(err, errOCRTimeout):
+		resp.Kind = ocrErrorTimeout
+		resp.Detail = fmt.Sprintf("OCR did not finish within %v", s.cfg.OCRTimeout)
+		status = http.StatusGatewayTimeout
+	case errors.Is(err, errOCRBusy):
+		resp.Kind = ocrErrorBusy
+		resp.Detail = "Too many OCR requests in progress, retry later"
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", "1")
+	case errors.As(err, &oe):
+		if oe.stderr != "" {
+			s.logger.Error("[%s] OCR script stderr:\n%s", id, oe.stderr)
+		}
+		resp.Kind = oe.kind
+		if oe.detail != "" {
+			resp.Detail = oe.detail
+		}
+		status = oe.status()
+	}
+
+	resp.Code = ocrErrorCode(resp.Kind)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingOCRScript ghi thông báo lỗi đã biết ra stderr rồi thoát với mã lỗi
+const failingOCRScript = `
+import sys
+print("Loading detection model...", file=sys.stderr)
+print("RuntimeError: model not found: /models/ch_PP-OCRv4_det_infer", file=sys.stderr)
+sys.exit(1)
+`
+
+// badImageOCRScript giả lập lỗi PIL khi không đọc được ảnh
+const badImageOCRScript = `
+import sys
+print("PIL.UnidentifiedImageError: cannot identify image file '%s'" % sys.argv[1], file=sys.stderr)
+sys.exit(1)
+`
+
+// flakyOCRScript lần đầu báo thiếu bộ nhớ, các lần sau trả kết quả bình thường
+// Mỗi lần chạy được ghi vào file attempts cạnh script
+const flakyOCRScript = `
+import sys, os, json
+attempts = os.path.join(os.path.dirname(os.path.abspath(__file__)), "attempts")
+with open(attempts, "a") as f:
+    f.write("run\n")
+if open(attempts).read().count("run") == 1:
+    print("MemoryError: out of memory while allocating tensor", file=sys.stderr)
+    sys.exit(1)
+print(json.dumps([{"coords": [[0, 0], [10, 0], [10, 10], [0, 10]], "text": "ok", "confidence": 0.9}]))
+`
+
+// countAttempts đếm số lần script đã chạy theo file attempts
+func countAttempts(t *testing.T, scriptPath string) int {
+	t.Helper()
+	content, _ := os.ReadFile(filepath.Join(filepath.Dir(scriptPath), "attempts"))
+	return strings.Count(string(content), "run")
+}
+
+func decodeOCRError(t *testing.T, body []byte) ocrErrorResponse {
+	t.Helper()
+	var resp ocrErrorResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("Cannot decode error response %q: %v", body, err)
+	}
+	return resp
+}
+
+func TestHandleOCRScriptStderrDiagnostics(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, failingOCRScript), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	resp := decodeOCRError(t, rec.Body.Bytes())
+	if resp.Kind != ocrErrorModelNotFound {
+		t.Errorf("Kind = %q, want %q", resp.Kind, ocrErrorModelNotFound)
+	}
+	if resp.Code != "ocr_failed" {
+		t.Errorf("Code = %q, want ocr_failed", resp.Code)
+	}
+	if !strings.Contains(resp.Detail, "model not found: /models/ch_PP-OCRv4_det_infer") {
+		t.Errorf("Detail = %q, want the stderr message", resp.Detail)
+	}
+
+	// Log server chứa toàn bộ stderr kể cả các dòng không trả về client
+	log := readLog(t, srv.logger)
+	if !strings.Contains(log, "ERROR") || !strings.Contains(log, "Loading detection model...") {
+		t.Errorf("Log does not contain the full stderr:\n%s", log)
+	}
+}
+
+func TestHandleOCRBadImageDiagnostics(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, badImageOCRScript), 0)
+
+	// File có chữ ký PNG nhưng nội dung hỏng vẫn tới được script
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", []byte("\x89PNG\r\n\x1a\nnot an image"), nil))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if resp := decodeOCRError(t, rec.Body.Bytes()); resp.Kind != ocrErrorBadImage || resp.Code != "invalid_image" {
+		t.Errorf("Response = %+v, want kind %q with code invalid_image", resp, ocrErrorBadImage)
+	}
+}
+
+func TestClassifyStderr(t *testing.T) {
+	tests := map[string]string{
+		"ModuleNotFoundError: No module named 'paddleocr'": ocrErrorMissingDependency,
+		"OSError: cannot identify image file 'x.png'":      ocrErrorBadImage,
+		"Error: Model file not found at /root/.paddleocr":  ocrErrorModelNotFound,
+		"MemoryError": ocrErrorOutOfMemory,
+		"RuntimeError: CUDA error: an illegal memory access was encountered": ocrErrorTransient,
+		"Segmentation fault": ocrErrorScriptFailed,
+		"":                   ocrErrorScriptFailed,
+	}
+	for stderr, want := range tests {
+		if got := classifyStderr(stderr); got != want {
+			t.Errorf("classifyStderr(%q) = %q, want %q", stderr, got, want)
+		}
+	}
+}
+
+func TestStderrTail(t *testing.T) {
+	stderr := strings.Repeat("noise line\n", 500) + "last \x1b[31mline\x00\n"
+	tail := stderrTail(stderr, 100)
+
+	if len(tail) > 100 {
+		t.Errorf("Tail length = %d, want at most 100", len(tail))
+	}
+	if !strings.HasPrefix(tail, "noise line\n") {
+		t.Errorf("Tail = %q, want it to start at a line boundary", tail)
+	}
+	if !strings.HasSuffix(tail, "last [31mline") {
+		t.Errorf("Tail = %q, want control characters removed", tail)
+	}
+}
+
+func TestProcessPaddleOCRRetriesTransientFailure(t *testing.T) {
+	script := writeStubScript(t, flakyOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	results, err := srv.processPaddleOCR(context.Background(), "image.png", 800, 800, "")
+	if err != nil {
+		t.Fatalf("processPaddleOCR() error = %v, want the retry to succeed", err)
+	}
+	if len(results) != 1 || results[0].Text != "ok" {
+		t.Errorf("Results = %+v, want the result of the retry", results)
+	}
+	if attempts := countAttempts(t, script); attempts != 2 {
+		t.Errorf("Script ran %d times, want 2", attempts)
+	}
+}
+
+func TestProcessPaddleOCRRetryStopsOnCancel(t *testing.T) {
+	// Script luôn báo thiếu bộ nhớ nên lần thử lại nào cũng phải chờ backoff
+	script := writeStubScript(t, `
+import sys
+print("MemoryError: out of memory while allocating tensor", file=sys.stderr)
+sys.exit(1)
+`)
+	srv := newTestServer(t, script, 0)
+	srv.cfg.OCRRetries = 10
+
+	// Hủy khi các lần chờ đã dài tới hàng trăm ms
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	canceled := make(chan time.Time, 1)
+	time.AfterFunc(time.Second, func() {
+		canceled <- time.Now()
+		cancel()
+	})
+
+	_, err := srv.processPaddleOCR(ctx, "image.png", 800, 800, "")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("processPaddleOCR() error = %v, want %v", err, context.Canceled)
+	}
+	if late := time.Since(<-canceled); late > 300*time.Millisecond {
+		t.Errorf("processPaddleOCR() returned %v after cancel, want it to stop waiting right away", late)
+	}
+}
+
+func TestProcessPaddleOCRDoesNotRetryBadImage(t *testing.T) {
+	script := writeStubScript(t, `
+import os
+with open(os.path.join(os.path.dirname(os.path.abspath(__file__)), "attempts"), "a") as f:
+    f.write("run\n")
+`+badImageOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	if _, err := srv.processPaddleOCR(context.Background(), "image.png", 800, 800, ""); err == nil {
+		t.Fatal("processPaddleOCR() error = nil, want the bad image error")
+	}
+	if attempts := countAttempts(t, script); attempts != 1 {
+		t.Errorf("Script ran %d times, want 1 for a deterministic failure", attempts)
+	}
+}
+
+// stdoutErrorOCRScript báo lỗi qua stdout và thoát 0 như phiên bản ocr.py cũ
+const stdoutErrorOCRScript = `
+import json
+print(json.dumps([{"error": "RuntimeError: model not found: /models/ch_PP-OCRv4_det_infer"}]))
+`
+
+func TestHandleOCRStdoutErrorEntry(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stdoutErrorOCRScript), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil))
+	if rec.Code == http.StatusOK {
+		t.Fatalf("Status = 200, body: %s, want an error for the error entry", rec.Body.String())
+	}
+	resp := decodeOCRError(t, rec.Body.Bytes())
+	if resp.Kind != ocrErrorModelNotFound || !strings.Contains(resp.Detail, "model not found") {
+		t.Errorf("Response = %+v, want the error entry classified as model_not_found", resp)
+	}
+}
+
+// fakePaddleModules là các module PIL, numpy và paddleocr giả lập để chạy ocr.py thật mà không cần cài thư viện
+// PaddleOCR giả lập ghi "run" vào file attempts mỗi lần khởi tạo, lỗi được chọn qua biến môi trường STUB_OCR_FAILURE
+var fakePaddleModules = map[string]string{
+	"numpy.py":            "",
+	"PIL/__init__.py":     "",
+	"PIL/ImageOps.py":     "def invert(img):\n    return img\n",
+	"PIL/ImageEnhance.py": "class Contrast:\n    def __init__(self, img):\n        self.img = img\n    def enhance(self, factor):\n        return self.img\n",
+	"PIL/Image.py": `
+import builtins
+
+LANCZOS = 1
+
+class _Image:
+    size = (10, 10)
+    def convert(self, mode):
+        return self
+    def resize(self, size, method):
+        return self
+    def save(self, path, **kwargs):
+        builtins.open(path, "wb").close()
+
+def open(path):
+    return _Image()
+`,
+	"paddleocr.py": `
+import os
+
+attempts = os.path.join(os.path.dirname(os.path.abspath(__file__)), "attempts")
+
+class PaddleOCR:
+    def __init__(self, **kwargs):
+        with open(attempts, "a") as f:
+            f.write("run\n")
+
+    def ocr(self, path, cls=True):
+        failure = os.environ.get("STUB_OCR_FAILURE", "")
+        if failure == "bad_image":
+            raise OSError("cannot identify image file %r" % path)
+        if failure == "oom_once" and open(attempts).read().count("run") == 1:
+            raise MemoryError("out of memory while allocating tensor")
+        return [[[[[0, 0], [10, 0], [10, 10], [0, 10]], ("stub", 0.9)]]]
+`,
+}
+
+// writeRealOCRScript chép ocr.py của repo cùng các module giả lập vào thư mục tạm
+// Python tự thêm thư mục của script vào sys.path nên ocr.py import được các module giả lập
+func writeRealOCRScript(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	source, err := os.ReadFile("ocr.py")
+	if err != nil {
+		t.Fatalf("Failed to read ocr.py: %v", err)
+	}
+	files := map[string]string{"ocr.py": string(source)}
+	for name, content := range fakePaddleModules {
+		files[name] = content
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return filepath.Join(dir, "ocr.py")
+}
+
+func TestRealOCRScriptErrorConvention(t *testing.T) {
+	srv := newTestServer(t, writeRealOCRScript(t), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil))
+	var results []OCRResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); rec.Code != http.StatusOK || err != nil || len(results) != 1 || results[0].Text != "stub" {
+		t.Fatalf("Status = %d, body: %s, want the stub result", rec.Code, rec.Body.String())
+	}
+
+	// Lỗi của ocr.py được in ra stderr với mã thoát khác 0 nên được phân loại thay vì trả 200
+	t.Setenv("STUB_OCR_FAILURE", "bad_image")
+	rec = serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 30, 20), nil))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Status = %d, body: %s, want %d", rec.Code, rec.Body.String(), http.StatusUnprocessableEntity)
+	}
+	if resp := decodeOCRError(t, rec.Body.Bytes()); resp.Kind != ocrErrorBadImage || !strings.Contains(resp.Detail, "cannot identify image file") {
+		t.Errorf("Response = %+v, want a bad_image error with the traceback", resp)
+	}
+}
+
+func TestRealOCRScriptRetriesTransientFailure(t *testing.T) {
+	script := writeRealOCRScript(t)
+	srv := newTestServer(t, script, 0)
+	t.Setenv("STUB_OCR_FAILURE", "oom_once")
+
+	results, err := srv.processPaddleOCR(context.Background(), "image.png", 800, 800, "")
+	if err != nil {
+		t.Fatalf("processPaddleOCR() error = %v, want the retry to succeed", err)
+	}
+	if len(results) != 1 || results[0].Text != "stub" {
+		t.Errorf("Results = %+v, want the result of the retry", results)
+	}
+	if attempts := countAttempts(t, script); attempts != 2 {
+		t.Errorf("Script ran %d times, want 2", attempts)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+)
+
+// exifOrientationTag là tag Orientation trong IFD0 của EXIF
+const exifOrientationTag = 0x0112
+
+// jpegQuality là chất lượng khi ghi lại ảnh JPEG đã xoay
+const jpegQuality = 95
+
+// readJPEGOrientation đọc giá trị EXIF Orientation (1-8) của file JPEG, trả về 1 nếu không có tag
+func readJPEGOrientation(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 1, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return 1, errors.New("not a JPEG file")
+	}
+
+	// Duyệt các segment tới khi gặp APP1 chứa EXIF, dừng ở SOS vì phía sau là dữ liệu ảnh
+	for {
+		var marker [4]byte
+		if _, err := io.ReadFull(r, marker[:]); err != nil {
+			return 1, nil
+		}
+		if marker[0] != 0xFF || marker[1] == 0xDA || marker[1] == 0xD9 {
+			return 1, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return 1, errors.New("invalid JPEG segment length")
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return 1, nil
+		}
+
+		if marker[1] == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return parseEXIFOrientation(segment[6:])
+		}
+	}
+}
+
+// parseEXIFOrientation tìm tag Orientation trong IFD0 của dữ liệu TIFF trong segment EXIF
+func parseEXIFOrientation(tiff []byte) (int, error) {
+	if len(tiff) < 8 {
+		return 1, errors.New("EXIF data too short")
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1, errors.New("invalid EXIF byte order")
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1, errors.New("invalid EXIF IFD offset")
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) != exifOrientationTag {
+			continue
+		}
+
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 1, fmt.Errorf("invalid EXIF orientation %d", orientation)
+		}
+		return orientation, nil
+	}
+	return 1, nil
+}
+
+// orientImage trả về ảnh đã được xoay/lật để hiển thị đúng chiều theo giá trị EXIF Orientation
+// Với giá trị 5-8 chiều rộng và chiều cao của ảnh bị đổi chỗ
+func orientImage(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // lật ngang
+				sx, sy = w-1-x, y
+			case 3: // xoay 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // lật dọc
+				sx, sy = x, h-1-y
+			case 5: // lật theo đường chéo chính
+				sx, sy = y, x
+			case 6: // xoay 90° theo chiều kim đồng hồ
+				sx, sy = y, h-1-x
+			case 7: // lật theo đường chéo phụ
+				sx, sy = w-1-y, h-1-x
+			case 8: // xoay 90° ngược chiều kim đồng hồ
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// applyJPEGOrientation ghi lại file JPEG theo đúng chiều nếu EXIF Orientation khác bình thường
+// File mới không còn EXIF nên ocr.py nhận được ảnh đã đúng chiều, trả về true nếu ảnh đã được xoay
+func applyJPEGOrientation(path string) (bool, error) {
+	orientation, err := readJPEGOrientation(path)
+	if err != nil || orientation == 1 {
+		return false, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	img, err := jpeg.Decode(file)
+	file.Close()
+	if err != nil {
+		return false, fmt.Errorf("error decoding JPEG: %v", err)
+	}
+
+	// Ghi ra file tạm cạnh file gốc rồi đổi tên để không để lại file ghi dở
+	rotated := path + ".orient"
+	out, err := os.Create(rotated)
+	if err != nil {
+		return false, err
+	}
+	if err := jpeg.Encode(out, orientImage(img, orientation), &jpeg.Options{Quality: jpegQuality}); err != nil {
+		out.Close()
+		os.Remove(rotated)
+		return false, fmt.Errorf("error encoding JPEG: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(rotated)
+		return false, err
+	}
+	if err := os.Rename(rotated, path); err != nil {
+		os.Remove(rotated)
+		return false, err
+	}
+	return true, nil
+}
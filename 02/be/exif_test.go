@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// exifSegment tạo segment APP1 chứa EXIF big-endian với một tag Orientation
+func exifSegment(orientation uint16) []byte {
+	tiff := []byte{
+		'M', 'M', 0x00, 0x2A, 0x00, 0x00, 0x00, 0x08, // header, IFD0 ở offset 8
+		0x00, 0x01, // 1 entry
+		0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, byte(orientation >> 8), byte(orientation), 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, // không có IFD tiếp theo
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(payload) + 2
+	return append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, payload...)
+}
+
+// encodeJPEGWithOrientation tạo ảnh JPEG width x height có EXIF Orientation
+func encodeJPEGWithOrientation(t *testing.T, width, height int, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+
+	// Chèn segment EXIF ngay sau SOI
+	data := buf.Bytes()
+	return append(append([]byte{0xFF, 0xD8}, exifSegment(orientation)...), data[2:]...)
+}
+
+func TestReadJPEGOrientation(t *testing.T) {
+	dir := t.TempDir()
+	for _, orientation := range []uint16{1, 3, 6, 8} {
+		path := filepath.Join(dir, "photo.jpg")
+		os.WriteFile(path, encodeJPEGWithOrientation(t, 8, 4, orientation), 0644)
+		if got, err := readJPEGOrientation(path); err != nil || got != int(orientation) {
+			t.Errorf("readJPEGOrientation() = %d, %v, want %d", got, err, orientation)
+		}
+	}
+
+	// JPEG không có EXIF được coi là đúng chiều
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 4)), nil)
+	path := filepath.Join(dir, "plain.jpg")
+	os.WriteFile(path, buf.Bytes(), 0644)
+	if got, err := readJPEGOrientation(path); err != nil || got != 1 {
+		t.Errorf("readJPEGOrientation() without EXIF = %d, %v, want 1", got, err)
+	}
+}
+
+func TestOrientImage(t *testing.T) {
+	// Ảnh 3x2 với điểm đánh dấu ở góc trên bên trái
+	src := image.NewGray(image.Rect(0, 0, 3, 2))
+	src.SetGray(0, 0, color.Gray{Y: 255})
+
+	tests := []struct {
+		orientation   int
+		width, height int
+		markX, markY  int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+
+	for _, tt := range tests {
+		dst := orientImage(src, tt.orientation)
+		if b := dst.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+			t.Errorf("orientation %d: size = %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.width, tt.height)
+			continue
+		}
+		if r, _, _, _ := dst.At(tt.markX, tt.markY).RGBA(); r != 0xFFFF {
+			t.Errorf("orientation %d: marker not at (%d,%d)", tt.orientation, tt.markX, tt.markY)
+		}
+	}
+}
+
+func TestHandleOCRAppliesEXIFOrientation(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	// Ảnh lưu ngang 40x20 nhưng EXIF báo cần xoay 90°, ảnh đưa cho OCR phải là 20x40
+	image := encodeJPEGWithOrientation(t, 40, 20, 6)
+	rec := serveOCR(srv, newUploadRequest(t, "photo.jpg", image, map[string]string{"verbose": "true"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var response ocrResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Cannot decode response: %v", err)
+	}
+	if response.OriginalWidth != 20 || response.OriginalHeight != 40 {
+		t.Errorf("Image size = %dx%d, want 20x40 after applying the orientation", response.OriginalWidth, response.OriginalHeight)
+	}
+}
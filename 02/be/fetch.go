@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// maxFetchRedirects là số lần chuyển hướng tối đa khi tải ảnh từ image_url
+const maxFetchRedirects = 5
+
+// checkFetchURL chỉ cho phép URL http(s) tới các host trong danh sách cho phép (nếu có cấu hình)
+// để client không dùng server đọc file nội bộ hay gọi dịch vụ tùy ý
+// Địa chỉ nội bộ chỉ được tải khi host có trong FetchAllowedHosts, tên miền được kiểm tra lại khi kết nối
+func (s *server) checkFetchURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.New("missing host")
+	}
+	if s.fetchHostAllowed(u.Hostname()) {
+		return nil
+	}
+	if len(s.cfg.FetchAllowedHosts) > 0 {
+		return fmt.Errorf("host %s is not allowed", u.Hostname())
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && internalIP(ip) {
+		return fmt.Errorf("%w: %s", errInternalAddress, ip)
+	}
+	return nil
+}
+
+// fetchHostAllowed cho biết host có nằm trong FetchAllowedHosts hay không
+func (s *server) fetchHostAllowed(host string) bool {
+	for _, allowed := range s.cfg.FetchAllowedHosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchImage tải ảnh từ rawURL vào file tạm, giới hạn thời gian tải và kích thước như upload thường
+// Mọi lỗi đều trả về 400 kèm lý do để client biết URL có vấn đề gì
+func (s *server) fetchImage(ctx context.Context, rawURL string) (*uploadedFile, error) {
+	fail := func(err error) (*uploadedFile, error) {
+		return nil, &requestError{http.StatusBadRequest, "Error fetching image_url: " + err.Error()}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fail(err)
+	}
+	if err := s.checkFetchURL(u); err != nil {
+		return fail(err)
+	}
+
+	// Kiểm tra lại từng lần chuyển hướng, nếu không URL hợp lệ có thể chuyển tới host bị cấm
+	// Địa chỉ kết nối được kiểm tra sau khi phân giải để tên miền trỏ về mạng nội bộ cũng bị chặn
+	client := &http.Client{
+		Timeout:   s.cfg.FetchTimeout,
+		Transport: &http.Transport{DialContext: guardedDialContext(s.cfg.FetchTimeout, s.fetchHostAllowed)},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return errors.New("too many redirects")
+			}
+			return s.checkFetchURL(req.URL)
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer client.CloseIdleConnections()
+	resp, err := client.Do(req)
+	if err != nil {
+		return fail(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fail(fmt.Errorf("unexpected status %s", resp.Status))
+	}
+	if resp.ContentLength > s.cfg.MaxUploadSize {
+		return fail(fmt.Errorf("image exceeds the maximum size of %d bytes", s.cfg.MaxUploadSize))
+	}
+
+	filename := path.Base(u.Path)
+	if filename == "/" || filename == "." {
+		filename = "upload"
+	}
+
+	// Đọc thừa một byte để biết ảnh có vượt giới hạn không
+	header := textproto.MIMEHeader{"Content-Type": {resp.Header.Get("Content-Type")}}
+	file, err := s.saveUploadedFile(filename, header, io.LimitReader(resp.Body, s.cfg.MaxUploadSize+1))
+	if err != nil {
+		var reqErr *requestError
+		if errors.As(err, &reqErr) && reqErr.status != http.StatusInternalServerError {
+			return fail(errors.New(reqErr.message))
+		}
+		return nil, err
+	}
+	if file.size > s.cfg.MaxUploadSize {
+		os.Remove(file.path)
+		return fail(fmt.Errorf("image exceeds the maximum size of %d bytes", s.cfg.MaxUploadSize))
+	}
+	if file.size == 0 {
+		os.Remove(file.path)
+		return fail(errors.New("empty response body"))
+	}
+	return file, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newImageServer tạo server HTTP phục vụ ảnh PNG ở /image.png
+func newImageServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	png := encodePNG(t, 30, 20)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, defaultMaxUploadSize+1))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newURLFormRequest tạo request multipart chỉ có trường image_url và các tham số
+func newURLFormRequest(t *testing.T, imageURL string, fields map[string]string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("image_url", imageURL)
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/ocr", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestHandleOCRImageURL(t *testing.T) {
+	images := newImageServer(t)
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+	srv.cfg.FetchAllowedHosts = []string{"127.0.0.1"}
+
+	rec := serveOCR(srv, newURLFormRequest(t, images.URL+"/image.png", map[string]string{"verbose": "true", "lang": "en"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var response ocrResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Cannot decode response: %v", err)
+	}
+	if len(response.Results) != 1 || response.OriginalWidth != 30 || response.OriginalHeight != 20 {
+		t.Errorf("Response = %+v, want one result for a 30x20 image", response)
+	}
+
+	calls := readCalls(t, script)
+	if len(calls) != 1 || calls[0].Lang != "en" || !strings.HasSuffix(calls[0].ImagePath, "_image.png") {
+		t.Errorf("Script calls = %+v, want one call for image.png with lang en", calls)
+	}
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after the request", len(entries))
+	}
+}
+
+func TestHandleOCRImageURLJSON(t *testing.T) {
+	images := newImageServer(t)
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+	srv.cfg.FetchAllowedHosts = []string{"127.0.0.1"}
+
+	body, _ := json.Marshal(map[string]any{"image_url": images.URL + "/image.png"})
+	req := httptest.NewRequest(http.MethodPost, "/ocr", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	if rec := serveOCR(srv, req); rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandleOCRImageURLRejected(t *testing.T) {
+	images := newImageServer(t)
+	imagesURL, _ := url.Parse(images.URL)
+	loopback := []string{"127.0.0.1"}
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	tests := []struct {
+		name     string
+		url      string
+		allowed  []string
+		wantBody string
+	}{
+		{"file scheme", "file:///etc/passwd", nil, "unsupported URL scheme"},
+		{"not found", images.URL + "/missing.png", loopback, "unexpected status 404"},
+		{"too large", images.URL + "/large", loopback, "maximum size"},
+		{"host not allowed", images.URL + "/image.png", []string{"images.example.com"}, "is not allowed"},
+		{"redirect to file", images.URL + "/redirect?to=" + url.QueryEscape("file:///etc/passwd"), loopback, "unsupported URL scheme"},
+		{"unreachable", "http://127.0.0.1:1/image.png", loopback, "Error fetching image_url"},
+		// Không có danh sách cho phép thì địa chỉ nội bộ bị chặn, tên miền phân giải ra loopback bị chặn lúc kết nối
+		{"loopback", images.URL + "/image.png", nil, "internal address not allowed"},
+		{"metadata", "http://169.254.169.254/latest/meta-data", nil, "internal address not allowed"},
+		{"private", "http://10.0.0.1/image.png", nil, "internal address not allowed"},
+		{"localhost name", "http://localhost:" + imagesURL.Port() + "/image.png", nil, "internal address not allowed"},
+	}
+
+	for _, tt := range tests {
+		srv.cfg.FetchAllowedHosts = tt.allowed
+		rec := serveOCR(srv, newURLFormRequest(t, tt.url, nil))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), tt.wantBody) {
+			t.Errorf("%s: status = %d, body %q, want 400 containing %q", tt.name, rec.Code, rec.Body.String(), tt.wantBody)
+		}
+	}
+
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after rejected fetches", len(entries))
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// maxTIFFDirectories giới hạn số IFD được duyệt khi đếm frame để file hỏng có vòng lặp offset không làm treo server
+const maxTIFFDirectories = 10000
+
+// frameResult là kết quả OCR của một frame trong ảnh nhiều frame (TIFF nhiều trang, GIF động)
+type frameResult struct {
+	// Frame là chỉ số frame, bắt đầu từ 0
+	Frame   int         `json:"frame"`
+	Results []OCRResult `json:"results"`
+}
+
+// checkSinglePage trả về lỗi 415 cho PDF và ảnh nhiều frame ở các endpoint chỉ trả về kết quả của một ảnh,
+// where là tên endpoint trong thông báo lỗi, client cần gửi các file này qua /ocr
+func checkSinglePage(upload *ocrUpload, where string) error {
+	switch {
+	case upload.contentType == "application/pdf":
+		return &requestError{http.StatusUnsupportedMediaType, "PDF files are not supported in " + where}
+	case upload.frames > 1:
+		return &requestError{http.StatusUnsupportedMediaType, "Multi-frame images are not supported in " + where}
+	}
+	return nil
+}
+
+// countFrames trả về số frame của ảnh TIFF hoặc GIF, các định dạng khác luôn là 1 frame
+// GIF dừng đếm khi vượt quá maxFrames vì lúc đó request đã chắc chắn bị từ chối
+func countFrames(path, contentType string, maxFrames int) int {
+	switch contentType {
+	case "image/tiff":
+		if n, err := countTIFFFrames(path); err == nil && n > 0 {
+			return n
+		}
+	case "image/gif":
+		if n, err := countGIFFrames(path, maxFrames); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 1
+}
+
+// countGIFFrames đếm image descriptor trong cấu trúc block của GIF mà không giải nén pixel,
+// để GIF nhỏ chứa rất nhiều frame lớn không chiếm nhiều bộ nhớ, trả về tối đa maxFrames+1
+func countGIFFrames(path string, maxFrames int) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+
+	// Header 6 byte và logical screen descriptor 7 byte, bảng màu toàn cục nằm ngay sau nếu có
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, err
+	}
+	if string(header[:3]) != "GIF" {
+		return 0, fmt.Errorf("invalid GIF header")
+	}
+	if err := skipGIFColorTable(r, header[10]); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for count <= maxFrames {
+		introducer, err := r.ReadByte()
+		if err != nil {
+			return count, err
+		}
+		switch introducer {
+		case 0x21: // Extension: nhãn rồi các sub-block
+			if _, err := r.ReadByte(); err != nil {
+				return count, err
+			}
+		case 0x2C: // Image descriptor: 9 byte, bảng màu cục bộ, LZW minimum code size rồi các sub-block
+			descriptor := make([]byte, 9)
+			if _, err := io.ReadFull(r, descriptor); err != nil {
+				return count, err
+			}
+			if err := skipGIFColorTable(r, descriptor[8]); err != nil {
+				return count, err
+			}
+			if _, err := r.ReadByte(); err != nil {
+				return count, err
+			}
+			count++
+		case 0x3B: // Trailer
+			return count, nil
+		default:
+			return count, fmt.Errorf("invalid GIF block 0x%02x", introducer)
+		}
+		if err := skipGIFSubBlocks(r); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// skipGIFColorTable bỏ qua bảng màu nếu cờ trong byte packed cho biết có bảng màu
+func skipGIFColorTable(r *bufio.Reader, packed byte) error {
+	if packed&0x80 == 0 {
+		return nil
+	}
+	_, err := r.Discard(3 << ((packed & 0x07) + 1))
+	return err
+}
+
+// skipGIFSubBlocks bỏ qua chuỗi sub-block, mỗi block bắt đầu bằng byte độ dài, kết thúc bằng block rỗng
+func skipGIFSubBlocks(r *bufio.Reader) error {
+	for {
+		size, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if size == 0 {
+			return nil
+		}
+		if _, err := r.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
+
+// countTIFFFrames đếm số IFD trong chuỗi IFD của file TIFF, mỗi IFD là một trang
+func countTIFFFrames(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < 8 {
+		return 0, fmt.Errorf("TIFF file too short")
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, fmt.Errorf("invalid TIFF byte order")
+	}
+
+	count := 0
+	visited := make(map[uint32]bool)
+	for offset := order.Uint32(data[4:8]); offset != 0; count++ {
+		if visited[offset] || count >= maxTIFFDirectories || int(offset)+2 > len(data) {
+			return count, fmt.Errorf("invalid TIFF IFD offset %d", offset)
+		}
+		visited[offset] = true
+
+		entries := int(order.Uint16(data[offset:]))
+		next := int(offset) + 2 + entries*12
+		if next+4 > len(data) {
+			return count + 1, fmt.Errorf("truncated TIFF IFD at offset %d", offset)
+		}
+		offset = order.Uint32(data[next:])
+	}
+	return count, nil
+}
+
+// extractFrames tách từng frame của upload thành file PNG trong outDir, trả về theo thứ tự frame
+func (s *server) extractFrames(upload *ocrUpload, outDir string) ([]string, error) {
+	if upload.contentType == "image/gif" {
+		return extractGIFFrames(upload.path, outDir)
+	}
+	return s.extractConvertedFrames(upload, outDir)
+}
+
+// extractGIFFrames ghép lần lượt các frame của GIF động lên canvas để mỗi frame là ảnh đầy đủ như khi hiển thị
+// Sau mỗi frame canvas được xử lý theo disposal: xóa vùng frame về trong suốt hoặc trả lại nội dung trước frame
+func extractGIFFrames(path, outDir string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	g, err := gif.DecodeAll(file)
+	file.Close()
+	if err != nil {
+		return nil, &requestError{http.StatusBadRequest, "Error decoding GIF: " + err.Error()}
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	frames := make([]string, 0, len(g.Image))
+	for i, frame := range g.Image {
+		var disposal byte
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvas.Bounds())
+			draw.Draw(previous, canvas.Bounds(), canvas, image.Point{}, draw.Src)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		framePath := filepath.Join(outDir, fmt.Sprintf("frame_%03d.png", i))
+		out, err := os.Create(framePath)
+		if err != nil {
+			return nil, err
+		}
+		err = png.Encode(out, canvas)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, framePath)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames, nil
+}
+
+// extractConvertedFrames tách frame bằng công cụ chuyển đổi ảnh, đường dẫn output chứa mẫu %03d
+// để ImageMagick ghi mỗi frame ra một file frame_000.png, frame_001.png, ...
+func (s *server) extractConvertedFrames(upload *ocrUpload, outDir string) ([]string, error) {
+	cmd := exec.Command(s.cfg.ImageConverter, upload.path, filepath.Join(outDir, "frame_%03d.png"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, &requestError{http.StatusUnsupportedMediaType,
+			fmt.Sprintf("Cannot split %s into frames: %v - %s", upload.contentType, err, out)}
+	}
+
+	frames, err := filepath.Glob(filepath.Join(outDir, "frame_*.png"))
+	if err != nil {
+		return nil, err
+	}
+	if len(frames) == 0 {
+		return nil, &requestError{http.StatusUnsupportedMediaType, fmt.Sprintf("Cannot split %s into frames: no frame was written", upload.contentType)}
+	}
+
+	// Số frame có cùng độ dài nên sắp xếp theo tên là đúng thứ tự frame
+	sort.Strings(frames)
+	return frames, nil
+}
+
+// handleFrames tách ảnh nhiều frame rồi OCR lần lượt, kết quả được nhóm theo frame giống PDF
+// min_confidence và limit được áp dụng trên từng frame
+func (s *server) handleFrames(w http.ResponseWriter, r *http.Request, upload *ocrUpload, opts outputOptions) {
+	if err := checkPagedOptions(opts, "multi-frame images"); err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	if upload.frames > s.cfg.MaxFrames {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Image has more than %d frames", s.cfg.MaxFrames))
+		return
+	}
+
+	outDir, err := os.MkdirTemp(filepath.Dir(upload.path), framesTempPrefix)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Error creating temporary directory: "+err.Error())
+		return
+	}
+	defer os.RemoveAll(outDir)
+
+	frames, err := s.extractFrames(upload, outDir)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	results := make([]frameResult, 0, len(frames))
+	truncated := false
+	for i, frame := range frames {
+		frameOCR, err := s.processPaddleOCR(r.Context(), frame, upload.maxWidth, upload.maxHeight, upload.lang)
+		if err != nil {
+			s.writeOCRError(w, r, fmt.Sprintf("Error processing frame %d with PaddleOCR", i), err)
+			return
+		}
+		frameOCR, frameTruncated := applyPageOptions(frameOCR, opts)
+		truncated = truncated || frameTruncated
+		results = append(results, frameResult{Frame: i, Results: frameOCR})
+	}
+	if truncated {
+		w.Header().Set("X-OCR-Truncated", "true")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
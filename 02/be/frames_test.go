@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// encodeTIFFDirectories tạo file TIFF little-endian chỉ có chuỗi n IFD rỗng, đủ để đếm frame
+func encodeTIFFDirectories(n int) []byte {
+	data := []byte("II*\x00")
+	data = binary.LittleEndian.AppendUint32(data, 8)
+	for i := 0; i < n; i++ {
+		next := uint32(0)
+		if i < n-1 {
+			next = uint32(len(data) + 6)
+		}
+		data = binary.LittleEndian.AppendUint16(data, 0)
+		data = binary.LittleEndian.AppendUint32(data, next)
+	}
+	return data
+}
+
+// writeFakeFrameSplitter tạo công cụ chuyển đổi giả lập ghi n frame PNG theo mẫu %03d trong đường dẫn output
+func writeFakeFrameSplitter(t *testing.T, pngData []byte, n int) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	pngPath := filepath.Join(dir, "frame.png")
+	if err := os.WriteFile(pngPath, pngData, 0644); err != nil {
+		t.Fatalf("Failed to write PNG fixture: %v", err)
+	}
+
+	tool := filepath.Join(dir, "fake_convert")
+	script := "#!/bin/sh\ni=0\nwhile [ $i -lt " + strconv.Itoa(n) + " ]; do\n  cp '" + pngPath + "' \"$(printf \"$2\" $i)\"\n  i=$((i+1))\ndone\n"
+	if err := os.WriteFile(tool, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake converter: %v", err)
+	}
+	return tool
+}
+
+// decodeFrameResults giải mã response nhóm theo frame
+func decodeFrameResults(t *testing.T, body []byte) []frameResult {
+	t.Helper()
+	var frames []frameResult
+	if err := json.Unmarshal(body, &frames); err != nil {
+		t.Fatalf("Cannot decode frame results %s: %v", body, err)
+	}
+	return frames
+}
+
+func TestCountTIFFFrames(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []int{1, 2, 5} {
+		path := filepath.Join(dir, "scan.tiff")
+		os.WriteFile(path, encodeTIFFDirectories(n), 0644)
+		if got, err := countTIFFFrames(path); err != nil || got != n {
+			t.Errorf("countTIFFFrames() = %d, %v, want %d", got, err, n)
+		}
+	}
+
+	// IFD trỏ về chính nó không được làm treo việc đếm
+	loop := encodeTIFFDirectories(1)
+	binary.LittleEndian.PutUint32(loop[len(loop)-4:], 8)
+	path := filepath.Join(dir, "loop.tiff")
+	os.WriteFile(path, loop, 0644)
+	if _, err := countTIFFFrames(path); err == nil {
+		t.Error("countTIFFFrames() with an IFD loop error = nil, want an error")
+	}
+}
+
+func TestHandleOCRMultiFrameTIFF(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+	srv.cfg.ImageConverter = writeFakeFrameSplitter(t, encodePNG(t, 30, 20), 2)
+
+	rec := serveOCR(srv, newUploadRequest(t, "scan.tiff", encodeTIFFDirectories(2), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	frames := decodeFrameResults(t, rec.Body.Bytes())
+	if len(frames) != 2 {
+		t.Fatalf("Frames = %+v, want 2", frames)
+	}
+	for i, frame := range frames {
+		if frame.Frame != i {
+			t.Errorf("Frame %d index = %d", i, frame.Frame)
+		}
+		// Script giả lập trả về tên file ảnh làm text nên mỗi frame có kết quả riêng
+		if len(frame.Results) != 1 || frame.Results[0].Text != fmt.Sprintf("frame_%03d.png", i) {
+			t.Errorf("Frame %d results = %+v", i, frame.Results)
+		}
+	}
+
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after the request", len(entries))
+	}
+}
+
+func TestHandleOCRMultiFrameOutputOptions(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, multiBoxOCRScript), 0)
+	srv.cfg.ImageConverter = writeFakeFrameSplitter(t, encodePNG(t, 30, 20), 2)
+
+	rec := serveOCR(srv, newUploadRequest(t, "scan.tiff", encodeTIFFDirectories(2), map[string]string{"min_confidence": "0.6"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	frames := decodeFrameResults(t, rec.Body.Bytes())
+	if len(frames) != 2 {
+		t.Fatalf("Frames = %+v, want 2", frames)
+	}
+	for _, frame := range frames {
+		if len(frame.Results) != 2 || frame.Results[0].Text != "second" || frame.Results[1].Text != "third" {
+			t.Errorf("Frame %d results = %+v, want the boxes with confidence at least 0.6", frame.Frame, frame.Results)
+		}
+	}
+
+	// Các tùy chọn chưa hỗ trợ cho ảnh nhiều frame bị từ chối thay vì bị bỏ qua
+	rec = serveOCR(srv, newUploadRequest(t, "scan.tiff", encodeTIFFDirectories(2), map[string]string{"output": "text"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("output=text: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleOCRMultiFrameLimit(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+	srv.cfg.MaxFrames = 2
+
+	rec := serveOCR(srv, newUploadRequest(t, "scan.tiff", encodeTIFFDirectories(3), nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+// encodeGIF mã hóa các frame cùng disposal thành GIF động
+func encodeGIF(t *testing.T, frames []*image.Paletted, disposal []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	animation := &gif.GIF{Image: frames, Delay: make([]int, len(frames)), Disposal: disposal}
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatalf("Failed to encode GIF: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// filledFrame tạo frame kích thước w x h chỉ gồm màu có chỉ số index trong palette
+func filledFrame(palette color.Palette, w, h int, index uint8) *image.Paletted {
+	frame := image.NewPaletted(image.Rect(0, 0, w, h), palette)
+	for i := range frame.Pix {
+		frame.Pix[i] = index
+	}
+	return frame
+}
+
+func TestCountGIFFrames(t *testing.T) {
+	palette := color.Palette{color.Transparent, color.Black, color.White}
+	frames := make([]*image.Paletted, 5)
+	for i := range frames {
+		frames[i] = filledFrame(palette, 20, 10, uint8(i%3))
+	}
+	path := filepath.Join(t.TempDir(), "animation.gif")
+	os.WriteFile(path, encodeGIF(t, frames, nil), 0644)
+
+	if got, err := countGIFFrames(path, 20); err != nil || got != 5 {
+		t.Errorf("countGIFFrames() = %d, %v, want 5", got, err)
+	}
+	// Vượt quá giới hạn thì dừng đếm ngay ở frame đầu tiên vượt quá
+	if got, _ := countGIFFrames(path, 2); got != 3 {
+		t.Errorf("countGIFFrames() with limit 2 = %d, want 3", got)
+	}
+}
+
+func TestExtractGIFFramesDisposal(t *testing.T) {
+	palette := color.Palette{color.Transparent, color.Black, color.White}
+	corner := filledFrame(palette, 20, 10, 0)
+	corner.Pix[0] = 2
+
+	// pixelAt đọc pixel giữa ảnh của frame đã tách
+	pixelAt := func(path string) color.Color {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("Failed to open frame: %v", err)
+		}
+		defer file.Close()
+		img, err := png.Decode(file)
+		if err != nil {
+			t.Fatalf("Failed to decode frame: %v", err)
+		}
+		return img.At(10, 5)
+	}
+
+	tests := []struct {
+		name     string
+		frames   []*image.Paletted
+		disposal []byte
+		want     color.Color
+	}{
+		// Frame đen được xóa về nền trong suốt trước frame sau
+		{"background", []*image.Paletted{filledFrame(palette, 20, 10, 1), corner}, []byte{gif.DisposalBackground, gif.DisposalNone}, color.Transparent},
+		// Frame trắng được bỏ đi, frame sau vẽ lên nội dung đen trước nó
+		{"previous", []*image.Paletted{filledFrame(palette, 20, 10, 1), filledFrame(palette, 20, 10, 2), corner},
+			[]byte{gif.DisposalNone, gif.DisposalPrevious, gif.DisposalNone}, color.Black},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "animation.gif")
+		os.WriteFile(path, encodeGIF(t, tt.frames, tt.disposal), 0644)
+
+		frames, err := extractGIFFrames(path, dir)
+		if err != nil {
+			t.Fatalf("%s: extractGIFFrames() error = %v", tt.name, err)
+		}
+		last := frames[len(frames)-1]
+		r, g, b, a := pixelAt(last).RGBA()
+		wr, wg, wb, wa := tt.want.RGBA()
+		if r != wr || g != wg || b != wb || a != wa {
+			t.Errorf("%s: last frame pixel = %v, want %v", tt.name, pixelAt(last), tt.want)
+		}
+	}
+}
+
+func TestHandleOCRAnimatedGIF(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	palette := color.Palette{color.White, color.Black}
+	animation := &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 20, 10), palette),
+			image.NewPaletted(image.Rect(5, 2, 15, 8), palette),
+		},
+		Delay: []int{10, 10},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatalf("Failed to encode GIF: %v", err)
+	}
+
+	rec := serveOCR(srv, newUploadRequest(t, "animation.gif", buf.Bytes(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	frames := decodeFrameResults(t, rec.Body.Bytes())
+	if len(frames) != 2 || frames[0].Frame != 0 || frames[1].Frame != 1 {
+		t.Errorf("Frames = %+v, want frames 0 and 1", frames)
+	}
+
+	// GIF một frame vẫn trả về mảng kết quả phẳng
+	single := &gif.GIF{Image: animation.Image[:1], Delay: []int{0}}
+	buf.Reset()
+	gif.EncodeAll(&buf, single)
+	rec = serveOCR(srv, newUploadRequest(t, "still.gif", buf.Bytes(), nil))
+	var results []OCRResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || len(results) != 1 {
+		t.Errorf("Single-frame GIF response = %s, want a flat array", rec.Body.String())
+	}
+}
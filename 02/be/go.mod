@@ -1,3 +1,7 @@
 module be
 
 go 1.24
+
+replace logger => ../../01
+
+require logger v0.0.0-00010101000000-000000000000
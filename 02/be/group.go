@@ -0,0 +1,167 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// defaultGroupTolerance là khoảng cách tối đa (tính theo bội số chiều cao dòng) để ghép box vào cùng dòng/đoạn
+const defaultGroupTolerance = 1.0
+
+// minLineOverlap là tỷ lệ chồng lấn theo chiều dọc tối thiểu để hai box được coi là cùng dòng
+const minLineOverlap = 0.5
+
+// boundingBox là hình chữ nhật bao quanh [minX, minY, maxX, maxY]
+type boundingBox [4]float64
+
+func (b boundingBox) height() float64 {
+	return b[3] - b[1]
+}
+
+// union trả về hình chữ nhật bao cả hai box
+func (b boundingBox) union(o boundingBox) boundingBox {
+	return boundingBox{math.Min(b[0], o[0]), math.Min(b[1], o[1]), math.Max(b[2], o[2]), math.Max(b[3], o[3])}
+}
+
+// verticalOverlap trả về tỷ lệ chồng lấn theo chiều dọc so với box thấp hơn
+func (b boundingBox) verticalOverlap(o boundingBox) float64 {
+	overlap := math.Min(b[3], o[3]) - math.Max(b[1], o[1])
+	shorter := math.Min(b.height(), o.height())
+	if overlap <= 0 || shorter <= 0 {
+		return 0
+	}
+	return overlap / shorter
+}
+
+// horizontalOverlap cho biết hai box có giao nhau theo chiều ngang không
+func (b boundingBox) horizontalOverlap(o boundingBox) bool {
+	return math.Min(b[2], o[2]) > math.Max(b[0], o[0])
+}
+
+// resultBox tính hình chữ nhật bao quanh đa giác Coords
+func resultBox(result OCRResult) boundingBox {
+	if len(result.Coords) == 0 {
+		return boundingBox{}
+	}
+
+	box := boundingBox{result.Coords[0][0], result.Coords[0][1], result.Coords[0][0], result.Coords[0][1]}
+	for _, point := range result.Coords[1:] {
+		box = box.union(boundingBox{point[0], point[1], point[0], point[1]})
+	}
+	return box
+}
+
+// ocrLine là một dòng chữ gồm các box nằm cạnh nhau theo chiều ngang
+type ocrLine struct {
+	Text  string      `json:"text"`
+	BBox  boundingBox `json:"bbox"`
+	Boxes []OCRResult `json:"boxes"`
+}
+
+// ocrParagraph là một đoạn gồm các dòng liền kề theo chiều dọc
+type ocrParagraph struct {
+	Text  string      `json:"text"`
+	BBox  boundingBox `json:"bbox"`
+	Lines []ocrLine   `json:"lines"`
+}
+
+// groupLines ghép các box thành dòng: box cùng dòng khi chồng lấn theo chiều dọc
+// và cách box bên trái không quá tolerance lần chiều cao dòng
+// Các dòng được sắp xếp từ trên xuống, box trong dòng từ trái sang phải
+func groupLines(results []OCRResult, tolerance float64) []ocrLine {
+	sorted := make([]OCRResult, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return resultBox(sorted[i])[0] < resultBox(sorted[j])[0]
+	})
+
+	var lines []ocrLine
+	for _, result := range sorted {
+		box := resultBox(result)
+
+		joined := false
+		for i := range lines {
+			line := &lines[i]
+			gap := box[0] - line.BBox[2]
+			if line.BBox.verticalOverlap(box) >= minLineOverlap && gap <= tolerance*line.BBox.height() {
+				line.BBox = line.BBox.union(box)
+				line.Boxes = append(line.Boxes, result)
+				joined = true
+				break
+			}
+		}
+
+		if !joined {
+			lines = append(lines, ocrLine{BBox: box, Boxes: []OCRResult{result}})
+		}
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].BBox[1] < lines[j].BBox[1]
+	})
+
+	for i := range lines {
+		texts := make([]string, len(lines[i].Boxes))
+		for j, box := range lines[i].Boxes {
+			texts[j] = box.Text
+		}
+		lines[i].Text = strings.Join(texts, " ")
+	}
+
+	return lines
+}
+
+// plainText nối text của các box theo thứ tự đọc: mỗi dòng một hàng,
+// với group "paragraphs" các đoạn cách nhau bởi một dòng trống
+func plainText(results []OCRResult, group string, tolerance float64) string {
+	lines := groupLines(results, tolerance)
+	if group == "paragraphs" {
+		paragraphs := groupParagraphs(lines, tolerance)
+		texts := make([]string, len(paragraphs))
+		for i, paragraph := range paragraphs {
+			texts[i] = paragraph.Text
+		}
+		return strings.Join(texts, "\n\n")
+	}
+
+	texts := make([]string, len(lines))
+	for i, line := range lines {
+		texts[i] = line.Text
+	}
+	return strings.Join(texts, "\n")
+}
+
+// groupParagraphs ghép các dòng thành đoạn: dòng thuộc đoạn khi giao nhau theo chiều ngang
+// và cách dòng phía trên không quá tolerance lần chiều cao dòng
+func groupParagraphs(lines []ocrLine, tolerance float64) []ocrParagraph {
+	var paragraphs []ocrParagraph
+	for _, line := range lines {
+		joined := false
+		for i := range paragraphs {
+			paragraph := &paragraphs[i]
+			last := paragraph.Lines[len(paragraph.Lines)-1]
+			gap := line.BBox[1] - paragraph.BBox[3]
+			if paragraph.BBox.horizontalOverlap(line.BBox) && gap <= tolerance*last.BBox.height() {
+				paragraph.BBox = paragraph.BBox.union(line.BBox)
+				paragraph.Lines = append(paragraph.Lines, line)
+				joined = true
+				break
+			}
+		}
+
+		if !joined {
+			paragraphs = append(paragraphs, ocrParagraph{BBox: line.BBox, Lines: []ocrLine{line}})
+		}
+	}
+
+	for i := range paragraphs {
+		texts := make([]string, len(paragraphs[i].Lines))
+		for j, line := range paragraphs[i].Lines {
+			texts[j] = line.Text
+		}
+		paragraphs[i].Text = strings.Join(texts, "\n")
+	}
+
+	return paragraphs
+}
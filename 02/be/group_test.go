@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// box tạo kết quả OCR hình chữ nhật từ (x0,y0) tới (x1,y1)
+func box(text string, x0, y0, x1, y1 float64) OCRResult {
+	return OCRResult{
+		Coords:     [][2]float64{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}},
+		Text:       text,
+		Confidence: 0.9,
+	}
+}
+
+// groupFixture là các box của hai dòng gần nhau, một box lạc ở xa và một dòng tách biệt phía dưới
+var groupFixture = []OCRResult{
+	box("second", 0, 14, 40, 24),
+	box("world", 35, 1, 70, 11),
+	box("Hello", 0, 0, 30, 10),
+	box("far", 300, 0, 330, 10),
+	box("footer", 0, 100, 50, 110),
+}
+
+func TestGroupLines(t *testing.T) {
+	lines := groupLines(groupFixture, defaultGroupTolerance)
+
+	want := []string{"Hello world", "far", "second", "footer"}
+	if len(lines) != len(want) {
+		t.Fatalf("Lines = %+v, want %d lines", lines, len(want))
+	}
+	for i, line := range lines {
+		if line.Text != want[i] {
+			t.Errorf("Line %d text = %q, want %q", i, line.Text, want[i])
+		}
+	}
+
+	if got := lines[0].BBox; got != (boundingBox{0, 0, 70, 11}) {
+		t.Errorf("First line bbox = %v, want [0 0 70 11]", got)
+	}
+}
+
+func TestGroupLinesTolerance(t *testing.T) {
+	// Tolerance lớn thì box ở xa cũng được ghép vào dòng đầu
+	lines := groupLines(groupFixture, 30)
+	if lines[0].Text != "Hello world far" {
+		t.Errorf("First line text = %q, want %q", lines[0].Text, "Hello world far")
+	}
+}
+
+func TestGroupParagraphs(t *testing.T) {
+	paragraphs := groupParagraphs(groupLines(groupFixture, defaultGroupTolerance), defaultGroupTolerance)
+
+	want := []string{"Hello world\nsecond", "far", "footer"}
+	if len(paragraphs) != len(want) {
+		t.Fatalf("Paragraphs = %+v, want %d paragraphs", paragraphs, len(want))
+	}
+	for i, paragraph := range paragraphs {
+		if paragraph.Text != want[i] {
+			t.Errorf("Paragraph %d text = %q, want %q", i, paragraph.Text, want[i])
+		}
+	}
+}
+
+func TestHandleOCRGroupLines(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{"group": "lines"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var lines []ocrLine
+	if err := json.Unmarshal(rec.Body.Bytes(), &lines); err != nil {
+		t.Fatalf("Cannot decode lines: %v", err)
+	}
+	if len(lines) != 1 || len(lines[0].Boxes) != 1 {
+		t.Errorf("Lines = %+v, want one line with one box", lines)
+	}
+
+	rec = serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{"group": "words"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Invalid group status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	if got, want := plainText(groupFixture, "", defaultGroupTolerance), "Hello world\nfar\nsecond\nfooter"; got != want {
+		t.Errorf("plainText() = %q, want %q", got, want)
+	}
+	if got, want := plainText(groupFixture, "paragraphs", defaultGroupTolerance), "Hello world\nsecond\n\nfar\n\nfooter"; got != want {
+		t.Errorf("plainText(paragraphs) = %q, want %q", got, want)
+	}
+}
+
+// bottomFirstOCRScript trả về box phía dưới trước box phía trên
+const bottomFirstOCRScript = `
+import json
+print(json.dumps([
+    {"coords": [[0, 40], [30, 40], [30, 50], [0, 50]], "text": "bottom", "confidence": 0.9},
+    {"coords": [[0, 0], [30, 0], [30, 10], [0, 10]], "text": "top", "confidence": 0.9},
+]))
+`
+
+func TestHandleOCRTextOutput(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, bottomFirstOCRScript), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 40, 60), map[string]string{"output": "text"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", got)
+	}
+	if got := rec.Body.String(); got != "top\nbottom" {
+		t.Errorf("Body = %q, want %q", got, "top\nbottom")
+	}
+
+	rec = serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 40, 60), map[string]string{"output": "xml"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Invalid output status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+)
+
+// healthResponse là nội dung trả về của /health và /ready
+type healthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// handleHealth cho biết tiến trình server vẫn đang chạy, dùng cho liveness probe
+func (s *server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// handleReady cho biết server có xử lý được request OCR không, dùng cho readiness probe
+func (s *server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.checkReady(); err != nil {
+		writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: "unavailable", Error: err.Error()})
+		return
+	}
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ready"})
+}
+
+// checkReady kiểm tra trình thông dịch Python, script OCR, kết quả self-check lúc khởi động và worker thường trực nếu có
+func (s *server) checkReady() error {
+	if _, err := exec.LookPath(s.cfg.Python); err != nil {
+		return fmt.Errorf("python interpreter not found: %v", err)
+	}
+	if info, err := os.Stat(s.cfg.ScriptPath); err != nil {
+		return fmt.Errorf("OCR script not found: %v", err)
+	} else if info.IsDir() {
+		return fmt.Errorf("OCR script %s is a directory", s.cfg.ScriptPath)
+	}
+	if err := s.lastSelfCheck(); err != nil {
+		return err
+	}
+	if s.pool != nil && s.pool.alive() == 0 {
+		return fmt.Errorf("no OCR worker is running")
+	}
+	return nil
+}
+
+// writeHealth ghi response JSON với status code cho trước
+func writeHealth(w http.ResponseWriter, status int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// getHealth gửi GET tới path và giải mã response
+func getHealth(t *testing.T, srv *server, path string) (int, healthResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var resp healthResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Cannot decode %s response %q: %v", path, rec.Body.String(), err)
+	}
+	return rec.Code, resp
+}
+
+func TestHealth(t *testing.T) {
+	srv := newTestServer(t, filepath.Join(t.TempDir(), "missing.py"), 0)
+
+	// Liveness không phụ thuộc script OCR
+	if code, resp := getHealth(t, srv, "/health"); code != http.StatusOK || resp.Status != "ok" {
+		t.Errorf("/health = %d %+v, want 200 ok", code, resp)
+	}
+}
+
+func TestReady(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 1)
+
+	if code, resp := getHealth(t, srv, "/ready"); code != http.StatusOK || resp.Status != "ready" {
+		t.Errorf("/ready = %d %+v, want 200 ready", code, resp)
+	}
+
+	// Pool đã đóng thì không còn worker nào xử lý request
+	srv.pool.Close()
+	if code, _ := getHealth(t, srv, "/ready"); code != http.StatusServiceUnavailable {
+		t.Errorf("/ready after closing the pool = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestReadyMissingScript(t *testing.T) {
+	srv := newTestServer(t, filepath.Join(t.TempDir(), "missing.py"), 0)
+
+	code, resp := getHealth(t, srv, "/ready")
+	if code != http.StatusServiceUnavailable || resp.Status != "unavailable" || resp.Error == "" {
+		t.Errorf("/ready = %d %+v, want 503 with an error", code, resp)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// jobStatus là trạng thái của một job OCR bất đồng bộ
+type jobStatus string
+
+const (
+	jobPending jobStatus = "pending"
+	jobRunning jobStatus = "running"
+	jobDone    jobStatus = "done"
+	jobFailed  jobStatus = "failed"
+)
+
+// ocrJob là một job OCR bất đồng bộ
+type ocrJob struct {
+	ID      string      `json:"job_id"`
+	Status  jobStatus   `json:"status"`
+	Results []OCRResult `json:"results,omitempty"`
+	Error   string      `json:"error,omitempty"`
+	// expires là thời điểm job đã xong bị xóa khỏi store, zero khi job chưa xong
+	expires time.Time
+}
+
+// jobStore lưu các job OCR trong bộ nhớ, an toàn khi dùng đồng thời
+// Job đã xong được giữ trong ttl để client kịp lấy kết quả rồi bị xóa
+type jobStore struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	jobs map[string]*ocrJob
+	now  func() time.Time
+	// limit là số job chưa xong tối đa, 0 nghĩa là không giới hạn
+	limit int
+	// active là số job đang pending hoặc running
+	active int
+}
+
+// newJobStore tạo store giữ job đã xong trong ttl (0 = giữ mãi mãi)
+// và nhận tối đa limit job chưa xong cùng lúc (0 = không giới hạn)
+func newJobStore(ttl time.Duration, limit int) *jobStore {
+	return &jobStore{ttl: ttl, limit: limit, jobs: make(map[string]*ocrJob), now: time.Now}
+}
+
+// newJobID tạo ID ngẫu nhiên cho job
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// create tạo một job mới ở trạng thái pending, trả về false khi đã đủ limit job chưa xong
+func (s *jobStore) create() (string, bool) {
+	id := newJobID()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.limit > 0 && s.active >= s.limit {
+		return "", false
+	}
+	s.active++
+
+	// Dọn các job hết hạn mỗi lần tạo job mới để store không lớn mãi
+	for jobID, job := range s.jobs {
+		if s.expired(job) {
+			delete(s.jobs, jobID)
+		}
+	}
+	s.jobs[id] = &ocrJob{ID: id, Status: jobPending}
+
+	return id, true
+}
+
+// expired cho biết job đã xong và quá ttl, cần giữ s.mu khi gọi
+func (s *jobStore) expired(job *ocrJob) bool {
+	return s.ttl > 0 && !job.expires.IsZero() && s.now().After(job.expires)
+}
+
+// get trả về bản sao của job theo ID
+func (s *jobStore) get(id string) (ocrJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return ocrJob{}, false
+	}
+	if s.expired(job) {
+		delete(s.jobs, id)
+		return ocrJob{}, false
+	}
+	return *job, true
+}
+
+// start chuyển job sang trạng thái running khi bắt đầu OCR
+func (s *jobStore) start(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.jobs[id]; ok {
+		job.Status = jobRunning
+	}
+}
+
+// finish cập nhật kết quả của job khi xử lý xong
+func (s *jobStore) finish(id string, results []OCRResult, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return
+	}
+	s.active--
+	job.expires = s.now().Add(s.ttl)
+
+	if err != nil {
+		job.Status = jobFailed
+		job.Error = err.Error()
+		return
+	}
+	job.Status = jobDone
+	job.Results = results
+}
+
+// handleOCRAsync nhận ảnh, đưa vào hàng đợi xử lý và trả về job_id ngay lập tức
+func (s *server) handleOCRAsync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	upload, err := s.receiveUpload(w, r)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	// Kết quả job là kết quả của một ảnh nên PDF và ảnh nhiều frame bị từ chối trước khi tạo job
+	if err := checkSinglePage(upload, "async jobs"); err != nil {
+		upload.remove()
+		writeRequestError(w, err)
+		return
+	}
+
+	// Client có thể đăng ký callback_url để nhận kết quả thay vì polling
+	callbackURL := r.FormValue("callback_url")
+	if callbackURL != "" {
+		if err := s.checkCallbackURL(callbackURL); err != nil {
+			upload.remove()
+			writeError(w, http.StatusBadRequest, "Invalid callback_url: "+err.Error())
+			return
+		}
+	}
+
+	// Mỗi job giữ file upload trên đĩa tới khi xong nên số job chưa xong bị giới hạn
+	id, ok := s.jobs.create()
+	if !ok {
+		upload.remove()
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, "Too many async jobs in progress, retry later")
+		return
+	}
+	reqID := requestID(r.Context())
+
+	// Xử lý ở goroutine riêng, file tạm được xóa khi job kết thúc
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		defer upload.remove()
+
+		s.jobs.start(id)
+		// Job chạy tiếp sau khi request gửi job kết thúc nên không dùng context của request
+		results, _, err := s.recognize(context.Background(), upload)
+		if err != nil {
+			s.logger.Error("[%s] OCR job %s failed: %v", reqID, id, err)
+		}
+		s.jobs.finish(id, results, err)
+
+		if callbackURL != "" {
+			if job, ok := s.jobs.get(id); ok {
+				s.deliverWebhook(reqID, callbackURL, job)
+			}
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"job_id": id})
+}
+
+// handleOCRResult trả về trạng thái và kết quả của một job bất đồng bộ
+func (s *server) handleOCRResult(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	job, ok := s.jobs.get(r.PathValue("job_id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Job not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// pollJob gọi endpoint kết quả cho tới khi job không còn pending hay running
+func pollJob(t *testing.T, handler http.Handler, id string) ocrJob {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ocr/result/"+id, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Poll status = %d, body: %s", rec.Code, rec.Body.String())
+		}
+
+		var job ocrJob
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatalf("Cannot decode job: %v", err)
+		}
+		if job.Status != jobPending && job.Status != jobRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Job %s not finished after timeout", id)
+	return ocrJob{}
+}
+
+// submitJob gửi ảnh tới /ocr/async và trả về job_id
+func submitJob(t *testing.T, handler http.Handler, filename string) string {
+	t.Helper()
+
+	// Thêm tên file vào sau ảnh để mỗi file có hash riêng
+	req := newUploadRequest(t, filename, append(encodePNG(t, 20, 20), filename...), nil)
+	req.URL.Path = "/ocr/async"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Submit status = %d, want %d, body: %s", rec.Code, http.StatusAccepted, rec.Body.String())
+	}
+
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Cannot decode submit response: %v", err)
+	}
+	if resp["job_id"] == "" {
+		t.Fatalf("Missing job_id in response: %s", rec.Body.String())
+	}
+	return resp["job_id"]
+}
+
+func TestAsyncJobLifecycle(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	handler := newTestServer(t, script, 1).routes()
+
+	id := submitJob(t, handler, "image.png")
+
+	job := pollJob(t, handler, id)
+	if job.Status != jobDone {
+		t.Fatalf("Job status = %s, want %s (error: %s)", job.Status, jobDone, job.Error)
+	}
+	if len(job.Results) != 1 {
+		t.Errorf("Job results = %+v, want 1 result", job.Results)
+	}
+}
+
+func TestAsyncJobFailure(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	handler := newTestServer(t, script, 1).routes()
+
+	// Script giả lập crash khi tên file chứa "crash"
+	id := submitJob(t, handler, "crash.png")
+
+	job := pollJob(t, handler, id)
+	if job.Status != jobFailed {
+		t.Fatalf("Job status = %s, want %s", job.Status, jobFailed)
+	}
+	if job.Error == "" {
+		t.Error("Expected error message for failed job")
+	}
+}
+
+func TestAsyncJobRejectsPagedFiles(t *testing.T) {
+	pdf, err := os.ReadFile("testdata/two_pages.pdf")
+	if err != nil {
+		t.Fatalf("Failed to read PDF fixture: %v", err)
+	}
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	files := map[string][]byte{"document.pdf": pdf, "scan.tiff": encodeTIFFDirectories(2)}
+	for _, path := range []string{"/ocr/async", "/ocr/jobs"} {
+		for name, content := range files {
+			req := newUploadRequest(t, name, content, nil)
+			req.URL.Path = path
+			rec := httptest.NewRecorder()
+			srv.routes().ServeHTTP(rec, req)
+			if rec.Code != http.StatusUnsupportedMediaType {
+				t.Errorf("%s %s: status = %d, want %d, body: %s", path, name, rec.Code, http.StatusUnsupportedMediaType, rec.Body.String())
+			}
+		}
+	}
+
+	// Không job nào được tạo nên script không chạy và file tạm đã được xóa
+	srv.background.Wait()
+	if calls := readCalls(t, script); len(calls) != 0 {
+		t.Errorf("Script ran %d times, want no job", len(calls))
+	}
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after rejected jobs", len(entries))
+	}
+}
+
+func TestAsyncJobUnknownID(t *testing.T) {
+	handler := newTestServer(t, writeStubScript(t, stubOCRScript), 0).routes()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ocr/result/unknown", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestJobsEndpoints(t *testing.T) {
+	handler := newTestServer(t, writeStubScript(t, stubOCRScript), 1).routes()
+
+	req := newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil)
+	req.URL.Path = "/ocr/jobs"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Submit status = %d, want %d, body: %s", rec.Code, http.StatusAccepted, rec.Body.String())
+	}
+	var submitted map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &submitted)
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ocr/jobs/"+submitted["job_id"], nil))
+		var job ocrJob
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatalf("Cannot decode job %q: %v", rec.Body.String(), err)
+		}
+		if job.Status == jobDone {
+			if len(job.Results) != 1 {
+				t.Errorf("Job results = %+v, want 1 result", job.Results)
+			}
+			break
+		}
+		if job.Status == jobFailed || time.Now().After(deadline) {
+			t.Fatalf("Job = %+v, want it to finish successfully", job)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ocr/jobs/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Unknown job status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAsyncJobPendingLimit(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+	srv.jobs = newJobStore(time.Minute, 2)
+	handler := srv.routes()
+
+	// Hai job chưa xong chiếm hết giới hạn
+	first, _ := srv.jobs.create()
+	srv.jobs.create()
+
+	req := newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil)
+	req.URL.Path = "/ocr/jobs"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Status = %d, want %d, body: %s", rec.Code, http.StatusServiceUnavailable, rec.Body.String())
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header on 503 response")
+	}
+	srv.background.Wait()
+	if calls := readCalls(t, script); len(calls) != 0 {
+		t.Errorf("Script ran %d times, want no job", len(calls))
+	}
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after the rejected job", len(entries))
+	}
+
+	// Một job xong thì nhận được job mới
+	srv.jobs.finish(first, nil, nil)
+	job := pollJob(t, handler, submitJob(t, handler, "image.png"))
+	if job.Status != jobDone {
+		t.Errorf("Status = %s, want %s, error: %s", job.Status, jobDone, job.Error)
+	}
+}
+
+func TestJobStoreTTL(t *testing.T) {
+	store := newJobStore(time.Minute, 0)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	id, _ := store.create()
+	store.start(id)
+	if job, _ := store.get(id); job.Status != jobRunning {
+		t.Errorf("Status = %s, want %s", job.Status, jobRunning)
+	}
+
+	// Job chưa xong thì không hết hạn dù đã quá ttl
+	now = now.Add(2 * time.Minute)
+	if _, ok := store.get(id); !ok {
+		t.Fatal("Running job expired")
+	}
+
+	store.finish(id, nil, nil)
+	now = now.Add(30 * time.Second)
+	if job, ok := store.get(id); !ok || job.Status != jobDone {
+		t.Fatalf("get() = %+v, %v, want the finished job within the ttl", job, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := store.get(id); ok {
+		t.Error("Finished job still available after the ttl")
+	}
+
+	// Job hết hạn cũng bị dọn khi tạo job mới
+	other, _ := store.create()
+	store.finish(other, nil, nil)
+	now = now.Add(2 * time.Minute)
+	store.create()
+	store.mu.Lock()
+	_, kept := store.jobs[other]
+	store.mu.Unlock()
+	if kept {
+		t.Error("Expired job was not removed when creating a new job")
+	}
+}
@@ -2,16 +2,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"strconv"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
+
+	"logger"
 )
 
 // OCRResult định nghĩa cấu trúc kết quả từ PaddleOCR
@@ -21,27 +26,120 @@ type OCRResult struct {
 	Confidence float64      `json:"confidence"`
 }
 
+// ocrResponse là response chi tiết khi client gửi verbose=true, stats=true hoặc debug=true
+type ocrResponse struct {
+	// Width, Height là kích thước ảnh lúc OCR, dùng để scale Coords
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// OriginalWidth, OriginalHeight là kích thước ảnh upload
+	OriginalWidth  int `json:"original_width"`
+	OriginalHeight int `json:"original_height"`
+	// MaxWidth, MaxHeight là kích thước tối đa thực sự được dùng, Clamped là true nếu tham số của client bị giảm
+	MaxWidth  int         `json:"max_width"`
+	MaxHeight int         `json:"max_height"`
+	Clamped   bool        `json:"clamped"`
+	Results   []OCRResult `json:"results"`
+	// Lines, Paragraphs chỉ có khi client gửi group=lines hoặc group=paragraphs
+	Lines      []ocrLine      `json:"lines,omitempty"`
+	Paragraphs []ocrParagraph `json:"paragraphs,omitempty"`
+	// Truncated là true khi kết quả bị cắt bớt theo tham số limit
+	Truncated bool `json:"truncated"`
+	// Stats chỉ có khi client gửi stats=true
+	Stats *confidenceStats `json:"stats,omitempty"`
+	// Debug là output thô của script, chỉ có khi server bật -debug và client gửi debug=true
+	Debug      *ocrDebug `json:"debug,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
 const MAX_ALLOWED_DIMENSION = 800
 
+// ocrRetryBackoff là thời gian chờ trước lần thử lại đầu tiên, tăng gấp đôi sau mỗi lần
+const ocrRetryBackoff = 100 * time.Millisecond
+
 func main() {
-	// Tạo thư mục tạm thời để lưu ảnh
-	os.MkdirAll("./temp", os.ModePerm)
+	cfg, err := parseConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	appLogger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer appLogger.Close()
+
+	srv, err := newServer(cfg, appLogger)
+	if err != nil {
+		appLogger.Error("Failed to start OCR server: %v", err)
+		os.Exit(1)
+	}
+	defer srv.Close()
+
+	// Môi trường Python hỏng được báo rõ ngay khi khởi động thay vì lỗi 500 ở request đầu tiên
+	if cfg.SelfCheck {
+		if err := srv.selfCheck(); err != nil {
+			appLogger.Error("Startup self-check failed: %v", err)
+			if cfg.RequireSelfCheck {
+				srv.Close()
+				os.Exit(1)
+			}
+		} else {
+			appLogger.Info("Startup self-check passed")
+		}
+	}
+
+	if cfg.Debug {
+		appLogger.Warning("Debug mode is enabled: requests with debug=true receive the raw OCR script output")
+	}
 
-	// Sử dụng middleware CORS
-	http.HandleFunc("/ocr", corsMiddleware(handleOCR))
+	// SIGINT/SIGTERM tắt server sau khi các request đang chạy xong thay vì kill ngay
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	port := 8080
-	fmt.Printf("Server is running on port %d...\n", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+	if err != nil {
+		appLogger.Error("Failed to listen on port %d: %v", cfg.Port, err)
+		srv.Close()
+		os.Exit(1)
+	}
+
+	appLogger.Info("Server is running on port %d...", cfg.Port)
+	if err := srv.serve(ctx, ln, cfg.ShutdownTimeout); err != nil {
+		appLogger.Error("Server stopped with error: %v", err)
+		srv.Close()
+		os.Exit(1)
+	}
+	appLogger.Info("Server stopped")
 }
 
 // Middleware để xử lý CORS
-func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// corsMiddleware thiết lập CORS headers, chỉ các origin trong allowedOrigins được phép gửi kèm credentials
+// Danh sách rỗng là chế độ dev: cho phép mọi origin bằng "*" và không hỗ trợ credentials
+func corsMiddleware(allowedOrigins []string, next http.HandlerFunc) http.HandlerFunc {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[origin] = true
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+
 		// Thiết lập CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if len(allowed) == 0 {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			// Response khác nhau theo Origin nên cache phải phân biệt theo header này
+			w.Header().Add("Vary", "Origin")
+			if allowed[origin] {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			} else if origin != "" && r.Method == http.MethodOptions {
+				writeError(w, http.StatusForbidden, "Origin not allowed")
+				return
+			}
+		}
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, X-Request-ID")
 
 		// Xử lý preflight request
 		if r.Method == "OPTIONS" {
@@ -54,93 +152,257 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
-func handleOCR(w http.ResponseWriter, r *http.Request) {
+func (s *server) handleOCR(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	r.ParseMultipartForm(20 << 20)
+	upload, err := s.receiveUpload(w, r)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	defer upload.remove() // Xóa file sau khi xử lý xong
 
-	// Lấy file từ request
-	file, handler, err := r.FormFile("image")
+	opts, err := parseOutputOptions(r)
 	if err != nil {
-		http.Error(w, "Error retrieving the file: "+err.Error(), http.StatusBadRequest)
+		writeRequestError(w, err)
 		return
 	}
-	defer file.Close()
+	setDimensionHeaders(w, upload)
 
-	fmt.Printf("Uploaded File: %+v\n", handler.Filename)
-	fmt.Printf("File Size: %+v\n", handler.Size)
-	fmt.Printf("MIME Header: %+v\n", handler.Header)
+	// Output thô của script được ghi lại qua context để trả về cả khi OCR thành công lẫn thất bại
+	var debug *ocrDebug
+	if s.debugRequested(r) {
+		var ctx context.Context
+		ctx, debug = withDebug(r.Context())
+		r = r.WithContext(ctx)
+	}
 
-	// Sử dụng giá trị mặc định là kích thước tối đa
-	maxWidth := MAX_ALLOWED_DIMENSION
-	maxHeight := MAX_ALLOWED_DIMENSION
+	// PDF được render thành ảnh từng trang trước khi OCR
+	if upload.contentType == "application/pdf" {
+		s.handlePDF(w, r, upload, opts)
+		return
+	}
 
-	// Xử lý tham số max_width - đảm bảo không vượt quá giới hạn
-	if widthStr := r.FormValue("max_width"); widthStr != "" {
-		if width, err := strconv.Atoi(widthStr); err == nil && width > 0 {
-			maxWidth = width
+	// TIFF nhiều trang và GIF động được OCR từng frame, ảnh một frame giữ response phẳng như cũ
+	if upload.frames > 1 {
+		s.handleFrames(w, r, upload, opts)
+		return
+	}
+
+	start := time.Now()
+	result, cached, err := s.recognize(r.Context(), upload)
+	if err != nil {
+		s.writeOCRError(w, r, "Error processing image with PaddleOCR", err)
+		return
+	}
+
+	s.storeResult(w, r, upload, result)
+
+	if s.cache != nil {
+		if cached {
+			w.Header().Set("X-OCR-Cache", "hit")
+		} else {
+			w.Header().Set("X-OCR-Cache", "miss")
 		}
 	}
 
-	// Xử lý tham số max_height - đảm bảo không vượt quá giới hạn
-	if heightStr := r.FormValue("max_height"); heightStr != "" {
-		if height, err := strconv.Atoi(heightStr); err == nil && height > 0 {
-			maxHeight = height
+	// Bỏ các box có độ tin cậy thấp trước khi chuẩn hóa và cắt bớt kết quả
+	result = filterByConfidence(result, opts.minConfidence)
+
+	width, height := processedDimensions(upload.width, upload.height, upload.maxWidth, upload.maxHeight)
+
+	// Chuẩn hóa tọa độ về [0,1] theo kích thước ảnh lúc OCR
+	if opts.normalizedCoords {
+		if width == 0 || height == 0 {
+			writeError(w, http.StatusUnprocessableEntity, "Cannot normalize coordinates: unknown image dimensions")
+			return
+		}
+		result = normalizeCoords(result, width, height)
+	} else if opts.originalCoords {
+		if width == 0 || height == 0 {
+			writeError(w, http.StatusUnprocessableEntity, "Cannot scale coordinates: unknown image dimensions")
+			return
 		}
+		result = toOriginalCoords(result, upload, width, height)
 	}
 
-	// Tạo tên file tạm thời dựa trên timestamp
-	tempFileName := fmt.Sprintf("temp/%d_%s", time.Now().Unix(), handler.Filename)
-	tempFilePath, _ := filepath.Abs(tempFileName)
+	// Giới hạn số kết quả trả về, client mặc định biết qua header X-OCR-Truncated
+	result, truncated := limitResults(result, opts.limit, opts.limitBy)
+	if truncated {
+		w.Header().Set("X-OCR-Truncated", "true")
+	}
 
-	// Tạo file tạm thời
-	tempFile, err := os.Create(tempFilePath)
-	if err != nil {
-		http.Error(w, "Error creating temporary file: "+err.Error(), http.StatusInternalServerError)
+	// Client chỉ cần text thì trả về text/plain theo thứ tự đọc
+	if opts.plainText {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, plainText(result, opts.group, opts.groupTolerance))
 		return
 	}
-	defer tempFile.Close()
-	defer os.Remove(tempFilePath) // Xóa file sau khi xử lý xong
 
-	// Sao chép nội dung file upload vào file tạm thời
-	_, err = io.Copy(tempFile, file)
-	if err != nil {
-		http.Error(w, "Error copying file: "+err.Error(), http.StatusInternalServerError)
+	// hOCR/ALTO mô tả trang theo hệ tọa độ của kết quả: ảnh upload hoặc ảnh lúc OCR
+	if opts.format != "" {
+		pageWidth, pageHeight := width, height
+		if opts.originalCoords {
+			pageWidth, pageHeight = upload.width, upload.height
+		}
+		w.Header().Set("Content-Type", formatContentTypes[opts.format])
+		if opts.format == formatHOCR {
+			writeHOCR(w, result, pageWidth, pageHeight, opts.groupTolerance)
+		} else {
+			writeALTO(w, result, pageWidth, pageHeight, opts.groupTolerance)
+		}
+		return
+	}
+
+	// Trả về kết quả dưới dạng JSON
+	w.Header().Set("Content-Type", "application/json")
+
+	// Nhóm box thành dòng hoặc đoạn nếu client yêu cầu
+	var lines []ocrLine
+	var paragraphs []ocrParagraph
+	switch opts.group {
+	case "lines":
+		lines = groupLines(result, opts.groupTolerance)
+	case "paragraphs":
+		paragraphs = groupParagraphs(groupLines(result, opts.groupTolerance), opts.groupTolerance)
+	}
+
+	// Mặc định trả về mảng kết quả để không ảnh hưởng client cũ, thống kê cần response dạng object như verbose=true
+	var stats *confidenceStats
+	if opts.stats {
+		stats = computeConfidenceStats(result)
+	}
+	if r.FormValue("verbose") != "true" && stats == nil && debug == nil {
+		switch {
+		case lines != nil:
+			json.NewEncoder(w).Encode(lines)
+		case paragraphs != nil:
+			json.NewEncoder(w).Encode(paragraphs)
+		default:
+			json.NewEncoder(w).Encode(result)
+		}
 		return
 	}
 
-	// Đóng file trước khi xử lý
-	tempFile.Close()
+	json.NewEncoder(w).Encode(ocrResponse{
+		Width:          width,
+		Height:         height,
+		OriginalWidth:  upload.width,
+		OriginalHeight: upload.height,
+		MaxWidth:       upload.maxWidth,
+		MaxHeight:      upload.maxHeight,
+		Clamped:        upload.clamped,
+		Results:        result,
+		Lines:          lines,
+		Paragraphs:     paragraphs,
+		Truncated:      truncated,
+		Stats:          stats,
+		Debug:          debug,
+		DurationMs:     time.Since(start).Milliseconds(),
+	})
+}
+
+// recognize chạy OCR cho ảnh đã upload, trả về kết quả trong cache nếu ảnh giống hệt đã được xử lý
+// OCR bị dừng khi ctx bị hủy, ví dụ khi client ngắt kết nối
+func (s *server) recognize(ctx context.Context, upload *ocrUpload) ([]OCRResult, bool, error) {
+	key := cacheKey(upload.hash, upload.maxWidth, upload.maxHeight, upload.lang)
+	// Request debug luôn chạy script để có output thô, kết quả vẫn được cache cho các request sau
+	if s.cache != nil && debugFrom(ctx) == nil {
+		if result, ok := s.cache.Get(key); ok {
+			s.metrics.cacheHits.Add(1)
+			return result, true, nil
+		}
+		s.metrics.cacheMisses.Add(1)
+	}
 
 	// Gọi PaddleOCR script để xử lý ảnh với kích thước hợp lệ
-	result, err := processPaddleOCR(tempFilePath, maxWidth, maxHeight)
+	result, err := s.processPaddleOCR(ctx, upload.path, upload.maxWidth, upload.maxHeight, upload.lang)
 	if err != nil {
-		http.Error(w, "Error processing image with PaddleOCR: "+err.Error(), http.StatusInternalServerError)
-		return
+		return nil, false, err
 	}
 
-	// Trả về kết quả dưới dạng JSON
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	if s.cache != nil {
+		s.cache.Add(key, result)
+	}
+	return result, false, nil
 }
 
-func processPaddleOCR(imagePath string, maxWidth, maxHeight int) ([]OCRResult, error) {
-	if maxWidth > MAX_ALLOWED_DIMENSION {
-		maxWidth = MAX_ALLOWED_DIMENSION
+func (s *server) processPaddleOCR(ctx context.Context, imagePath string, maxWidth, maxHeight int, lang string) (results []OCRResult, err error) {
+	// Chờ tới lượt nếu số lần OCR đồng thời bị giới hạn, thời gian chờ không tính vào thời gian OCR
+	if s.concurrency != nil {
+		if err := s.concurrency.acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer s.concurrency.release()
 	}
 
-	if maxHeight > MAX_ALLOWED_DIMENSION {
-		maxHeight = MAX_ALLOWED_DIMENSION
+	start := time.Now()
+	defer func() {
+		s.metrics.observeOCR(time.Since(start), err)
+	}()
+
+	// Lỗi tạm thời như thiếu bộ nhớ được thử lại vài lần, chờ lâu dần giữa các lần
+	for attempt := 0; ; attempt++ {
+		results, err = s.runOCR(ctx, imagePath, maxWidth, maxHeight, lang)
+
+		var oe *ocrError
+		if err == nil || attempt >= s.cfg.OCRRetries || !errors.As(err, &oe) || !oe.retryable() {
+			return results, err
+		}
+
+		backoff := ocrRetryBackoff << attempt
+		s.logger.Warning("OCR attempt %d for %s failed, retrying in %v: %v", attempt+1, imagePath, backoff, err)
+		// Client ngắt kết nối hoặc hết thời gian thì dừng ngay thay vì ngủ hết backoff
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
 	}
+}
 
-	// Đường dẫn tới script OCR
-	scriptPath := "ocr.py"
+// runOCR chạy OCR một lần bằng worker thường trực, hoặc bằng script mới khi không có worker hay worker bị lỗi
+func (s *server) runOCR(ctx context.Context, imagePath string, maxWidth, maxHeight int, lang string) ([]OCRResult, error) {
+	// Ưu tiên gửi tới worker Python thường trực để không phải nạp lại model
+	if s.pool != nil {
+		results, err := s.pool.process(ctx, workerRequest{
+			ImagePath: imagePath,
+			MaxWidth:  maxWidth,
+			MaxHeight: maxHeight,
+			Lang:      lang,
+		}, s.cfg.OCRTimeout)
+		if !errors.Is(err, errWorkerFailed) {
+			return results, err
+		}
 
-	// Gọi script Python với các tham số: đường dẫn ảnh, chiều rộng tối đa, chiều cao tối đa
-	cmd := exec.Command("python", scriptPath, imagePath, fmt.Sprintf("%d", maxWidth), fmt.Sprintf("%d", maxHeight))
+		// Worker chết giữa chừng đã được khởi động lại, chạy script một lần để request không bị lỗi
+		s.logger.Warning("Falling back to one-shot OCR for %s: %v", imagePath, err)
+	}
+
+	// Tiến trình Python bị treo sẽ bị kill khi hết thời gian thay vì giữ handler mãi mãi
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.OCRTimeout)
+	defer cancel()
+	return runPaddleOCRScript(ctx, s.cfg, imagePath, maxWidth, maxHeight, lang)
+}
+
+// paddleOCRArgs tạo tham số dòng lệnh cho script OCR (không gồm đường dẫn script)
+func paddleOCRArgs(imagePath string, maxWidth, maxHeight int, lang string) []string {
+	// Các tham số: đường dẫn ảnh, chiều rộng tối đa, chiều cao tối đa và ngôn ngữ (nếu có)
+	args := []string{imagePath, fmt.Sprintf("%d", maxWidth), fmt.Sprintf("%d", maxHeight)}
+	if lang != "" {
+		args = append(args, lang)
+	}
+	return args
+}
+
+// runPaddleOCRScript chạy script OCR trong một tiến trình Python mới, tiến trình bị kill khi ctx hết hạn
+func runPaddleOCRScript(ctx context.Context, cfg Config, imagePath string, maxWidth, maxHeight int, lang string) ([]OCRResult, error) {
+	cmd := cfg.pythonCommand(ctx, paddleOCRArgs(imagePath, maxWidth, maxHeight, lang)...)
+	// Không chờ mãi nếu tiến trình con của script còn giữ stdout/stderr sau khi script bị kill
+	cmd.WaitDelay = time.Second
 
 	var out bytes.Buffer
 	var stderr bytes.Buffer
@@ -148,15 +410,33 @@ func processPaddleOCR(imagePath string, maxWidth, maxHeight int) ([]OCRResult, e
 	cmd.Stderr = &stderr
 
 	err := cmd.Run()
+	recordDebug(ctx, debugSourceScript, out.String(), stderr.String())
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return nil, errOCRTimeout
+	case context.Canceled:
+		return nil, ctx.Err()
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error executing PaddleOCR script: %v - %s", err, stderr.String())
+		return nil, newOCRError(err, stderr.String())
 	}
 
-	// Parse kết quả JSON từ PaddleOCR
-	var results []OCRResult
-	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+	// Parse kết quả JSON từ PaddleOCR, phần tử có "error" là lỗi script báo qua stdout
+	// (quy ước của phiên bản ocr.py cũ) và được phân loại giống stderr
+	var entries []struct {
+		OCRResult
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &entries); err != nil {
 		return nil, fmt.Errorf("error parsing OCR results: %v", err)
 	}
 
+	results := make([]OCRResult, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Error != "" {
+			return nil, newOCRError(errors.New("OCR script reported an error"), strings.TrimSpace(stderr.String()+"\n"+entry.Error))
+		}
+		results = append(results, entry.OCRResult)
+	}
 	return results, nil
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newUploadRequest tạo request multipart giống form upload của frontend
+func newUploadRequest(t testing.TB, filename string, content []byte, fields map[string]string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile("image", filename)
+	if err != nil {
+		t.Fatalf("Failed to create form file: %v", err)
+	}
+	part.Write(content)
+
+	for name, value := range fields {
+		writer.WriteField(name, value)
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/ocr", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+// encodePNG tạo ảnh PNG trắng với kích thước cho trước
+func encodePNG(t testing.TB, width, height int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// serveOCR gửi request tới handleOCR và trả về response đã ghi lại
+func serveOCR(srv *server, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	srv.handleOCR(rec, req)
+	return rec
+}
+
+func TestHandleOCRCachesIdenticalImages(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	image := encodePNG(t, 20, 20)
+
+	first := serveOCR(srv, newUploadRequest(t, "a.png", image, nil))
+	if first.Code != http.StatusOK {
+		t.Fatalf("First request status = %d, body: %s", first.Code, first.Body.String())
+	}
+	if got := first.Header().Get("X-OCR-Cache"); got != "miss" {
+		t.Errorf("First request X-OCR-Cache = %q, want miss", got)
+	}
+
+	second := serveOCR(srv, newUploadRequest(t, "b.png", image, nil))
+	if second.Code != http.StatusOK {
+		t.Fatalf("Second request status = %d, body: %s", second.Code, second.Body.String())
+	}
+	if got := second.Header().Get("X-OCR-Cache"); got != "hit" {
+		t.Errorf("Second request X-OCR-Cache = %q, want hit", got)
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Errorf("Cached body differs:\nFirst: %s\nSecond: %s", first.Body.String(), second.Body.String())
+	}
+
+	// Script chỉ được gọi cho request đầu tiên
+	if loads := countLoads(t, script); loads != 1 {
+		t.Errorf("OCR script ran %d times, want 1", loads)
+	}
+
+	// Kích thước khác nhau là key khác nhau
+	third := serveOCR(srv, newUploadRequest(t, "a.png", image, map[string]string{"max_width": "400"}))
+	if got := third.Header().Get("X-OCR-Cache"); got != "miss" {
+		t.Errorf("Request with different max_width X-OCR-Cache = %q, want miss", got)
+	}
+}
+
+func TestHandleOCRVerboseMetadata(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	// Ảnh 1600x400 bị giới hạn bởi MAX_ALLOWED_DIMENSION nên được xử lý ở 800x200
+	image := encodePNG(t, 1600, 400)
+	rec := serveOCR(srv, newUploadRequest(t, "wide.png", image, map[string]string{
+		"verbose":   "true",
+		"max_width": "1600",
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp ocrResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Cannot decode verbose response: %v", err)
+	}
+
+	if resp.Width != 800 || resp.Height != 200 {
+		t.Errorf("Processed dimensions = %dx%d, want 800x200", resp.Width, resp.Height)
+	}
+	if resp.OriginalWidth != 1600 || resp.OriginalHeight != 400 {
+		t.Errorf("Original dimensions = %dx%d, want 1600x400", resp.OriginalWidth, resp.OriginalHeight)
+	}
+	if len(resp.Results) != 1 {
+		t.Errorf("Results = %+v, want 1 result", resp.Results)
+	}
+	if resp.DurationMs < 0 {
+		t.Errorf("DurationMs = %d, want >= 0", resp.DurationMs)
+	}
+}
+
+func TestHandleOCRDefaultResponseIsArray(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 10, 10), nil))
+
+	var results []OCRResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Default response is not an array: %v, body: %s", err, rec.Body.String())
+	}
+}
+
+func TestHandleOCRLanguage(t *testing.T) {
+	for _, workers := range []int{0, 1} {
+		script := writeStubScript(t, stubOCRScript)
+		srv := newTestServer(t, script, workers)
+
+		rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{"lang": "vi"}))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Workers %d: status = %d, body: %s", workers, rec.Code, rec.Body.String())
+		}
+
+		calls := readCalls(t, script)
+		if len(calls) != 1 || calls[0].Lang != "vi" {
+			t.Errorf("Workers %d: script calls = %+v, want one call with lang vi", workers, calls)
+		}
+	}
+}
+
+func TestHandleOCRRejectsUnsupportedLanguage(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", []byte("image"), map[string]string{"lang": "--help"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if calls := readCalls(t, script); len(calls) != 0 {
+		t.Errorf("Script should not be called for an invalid lang, got %+v", calls)
+	}
+}
+
+func TestPaddleOCRArgs(t *testing.T) {
+	args := paddleOCRArgs("image.png", 800, 600, "en")
+	want := []string{"image.png", "800", "600", "en"}
+	if strings.Join(args, " ") != strings.Join(want, " ") {
+		t.Errorf("paddleOCRArgs() = %v, want %v", args, want)
+	}
+
+	// Không truyền lang thì giữ nguyên tham số như trước
+	if args := paddleOCRArgs("image.png", 800, 600, ""); len(args) != 3 {
+		t.Errorf("paddleOCRArgs() without lang = %v, want 3 args", args)
+	}
+}
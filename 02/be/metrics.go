@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ocrDurationBuckets là các mốc (giây) của histogram thời gian xử lý OCR và thời gian xử lý request
+var ocrDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// histogram đếm số lần quan sát theo từng mốc, tương thích định dạng Prometheus
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+// observe ghi nhận một giá trị
+func (h *histogram) observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// labeledCounter là counter có một label, an toàn khi dùng đồng thời
+type labeledCounter struct {
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+func newLabeledCounter() *labeledCounter {
+	return &labeledCounter{values: make(map[string]uint64)}
+}
+
+func (c *labeledCounter) inc(label string) {
+	c.mu.Lock()
+	c.values[label]++
+	c.mu.Unlock()
+}
+
+// snapshot trả về bản sao các giá trị, sắp xếp theo label để output ổn định
+func (c *labeledCounter) snapshot() ([]string, map[string]uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	labels := make([]string, 0, len(c.values))
+	values := make(map[string]uint64, len(c.values))
+	for label, value := range c.values {
+		labels = append(labels, label)
+		values[label] = value
+	}
+	sort.Strings(labels)
+	return labels, values
+}
+
+// metrics chứa các chỉ số của OCR server, xuất ra theo định dạng text của Prometheus
+type metrics struct {
+	requests    *labeledCounter
+	errors      *labeledCounter
+	cacheHits   atomic.Uint64
+	cacheMisses atomic.Uint64
+	ocrFailures atomic.Uint64
+	ocrDuration *histogram
+	// requestDuration là thời gian xử lý request HTTP, tính cả thời gian chờ và upload
+	requestDuration *histogram
+	// inFlight là số request HTTP đang được xử lý
+	inFlight atomic.Int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:        newLabeledCounter(),
+		errors:          newLabeledCounter(),
+		ocrDuration:     newHistogram(ocrDurationBuckets),
+		requestDuration: newHistogram(ocrDurationBuckets),
+	}
+}
+
+// observeOCR ghi nhận thời gian và kết quả của một lần gọi PaddleOCR
+func (m *metrics) observeOCR(duration time.Duration, err error) {
+	m.ocrDuration.observe(duration.Seconds())
+	if err != nil {
+		m.ocrFailures.Add(1)
+	}
+}
+
+// writeTo xuất toàn bộ chỉ số theo định dạng text exposition của Prometheus
+func (m *metrics) writeTo(w io.Writer) {
+	writeLabeledCounter(w, "ocr_requests_total", "Total number of HTTP requests.", m.requests)
+	writeLabeledCounter(w, "ocr_request_errors_total", "Total number of HTTP requests that returned an error status.", m.errors)
+	writeCounter(w, "ocr_cache_hits_total", "Total number of OCR result cache hits.", m.cacheHits.Load())
+	writeCounter(w, "ocr_cache_misses_total", "Total number of OCR result cache misses.", m.cacheMisses.Load())
+	writeCounter(w, "ocr_processing_errors_total", "Total number of failed PaddleOCR invocations.", m.ocrFailures.Load())
+	writeGauge(w, "ocr_requests_in_flight", "Number of HTTP requests being served.", m.inFlight.Load())
+	writeHistogram(w, "ocr_request_duration_seconds", "Duration of HTTP requests.", m.requestDuration)
+	writeHistogram(w, "ocr_processing_duration_seconds", "Duration of PaddleOCR invocations.", m.ocrDuration)
+}
+
+func writeHistogram(w io.Writer, name, help string, h *histogram) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+func writeCounter(w io.Writer, name, help string, value uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	fmt.Fprintf(w, "%s %d\n", name, value)
+}
+
+func writeGauge(w io.Writer, name, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+	fmt.Fprintf(w, "%s %d\n", name, value)
+}
+
+func writeLabeledCounter(w io.Writer, name, help string, c *labeledCounter) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	labels, values := c.snapshot()
+	for _, label := range labels {
+		fmt.Fprintf(w, "%s{path=%q} %d\n", name, label, values[label])
+	}
+}
+
+// Middleware đếm số request, số request lỗi theo route và đo thời gian xử lý request
+func metricsMiddleware(m *metrics, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r)
+		m.requestDuration.observe(time.Since(start).Seconds())
+
+		// Dùng pattern của route thay cho path để job ID không làm tăng số label
+		path := r.Pattern
+		if path == "" {
+			path = r.URL.Path
+		}
+
+		m.requests.inc(path)
+		if rec.status >= http.StatusBadRequest {
+			m.errors.inc(path)
+		}
+	}
+}
+
+// handleMetrics trả về các chỉ số cho Prometheus scrape
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.writeTo(w)
+
+	// Hàng chờ và worker chỉ có khi được cấu hình, giá trị được đọc tại thời điểm scrape
+	if s.concurrency != nil {
+		writeGauge(w, "ocr_runs_active", "Number of OCR runs holding a -max-concurrency slot.", int64(s.concurrency.running()))
+		writeGauge(w, "ocr_queue_depth", "Number of OCR runs waiting for a -max-concurrency slot.", int64(s.concurrency.queued()))
+	}
+	if s.pool != nil {
+		writeGauge(w, "ocr_workers_busy", "Number of persistent Python workers processing a request.", int64(s.pool.busy()))
+	}
+}
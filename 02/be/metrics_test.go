@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsEndpoint(t *testing.T) {
+	handler := newTestServer(t, writeStubScript(t, stubOCRScript), 0).routes()
+
+	image := encodePNG(t, 10, 10)
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newUploadRequest(t, "image.png", image, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("OCR status = %d, body: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	// Request lỗi do thiếu file
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ocr", nil))
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Metrics status = %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`ocr_requests_total{path="/ocr"} 3`,
+		`ocr_request_errors_total{path="/ocr"} 1`,
+		`ocr_cache_hits_total 1`,
+		`ocr_cache_misses_total 1`,
+		`ocr_processing_errors_total 0`,
+		`# TYPE ocr_processing_duration_seconds histogram`,
+		`ocr_processing_duration_seconds_bucket{le="+Inf"} 1`,
+		`ocr_processing_duration_seconds_count 1`,
+		`ocr_requests_in_flight 0`,
+		`ocr_request_duration_seconds_count 3`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Metrics output missing %q\nGot:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsEndpointGauges(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 1)
+	srv.concurrency = newConcurrencyLimiter(2, 4, time.Second)
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE ocr_requests_in_flight gauge",
+		"ocr_runs_active 0",
+		"ocr_queue_depth 0",
+		"ocr_workers_busy 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Metrics output missing %q\nGot:\n%s", want, body)
+		}
+	}
+
+	// Một request đang chạy giữ một slot
+	srv.concurrency.acquire(context.Background())
+	defer srv.concurrency.release()
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "ocr_runs_active 1") {
+		t.Errorf("Metrics output missing ocr_runs_active 1\nGot:\n%s", body)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"logger"
+)
+
+// statusRecorder bọc http.ResponseWriter để ghi nhận status code và số byte đã trả về
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	// Handler không gọi WriteHeader thì mặc định là 200
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// Flush chuyển tiếp cho ResponseWriter gốc để response dạng stream không bị giữ lại ở middleware
+func (r *statusRecorder) Flush() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Middleware ghi access log: method, path, status code, kích thước response và thời gian xử lý
+func accessLogMiddleware(l *logger.Logger, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		l.Info("[%s] %s %s %d %dB %s", requestID(r.Context()), r.Method, r.URL.Path, rec.status, rec.size, time.Since(start))
+	}
+}
+
+// Middleware xác thực bằng API key qua header "Authorization: Bearer <key>" hoặc "X-API-Key"
+// Không cấu hình key nào thì bỏ qua xác thực để tiện chạy local
+func authMiddleware(keys []string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(keys) == 0 {
+			next(w, r)
+			return
+		}
+
+		key := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		if key == "" || !validAPIKey(keys, key) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// validAPIKey so sánh key với danh sách hợp lệ theo thời gian hằng để tránh lộ thông tin qua timing
+func validAPIKey(keys []string, key string) bool {
+	valid := false
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
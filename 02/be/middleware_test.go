@@ -0,0 +1,236 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"logger"
+)
+
+// newTestLogger tạo logger chỉ ghi ra file trong thư mục tạm của test
+func newTestLogger(t testing.TB) *logger.Logger {
+	t.Helper()
+	l, err := logger.NewLogger(
+		logger.WithConsoleOutput(false),
+		logger.WithFileOutput(true),
+		logger.WithLogDirectory(t.TempDir()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// readLog đọc toàn bộ nội dung file log hiện tại
+func readLog(t testing.TB, l *logger.Logger) string {
+	t.Helper()
+	content, err := os.ReadFile(l.GetCurrentLogFile())
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	return string(content)
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	l := newTestLogger(t)
+
+	handler := accessLogMiddleware(l, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond)
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("hello"))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/ocr", nil)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusTeapot)
+	}
+
+	content := readLog(t, l)
+	match := regexp.MustCompile(`POST /ocr 418 5B (\S+)`).FindStringSubmatch(content)
+	if match == nil {
+		t.Fatalf("Access log line not found, got: %s", content)
+	}
+
+	duration, err := time.ParseDuration(match[1])
+	if err != nil {
+		t.Fatalf("Cannot parse duration %q: %v", match[1], err)
+	}
+	if duration <= 0 {
+		t.Errorf("Duration = %v, want > 0", duration)
+	}
+}
+
+func TestAccessLogMiddlewareDefaultStatus(t *testing.T) {
+	l := newTestLogger(t)
+
+	handler := accessLogMiddleware(l, func(w http.ResponseWriter, r *http.Request) {})
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ocr", nil))
+
+	if content := readLog(t, l); !regexp.MustCompile(`GET /ocr 200 0B`).MatchString(content) {
+		t.Errorf("Expected default 200 status in access log, got: %s", content)
+	}
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       []string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{
+			name:       "No keys configured",
+			keys:       nil,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Missing key",
+			keys:       []string{"secret"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Invalid bearer key",
+			keys:       []string{"secret"},
+			headers:    map[string]string{"Authorization": "Bearer wrong"},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "Valid bearer key",
+			keys:       []string{"other", "secret"},
+			headers:    map[string]string{"Authorization": "Bearer secret"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Valid X-API-Key",
+			keys:       []string{"secret"},
+			headers:    map[string]string{"X-API-Key": "secret"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Invalid X-API-Key",
+			keys:       []string{"secret"},
+			headers:    map[string]string{"X-API-Key": "wrong"},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := authMiddleware(tt.keys, func(w http.ResponseWriter, r *http.Request) {})
+
+			req := httptest.NewRequest(http.MethodPost, "/ocr", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAuthLeavesProbesOpen(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+	srv.cfg.APIKeys = []string{"token"}
+	handler := srv.routes()
+
+	for path, want := range map[string]int{"/health": http.StatusOK, "/ready": http.StatusOK, "/ocr": http.StatusUnauthorized} {
+		rec := httptest.NewRecorder()
+		method := http.MethodGet
+		if path == "/ocr" {
+			method = http.MethodPost
+		}
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		if rec.Code != want {
+			t.Errorf("%s without a token: status = %d, want %d", path, rec.Code, want)
+		}
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name            string
+		origins         []string
+		method          string
+		origin          string
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{
+			name:       "Wildcard when no origins configured",
+			method:     http.MethodPost,
+			origin:     "http://any.example",
+			wantStatus: http.StatusOK,
+			wantOrigin: "*",
+		},
+		{
+			name:            "Allowed origin is echoed",
+			origins:         []string{"http://localhost:3000", "https://app.example"},
+			method:          http.MethodPost,
+			origin:          "https://app.example",
+			wantStatus:      http.StatusOK,
+			wantOrigin:      "https://app.example",
+			wantCredentials: "true",
+		},
+		{
+			name:            "Allowed origin preflight",
+			origins:         []string{"https://app.example"},
+			method:          http.MethodOptions,
+			origin:          "https://app.example",
+			wantStatus:      http.StatusOK,
+			wantOrigin:      "https://app.example",
+			wantCredentials: "true",
+		},
+		{
+			name:       "Disallowed origin gets no CORS headers",
+			origins:    []string{"https://app.example"},
+			method:     http.MethodPost,
+			origin:     "https://evil.example",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "Disallowed origin preflight is rejected",
+			origins:    []string{"https://app.example"},
+			method:     http.MethodOptions,
+			origin:     "https://evil.example",
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := corsMiddleware(tt.origins, func(w http.ResponseWriter, r *http.Request) { called = true })
+
+			req := httptest.NewRequest(tt.method, "/ocr", nil)
+			req.Header.Set("Origin", tt.origin)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCredentials)
+			}
+			if wantCalled := tt.method != http.MethodOptions; called != wantCalled {
+				t.Errorf("Next handler called = %v, want %v", called, wantCalled)
+			}
+		})
+	}
+}
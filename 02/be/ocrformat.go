@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+)
+
+// Các định dạng kết quả chuẩn cho pipeline số hóa tài liệu, chọn qua tham số format
+const (
+	formatHOCR = "hocr"
+	formatALTO = "alto"
+)
+
+// formatContentTypes là Content-Type trả về cho từng định dạng
+var formatContentTypes = map[string]string{
+	formatHOCR: "text/html; charset=utf-8",
+	formatALTO: "application/xml; charset=utf-8",
+}
+
+// pixelBox làm tròn hình chữ nhật bao về pixel nguyên như hOCR/ALTO yêu cầu
+func pixelBox(b boundingBox) [4]int {
+	return [4]int{
+		int(math.Floor(b[0])), int(math.Floor(b[1])),
+		int(math.Ceil(b[2])), int(math.Ceil(b[3])),
+	}
+}
+
+// writeHOCR ghi kết quả dưới dạng hOCR: mỗi đoạn là ocr_par, mỗi dòng là ocr_line
+// và mỗi box của PaddleOCR là một ocrx_word với bbox và x_wconf (0-100)
+func writeHOCR(w io.Writer, results []OCRResult, width, height int, tolerance float64) error {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Transitional//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-transitional.dtd">` + "\n")
+	b.WriteString(`<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="en" lang="en">` + "\n")
+	b.WriteString("<head>\n<title></title>\n")
+	b.WriteString(`<meta http-equiv="Content-Type" content="text/html; charset=utf-8" />` + "\n")
+	b.WriteString(`<meta name="ocr-system" content="paddleocr" />` + "\n")
+	b.WriteString(`<meta name="ocr-capabilities" content="ocr_page ocr_par ocr_line ocrx_word" />` + "\n")
+	b.WriteString("</head>\n<body>\n")
+	fmt.Fprintf(&b, "<div class='ocr_page' id='page_1' title='bbox 0 0 %d %d'>\n", width, height)
+
+	word, lineID := 0, 0
+	for p, paragraph := range groupParagraphs(groupLines(results, tolerance), tolerance) {
+		box := pixelBox(paragraph.BBox)
+		fmt.Fprintf(&b, "<p class='ocr_par' id='par_1_%d' title='bbox %d %d %d %d'>\n", p+1, box[0], box[1], box[2], box[3])
+		for _, line := range paragraph.Lines {
+			lineID++
+			box := pixelBox(line.BBox)
+			fmt.Fprintf(&b, "<span class='ocr_line' id='line_1_%d' title='bbox %d %d %d %d'>", lineID, box[0], box[1], box[2], box[3])
+			for i, result := range line.Boxes {
+				if i > 0 {
+					b.WriteString(" ")
+				}
+				word++
+				box := pixelBox(resultBox(result))
+				fmt.Fprintf(&b, "<span class='ocrx_word' id='word_1_%d' title='bbox %d %d %d %d; x_wconf %d'>%s</span>",
+					word, box[0], box[1], box[2], box[3], int(math.Round(result.Confidence*100)), html.EscapeString(result.Text))
+			}
+			b.WriteString("</span>\n")
+		}
+		b.WriteString("</p>\n")
+	}
+
+	b.WriteString("</div>\n</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// altoDocument là cấu trúc tối thiểu của tài liệu ALTO v4
+type altoDocument struct {
+	XMLName     xml.Name        `xml:"alto"`
+	Namespace   string          `xml:"xmlns,attr"`
+	Description altoDescription `xml:"Description"`
+	Page        altoPage        `xml:"Layout>Page"`
+}
+
+type altoDescription struct {
+	MeasurementUnit string `xml:"MeasurementUnit"`
+	Software        string `xml:"OCRProcessing>ocrProcessingStep>processingSoftware>softwareName"`
+}
+
+type altoPage struct {
+	ID         string         `xml:"ID,attr"`
+	Width      int            `xml:"WIDTH,attr"`
+	Height     int            `xml:"HEIGHT,attr"`
+	PhysicalNr int            `xml:"PHYSICAL_IMG_NR,attr"`
+	Space      altoPrintSpace `xml:"PrintSpace"`
+}
+
+type altoPrintSpace struct {
+	altoRect
+	Blocks []altoTextBlock `xml:"TextBlock"`
+}
+
+type altoTextBlock struct {
+	ID string `xml:"ID,attr"`
+	altoRect
+	Lines []altoTextLine `xml:"TextLine"`
+}
+
+type altoTextLine struct {
+	ID string `xml:"ID,attr"`
+	altoRect
+	Strings []altoString `xml:"String"`
+}
+
+type altoString struct {
+	ID string `xml:"ID,attr"`
+	altoRect
+	Content    string `xml:"CONTENT,attr"`
+	Confidence string `xml:"WC,attr"`
+}
+
+// altoRect là vị trí và kích thước của một phần tử ALTO tính bằng pixel
+type altoRect struct {
+	HPos   int `xml:"HPOS,attr"`
+	VPos   int `xml:"VPOS,attr"`
+	Width  int `xml:"WIDTH,attr"`
+	Height int `xml:"HEIGHT,attr"`
+}
+
+func newALTORect(b boundingBox) altoRect {
+	box := pixelBox(b)
+	return altoRect{HPos: box[0], VPos: box[1], Width: box[2] - box[0], Height: box[3] - box[1]}
+}
+
+// writeALTO ghi kết quả dưới dạng ALTO XML v4: mỗi đoạn là TextBlock, mỗi dòng là TextLine
+// và mỗi box của PaddleOCR là một String với WC là độ tin cậy trong [0,1]
+func writeALTO(w io.Writer, results []OCRResult, width, height int, tolerance float64) error {
+	page := altoPage{
+		ID:         "page_1",
+		Width:      width,
+		Height:     height,
+		PhysicalNr: 1,
+		Space:      altoPrintSpace{altoRect: altoRect{Width: width, Height: height}},
+	}
+
+	word, lineID := 0, 0
+	for p, paragraph := range groupParagraphs(groupLines(results, tolerance), tolerance) {
+		block := altoTextBlock{ID: fmt.Sprintf("block_%d", p+1), altoRect: newALTORect(paragraph.BBox)}
+		for _, line := range paragraph.Lines {
+			lineID++
+			textLine := altoTextLine{ID: fmt.Sprintf("line_%d", lineID), altoRect: newALTORect(line.BBox)}
+			for _, result := range line.Boxes {
+				word++
+				textLine.Strings = append(textLine.Strings, altoString{
+					ID:         fmt.Sprintf("string_%d", word),
+					altoRect:   newALTORect(resultBox(result)),
+					Content:    result.Text,
+					Confidence: fmt.Sprintf("%.2f", result.Confidence),
+				})
+			}
+			block.Lines = append(block.Lines, textLine)
+		}
+		page.Space.Blocks = append(page.Space.Blocks, block)
+	}
+
+	doc := altoDocument{
+		Namespace:   "http://www.loc.gov/standards/alto/ns-v4#",
+		Description: altoDescription{MeasurementUnit: "pixel", Software: "PaddleOCR"},
+		Page:        page,
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// hocrWord là một span ocrx_word đọc lại từ output hOCR
+type hocrWord struct {
+	title, text string
+}
+
+// parseHOCRWords đọc output hOCR như XHTML và trả về các span ocrx_word
+func parseHOCRWords(t *testing.T, document string) []hocrWord {
+	t.Helper()
+	decoder := xml.NewDecoder(strings.NewReader(document))
+	decoder.Strict = true
+
+	var words []hocrWord
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return words
+		}
+		if err != nil {
+			t.Fatalf("hOCR output is not well-formed: %v\n%s", err, document)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "span" {
+			continue
+		}
+		var class, title string
+		for _, attr := range start.Attr {
+			switch attr.Name.Local {
+			case "class":
+				class = attr.Value
+			case "title":
+				title = attr.Value
+			}
+		}
+		if class != "ocrx_word" {
+			continue
+		}
+
+		var text string
+		if err := decoder.DecodeElement(&text, &start); err != nil {
+			t.Fatalf("Cannot read ocrx_word: %v", err)
+		}
+		words = append(words, hocrWord{title, text})
+	}
+}
+
+func TestWriteHOCR(t *testing.T) {
+	results := append([]OCRResult{box("a < b & c", 120, 200, 160.5, 210)}, groupFixture...)
+
+	var out strings.Builder
+	if err := writeHOCR(&out, results, 400, 300, defaultGroupTolerance); err != nil {
+		t.Fatalf("writeHOCR() error = %v", err)
+	}
+	document := out.String()
+	if !strings.Contains(document, "class='ocr_page' id='page_1' title='bbox 0 0 400 300'") {
+		t.Errorf("hOCR output has no ocr_page with the image size:\n%s", document)
+	}
+
+	words := parseHOCRWords(t, document)
+	if len(words) != len(results) {
+		t.Fatalf("hOCR output has %d ocrx_word spans, want %d:\n%s", len(words), len(results), document)
+	}
+
+	bbox := regexp.MustCompile(`^bbox \d+ \d+ \d+ \d+; x_wconf \d+$`)
+	found := map[string]string{}
+	for _, word := range words {
+		if !bbox.MatchString(word.title) {
+			t.Errorf("ocrx_word %q title = %q, want bbox and x_wconf", word.text, word.title)
+		}
+		found[word.text] = word.title
+	}
+	for _, result := range results {
+		if _, ok := found[result.Text]; !ok {
+			t.Errorf("hOCR output has no ocrx_word for %q", result.Text)
+		}
+	}
+	if got, want := found["a < b & c"], "bbox 120 200 161 210; x_wconf 90"; got != want {
+		t.Errorf("ocrx_word title = %q, want %q", got, want)
+	}
+}
+
+func TestWriteALTO(t *testing.T) {
+	var out strings.Builder
+	if err := writeALTO(&out, groupFixture, 400, 300, defaultGroupTolerance); err != nil {
+		t.Fatalf("writeALTO() error = %v", err)
+	}
+
+	var doc altoDocument
+	if err := xml.Unmarshal([]byte(out.String()), &doc); err != nil {
+		t.Fatalf("ALTO output is not valid XML: %v\n%s", err, out.String())
+	}
+	if doc.XMLName.Space != "http://www.loc.gov/standards/alto/ns-v4#" {
+		t.Errorf("ALTO namespace = %q", doc.XMLName.Space)
+	}
+	if doc.Page.Width != 400 || doc.Page.Height != 300 {
+		t.Errorf("Page size = %dx%d, want 400x300", doc.Page.Width, doc.Page.Height)
+	}
+
+	var contents []string
+	for _, block := range doc.Page.Space.Blocks {
+		for _, line := range block.Lines {
+			for _, s := range line.Strings {
+				contents = append(contents, s.Content)
+				if s.Content == "world" && (s.altoRect != altoRect{HPos: 35, VPos: 1, Width: 35, Height: 10} || s.Confidence != "0.90") {
+					t.Errorf("String %q = %+v", s.Content, s)
+				}
+			}
+		}
+	}
+	if got, want := strings.Join(contents, " "), "Hello world second far footer"; got != want {
+		t.Errorf("ALTO strings = %q, want %q", got, want)
+	}
+}
+
+func TestHandleOCRDocumentFormats(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, bottomFirstOCRScript), 0)
+
+	tests := []struct {
+		format      string
+		contentType string
+		contains    string
+	}{
+		{"hocr", "text/html", "class='ocrx_word'"},
+		{"alto", "application/xml", "<String "},
+	}
+	for _, tt := range tests {
+		rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 40, 60), map[string]string{"format": tt.format}))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("format=%s: status = %d, body: %s", tt.format, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+			t.Errorf("format=%s: Content-Type = %q, want %s", tt.format, got, tt.contentType)
+		}
+		if body := rec.Body.String(); !strings.Contains(body, tt.contains) || !strings.Contains(body, "top") {
+			t.Errorf("format=%s: unexpected body:\n%s", tt.format, body)
+		}
+	}
+
+	for _, params := range []map[string]string{
+		{"format": "pdf"},
+		{"format": "hocr", "output": "text"},
+		{"format": "alto", "coords": "normalized"},
+	} {
+		rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 40, 60), params))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, want %d", params, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
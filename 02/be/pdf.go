@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// pageResult là kết quả OCR của một trang PDF
+type pageResult struct {
+	Page    int         `json:"page"`
+	Results []OCRResult `json:"results"`
+}
+
+// pdfPageSize là số pixel tối đa của cạnh dài mỗi trang PDF sau khi render,
+// để trang có kích thước khổng lồ không chiếm hết bộ nhớ, khoảng 240 dpi với trang A4
+const pdfPageSize = 2800
+
+// rasterizePDF chuyển từng trang PDF thành ảnh PNG trong outDir bằng công cụ cấu hình (mặc định pdftoppm)
+// Chỉ render tối đa MaxPDFPages+1 trang để phát hiện file vượt giới hạn mà không tốn công render hết
+// Việc render giữ một slot của -max-concurrency và bị kill khi quá OCRTimeout hoặc client ngắt kết nối
+func (s *server) rasterizePDF(ctx context.Context, pdfPath, outDir string) ([]string, error) {
+	if s.concurrency != nil {
+		if err := s.concurrency.acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer s.concurrency.release()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.OCRTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.cfg.PDFTool,
+		"-png",
+		"-scale-to", strconv.Itoa(pdfPageSize),
+		"-f", "1",
+		"-l", strconv.Itoa(s.cfg.MaxPDFPages+1),
+		pdfPath,
+		filepath.Join(outDir, "page"),
+	)
+	// Không chờ mãi nếu tiến trình con còn giữ output sau khi công cụ bị kill
+	cmd.WaitDelay = time.Second
+
+	out, err := cmd.CombinedOutput()
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return nil, errOCRTimeout
+	case context.Canceled:
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error rasterizing PDF with %s: %v - %s", s.cfg.PDFTool, err, out)
+	}
+
+	pages, err := filepath.Glob(filepath.Join(outDir, "page*.png"))
+	if err != nil {
+		return nil, err
+	}
+
+	// pdftoppm đánh số trang với cùng độ dài nên sắp xếp theo tên là đúng thứ tự trang
+	sort.Strings(pages)
+	return pages, nil
+}
+
+// handlePDF render từng trang PDF thành ảnh rồi OCR lần lượt, kết quả được nhóm theo trang
+// min_confidence và limit được áp dụng trên từng trang
+func (s *server) handlePDF(w http.ResponseWriter, r *http.Request, upload *ocrUpload, opts outputOptions) {
+	if err := checkPagedOptions(opts, "PDF documents"); err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	outDir, err := os.MkdirTemp(filepath.Dir(upload.path), pdfTempPrefix)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Error creating temporary directory: "+err.Error())
+		return
+	}
+	defer os.RemoveAll(outDir)
+
+	pages, err := s.rasterizePDF(r.Context(), upload.path, outDir)
+	if errors.Is(err, errOCRTimeout) || errors.Is(err, errOCRBusy) || errors.Is(err, context.Canceled) {
+		s.writeOCRError(w, r, "Error rasterizing PDF", err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if len(pages) > s.cfg.MaxPDFPages {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("PDF has more than %d pages", s.cfg.MaxPDFPages))
+		return
+	}
+
+	results := make([]pageResult, 0, len(pages))
+	truncated := false
+	for i, page := range pages {
+		pageOCR, err := s.processPaddleOCR(r.Context(), page, upload.maxWidth, upload.maxHeight, upload.lang)
+		if err != nil {
+			s.writeOCRError(w, r, fmt.Sprintf("Error processing PDF page %d with PaddleOCR", i+1), err)
+			return
+		}
+		pageOCR, pageTruncated := applyPageOptions(pageOCR, opts)
+		truncated = truncated || pageTruncated
+		results = append(results, pageResult{Page: i + 1, Results: pageOCR})
+	}
+	if truncated {
+		w.Header().Set("X-OCR-Truncated", "true")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
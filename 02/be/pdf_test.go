@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePDFTool giả lập pdftoppm: đếm số trang trong PDF và ghi mỗi trang ra một file PNG
+const fakePDFTool = `#!/usr/bin/env python3
+import re, sys
+
+args = sys.argv[1:]
+last = int(args[args.index("-l") + 1])
+pdf_path, prefix = args[-2], args[-1]
+
+pages = len(re.findall(rb"/Type\s*/Page\b", open(pdf_path, "rb").read()))
+for i in range(1, min(pages, last) + 1):
+    with open("%s-%d.png" % (prefix, i), "wb") as f:
+        f.write(b"page %d" % i)
+`
+
+// newPDFTestServer tạo server dùng script OCR và công cụ render PDF giả lập
+func newPDFTestServer(t *testing.T, maxPages int) *server {
+	t.Helper()
+
+	tool := filepath.Join(t.TempDir(), "fake_pdftoppm")
+	if err := os.WriteFile(tool, []byte(fakePDFTool), 0755); err != nil {
+		t.Fatalf("Failed to write fake PDF tool: %v", err)
+	}
+
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+	srv.cfg.PDFTool = tool
+	srv.cfg.MaxPDFPages = maxPages
+	return srv
+}
+
+func TestHandleOCRMultiPagePDF(t *testing.T) {
+	pdf, err := os.ReadFile("testdata/two_pages.pdf")
+	if err != nil {
+		t.Fatalf("Failed to read PDF fixture: %v", err)
+	}
+
+	srv := newPDFTestServer(t, 20)
+	rec := serveOCR(srv, newUploadRequest(t, "document.pdf", pdf, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var pages []pageResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &pages); err != nil {
+		t.Fatalf("Cannot decode page results: %v", err)
+	}
+
+	if len(pages) != 2 {
+		t.Fatalf("Pages = %d, want 2", len(pages))
+	}
+	for i, page := range pages {
+		if page.Page != i+1 {
+			t.Errorf("Page index = %d, want %d", page.Page, i+1)
+		}
+		if len(page.Results) != 1 || page.Results[0].Text != fmt.Sprintf("page-%d.png", i+1) {
+			t.Errorf("Page %d results = %+v", page.Page, page.Results)
+		}
+	}
+}
+
+func TestHandleOCRPDFPageLimit(t *testing.T) {
+	pdf, err := os.ReadFile("testdata/two_pages.pdf")
+	if err != nil {
+		t.Fatalf("Failed to read PDF fixture: %v", err)
+	}
+
+	srv := newPDFTestServer(t, 1)
+	rec := serveOCR(srv, newUploadRequest(t, "document.pdf", pdf, nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleOCRPDFOutputOptions(t *testing.T) {
+	pdf, err := os.ReadFile("testdata/two_pages.pdf")
+	if err != nil {
+		t.Fatalf("Failed to read PDF fixture: %v", err)
+	}
+
+	srv := newPDFTestServer(t, 20)
+	srv.cfg.ScriptPath = writeStubScript(t, multiBoxOCRScript)
+
+	// min_confidence và limit được áp dụng trên từng trang
+	rec := serveOCR(srv, newUploadRequest(t, "document.pdf", pdf, map[string]string{"min_confidence": "0.6", "limit": "1"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	var pages []pageResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &pages); err != nil || len(pages) != 2 {
+		t.Fatalf("Response = %s, want 2 pages", rec.Body.String())
+	}
+	for _, page := range pages {
+		if len(page.Results) != 1 || page.Results[0].Text != "second" {
+			t.Errorf("Page %d results = %+v, want only the most confident box", page.Page, page.Results)
+		}
+	}
+	if rec.Header().Get("X-OCR-Truncated") != "true" {
+		t.Error("X-OCR-Truncated header missing after limiting page results")
+	}
+
+	// Các tùy chọn chưa hỗ trợ cho PDF bị từ chối thay vì bị bỏ qua
+	for _, fields := range []map[string]string{{"output": "text"}, {"format": "hocr"}, {"coords": "normalized"}, {"group": "lines"}, {"stats": "true"}} {
+		rec := serveOCR(srv, newUploadRequest(t, "document.pdf", pdf, fields))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Options %v: status = %d, want %d", fields, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestHandleOCRPDFRasterizeTimeout(t *testing.T) {
+	pdf, err := os.ReadFile("testdata/two_pages.pdf")
+	if err != nil {
+		t.Fatalf("Failed to read PDF fixture: %v", err)
+	}
+
+	// Công cụ render bị treo ghi lại tham số rồi chờ rất lâu
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "hanging_pdftoppm")
+	script := "#!/bin/sh\necho \"$@\" > '" + filepath.Join(dir, "args") + "'\nsleep 30\n"
+	if err := os.WriteFile(tool, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write hanging PDF tool: %v", err)
+	}
+	srv := newPDFTestServer(t, 20)
+	srv.cfg.PDFTool = tool
+	srv.cfg.OCRTimeout = 200 * time.Millisecond
+
+	start := time.Now()
+	rec := serveOCR(srv, newUploadRequest(t, "document.pdf", pdf, nil))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Request took %v, want about the timeout", elapsed)
+	}
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("Status = %d, want %d, body: %s", rec.Code, http.StatusGatewayTimeout, rec.Body.String())
+	}
+
+	// Kích thước trang được giới hạn thay vì render theo độ phân giải
+	if args, _ := os.ReadFile(filepath.Join(dir, "args")); !strings.Contains(string(args), fmt.Sprintf("-scale-to %d", pdfPageSize)) {
+		t.Errorf("PDF tool arguments = %q, want -scale-to %d", args, pdfPageSize)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// outputOptions là các tham số điều chỉnh kết quả OCR trước khi trả về client
+type outputOptions struct {
+	// normalizedCoords chia tọa độ cho kích thước ảnh lúc OCR để nhận giá trị trong [0,1],
+	// gốc (0,0) ở góc trên bên trái, (1,1) ở góc dưới bên phải giống tọa độ pixel
+	normalizedCoords bool
+	// originalCoords nhân tọa độ pixel theo tỷ lệ để khớp với kích thước ảnh upload thay vì ảnh lúc OCR
+	originalCoords bool
+	// group là cách nhóm box: rỗng (không nhóm), "lines" hoặc "paragraphs"
+	group string
+	// groupTolerance là khoảng cách tối đa khi nhóm, tính theo bội số chiều cao dòng
+	groupTolerance float64
+	// limit là số kết quả tối đa trả về (tham số limit hoặc max_results), 0 là không giới hạn
+	limit int
+	// limitBy là cách chọn kết quả khi cắt bớt: "confidence" hoặc "order"
+	limitBy string
+	// minConfidence là độ tin cậy tối thiểu trong [0,1], 0 là không lọc
+	minConfidence float64
+	// plainText trả về text/plain theo thứ tự đọc thay vì JSON
+	plainText bool
+	// format là định dạng tài liệu chuẩn thay cho JSON: rỗng, "hocr" hoặc "alto"
+	format string
+	// stats thêm thống kê độ tin cậy vào response JSON
+	stats bool
+}
+
+// parseOutputOptions đọc và kiểm tra các tham số định dạng kết quả từ request
+func parseOutputOptions(r *http.Request) (outputOptions, error) {
+	opts := outputOptions{groupTolerance: defaultGroupTolerance}
+
+	switch coords := r.FormValue("coords"); coords {
+	case "", "pixel":
+	case "normalized":
+		opts.normalizedCoords = true
+	default:
+		return opts, &requestError{http.StatusBadRequest, fmt.Sprintf("Invalid coords value %q, expected pixel or normalized", coords)}
+	}
+
+	// Mặc định giữ tọa độ theo ảnh lúc OCR để không ảnh hưởng client đang tự scale bằng width/height
+	switch space := r.FormValue("coords_space"); space {
+	case "", "resized":
+	case "original":
+		opts.originalCoords = true
+	default:
+		return opts, &requestError{http.StatusBadRequest, fmt.Sprintf("Invalid coords_space value %q, expected resized or original", space)}
+	}
+
+	switch opts.group = r.FormValue("group"); opts.group {
+	case "", "lines", "paragraphs":
+	default:
+		return opts, &requestError{http.StatusBadRequest, fmt.Sprintf("Invalid group value %q, expected lines or paragraphs", opts.group)}
+	}
+
+	if value := r.FormValue("group_tolerance"); value != "" {
+		tolerance, err := strconv.ParseFloat(value, 64)
+		if err != nil || tolerance < 0 {
+			return opts, &requestError{http.StatusBadRequest, fmt.Sprintf("Invalid group_tolerance value %q", value)}
+		}
+		opts.groupTolerance = tolerance
+	}
+
+	// max_results là tên khác của limit, gửi cả hai thì phải cùng giá trị
+	limitName, value := "limit", r.FormValue("limit")
+	if maxResults := r.FormValue("max_results"); maxResults != "" {
+		if value != "" && value != maxResults {
+			return opts, &requestError{http.StatusBadRequest, "limit and max_results must not differ"}
+		}
+		limitName, value = "max_results", maxResults
+	}
+	if value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return opts, &requestError{http.StatusBadRequest, fmt.Sprintf("Invalid %s value %q, expected a positive integer", limitName, value)}
+		}
+		opts.limit = limit
+	}
+
+	switch opts.limitBy = r.FormValue("limit_by"); opts.limitBy {
+	case "":
+		opts.limitBy = "confidence"
+	case "confidence", "order":
+	default:
+		return opts, &requestError{http.StatusBadRequest, fmt.Sprintf("Invalid limit_by value %q, expected confidence or order", opts.limitBy)}
+	}
+
+	switch output := r.FormValue("output"); output {
+	case "", "json":
+	case "text":
+		opts.plainText = true
+	default:
+		return opts, &requestError{http.StatusBadRequest, fmt.Sprintf("Invalid output value %q, expected json or text", output)}
+	}
+
+	switch opts.format = r.FormValue("format"); opts.format {
+	case "json":
+		opts.format = ""
+	case "", formatHOCR, formatALTO:
+	default:
+		return opts, &requestError{http.StatusBadRequest, fmt.Sprintf("Invalid format value %q, expected json, hocr or alto", opts.format)}
+	}
+	if opts.format != "" && opts.plainText {
+		return opts, &requestError{http.StatusBadRequest, "format and output=text cannot be combined"}
+	}
+	// hOCR và ALTO chỉ mô tả vị trí bằng pixel
+	if opts.format != "" && opts.normalizedCoords {
+		return opts, &requestError{http.StatusBadRequest, fmt.Sprintf("format=%s requires pixel coordinates", opts.format)}
+	}
+
+	switch stats := r.FormValue("stats"); stats {
+	case "", "false":
+	case "true":
+		opts.stats = true
+	default:
+		return opts, &requestError{http.StatusBadRequest, fmt.Sprintf("Invalid stats value %q, expected true or false", stats)}
+	}
+	// Thống kê chỉ có chỗ trong response JSON
+	if opts.stats && (opts.plainText || opts.format != "") {
+		return opts, &requestError{http.StatusBadRequest, "stats=true requires a JSON response"}
+	}
+
+	if value := r.FormValue("min_confidence"); value != "" {
+		minConfidence, err := strconv.ParseFloat(value, 64)
+		if err != nil || minConfidence < 0 || minConfidence > 1 {
+			return opts, &requestError{http.StatusBadRequest, fmt.Sprintf("Invalid min_confidence value %q, expected a number between 0 and 1", value)}
+		}
+		opts.minConfidence = minConfidence
+	}
+
+	return opts, nil
+}
+
+// checkPagedOptions từ chối các tùy chọn chưa áp dụng được khi kết quả được nhóm theo trang PDF hoặc frame
+// Các tùy chọn này cần kích thước hay bố cục của một ảnh duy nhất, document là tên loại tài liệu trong thông báo lỗi
+func checkPagedOptions(opts outputOptions, document string) error {
+	var unsupported []string
+	if opts.normalizedCoords {
+		unsupported = append(unsupported, "coords=normalized")
+	}
+	if opts.originalCoords {
+		unsupported = append(unsupported, "coords_space=original")
+	}
+	if opts.group != "" {
+		unsupported = append(unsupported, "group="+opts.group)
+	}
+	if opts.plainText {
+		unsupported = append(unsupported, "output=text")
+	}
+	if opts.format != "" {
+		unsupported = append(unsupported, "format="+opts.format)
+	}
+	if opts.stats {
+		unsupported = append(unsupported, "stats=true")
+	}
+	if len(unsupported) > 0 {
+		return &requestError{http.StatusBadRequest, fmt.Sprintf("%s not supported for %s", strings.Join(unsupported, ", "), document)}
+	}
+	return nil
+}
+
+// applyPageOptions lọc theo min_confidence rồi cắt theo limit trên kết quả của một trang hoặc frame
+func applyPageOptions(results []OCRResult, opts outputOptions) ([]OCRResult, bool) {
+	return limitResults(filterByConfidence(results, opts.minConfidence), opts.limit, opts.limitBy)
+}
+
+// filterByConfidence trả về các kết quả có độ tin cậy không nhỏ hơn minConfidence
+// Kết quả được chép sang slice mới vì slice gốc có thể đang nằm trong cache
+func filterByConfidence(results []OCRResult, minConfidence float64) []OCRResult {
+	if minConfidence <= 0 {
+		return results
+	}
+
+	filtered := make([]OCRResult, 0, len(results))
+	for _, result := range results {
+		if result.Confidence >= minConfidence {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+// normalizeCoords trả về bản sao kết quả với tọa độ được chia cho kích thước ảnh
+// Không sửa trực tiếp vì kết quả có thể đang nằm trong cache
+func normalizeCoords(results []OCRResult, width, height int) []OCRResult {
+	normalized := make([]OCRResult, len(results))
+	for i, result := range results {
+		coords := make([][2]float64, len(result.Coords))
+		for j, point := range result.Coords {
+			coords[j] = [2]float64{point[0] / float64(width), point[1] / float64(height)}
+		}
+		result.Coords = coords
+		normalized[i] = result
+	}
+	return normalized
+}
+
+// scaleCoords trả về bản sao kết quả với tọa độ được nhân theo tỷ lệ scaleX, scaleY
+func scaleCoords(results []OCRResult, scaleX, scaleY float64) []OCRResult {
+	scaled := make([]OCRResult, len(results))
+	for i, result := range results {
+		coords := make([][2]float64, len(result.Coords))
+		for j, point := range result.Coords {
+			coords[j] = [2]float64{point[0] * scaleX, point[1] * scaleY}
+		}
+		result.Coords = coords
+		scaled[i] = result
+	}
+	return scaled
+}
+
+// toOriginalCoords chuyển tọa độ từ ảnh lúc OCR (width x height) về ảnh upload
+func toOriginalCoords(results []OCRResult, upload *ocrUpload, width, height int) []OCRResult {
+	if width == upload.width && height == upload.height {
+		return results
+	}
+	return scaleCoords(results, float64(upload.width)/float64(width), float64(upload.height)/float64(height))
+}
+
+// limitResults cắt kết quả còn tối đa limit phần tử và cho biết có bị cắt hay không
+// Với limitBy "confidence" giữ lại các box có độ tin cậy cao nhất nhưng vẫn theo thứ tự đọc ban đầu,
+// với "order" giữ lại limit box đầu tiên
+func limitResults(results []OCRResult, limit int, limitBy string) ([]OCRResult, bool) {
+	if limit <= 0 || len(results) <= limit {
+		return results, false
+	}
+	if limitBy == "order" {
+		return results[:limit:limit], true
+	}
+
+	indexes := make([]int, len(results))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	slices.SortStableFunc(indexes, func(a, b int) int {
+		switch {
+		case results[a].Confidence > results[b].Confidence:
+			return -1
+		case results[a].Confidence < results[b].Confidence:
+			return 1
+		}
+		return 0
+	})
+	indexes = indexes[:limit]
+	slices.Sort(indexes)
+
+	limited := make([]OCRResult, limit)
+	for i, index := range indexes {
+		limited[i] = results[index]
+	}
+	return limited, true
+}
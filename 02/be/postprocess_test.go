@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestHandleOCRNormalizedCoords(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	// Script giả lập trả về box (0,0)-(10,10) trên ảnh 20x40
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 40), map[string]string{"coords": "normalized"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var results []OCRResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Cannot decode results: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("Results = %+v, want 1", results)
+	}
+
+	for _, point := range results[0].Coords {
+		if point[0] < 0 || point[0] > 1 || point[1] < 0 || point[1] > 1 {
+			t.Errorf("Point %v is outside [0,1]", point)
+		}
+	}
+	if got := results[0].Coords[2]; got != [2]float64{0.5, 0.25} {
+		t.Errorf("Bottom-right point = %v, want [0.5 0.25]", got)
+	}
+}
+
+func TestNormalizeCoordsCenter(t *testing.T) {
+	// Box 10x10 nằm giữa ảnh 200x100
+	normalized := normalizeCoords([]OCRResult{box("center", 95, 45, 105, 55)}, 200, 100)
+
+	center := resultBox(normalized[0])
+	x, y := (center[0]+center[2])/2, (center[1]+center[3])/2
+	if math.Abs(x-0.5) > 1e-9 || math.Abs(y-0.5) > 1e-9 {
+		t.Errorf("Center = (%v, %v), want (0.5, 0.5)", x, y)
+	}
+	if got := normalized[0].Coords[0]; got != [2]float64{0.475, 0.45} {
+		t.Errorf("Top-left point = %v, want [0.475 0.45]", got)
+	}
+}
+
+func TestHandleOCRNormalizedCoordsDoesNotModifyCache(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+	image := encodePNG(t, 20, 40)
+
+	serveOCR(srv, newUploadRequest(t, "image.png", image, map[string]string{"coords": "normalized"}))
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", image, nil))
+
+	var results []OCRResult
+	json.Unmarshal(rec.Body.Bytes(), &results)
+	if len(results) != 1 || results[0].Coords[2] != [2]float64{10, 10} {
+		t.Errorf("Cached pixel coordinates changed: %+v", results)
+	}
+}
+
+func TestScaleCoords(t *testing.T) {
+	results := []OCRResult{box("text", 10, 20, 110, 70)}
+
+	scaled := scaleCoords(results, 2, 1.5)
+	want := [][2]float64{{20, 30}, {220, 30}, {220, 105}, {20, 105}}
+	if !slices.Equal(scaled[0].Coords, want) {
+		t.Errorf("scaleCoords() = %v, want %v", scaled[0].Coords, want)
+	}
+	if results[0].Coords[0] != [2]float64{10, 20} {
+		t.Errorf("scaleCoords() modified its input: %v", results[0].Coords)
+	}
+}
+
+func TestHandleOCROriginalCoordsSpace(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	// Ảnh 1600x1200 được thu nhỏ còn 800x600, box (0,0)-(10,10) của script giả lập thành (0,0)-(20,20)
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 1600, 1200), map[string]string{"coords_space": "original"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var results []OCRResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Cannot decode results: %v", err)
+	}
+	if len(results) != 1 || results[0].Coords[2] != [2]float64{20, 20} {
+		t.Errorf("Results = %+v, want bottom-right point [20 20]", results)
+	}
+
+	// Mặc định vẫn trả về tọa độ theo ảnh lúc OCR
+	rec = serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 1600, 1200), nil))
+	json.Unmarshal(rec.Body.Bytes(), &results)
+	if len(results) != 1 || results[0].Coords[2] != [2]float64{10, 10} {
+		t.Errorf("Default results = %+v, want bottom-right point [10 10]", results)
+	}
+
+	rec = serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 40), map[string]string{"coords_space": "page"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Invalid coords_space status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestHandleOCRInvalidCoordsMode(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 40), map[string]string{"coords": "percent"}))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+// multiBoxOCRScript trả về ba box theo thứ tự đọc với độ tin cậy khác nhau
+const multiBoxOCRScript = `
+import sys, json
+boxes = [
+    {"coords": [[0, 0], [10, 0], [10, 10], [0, 10]], "text": "first", "confidence": 0.5},
+    {"coords": [[0, 20], [10, 20], [10, 30], [0, 30]], "text": "second", "confidence": 0.9},
+    {"coords": [[0, 40], [10, 40], [10, 50], [0, 50]], "text": "third", "confidence": 0.7},
+]
+print(json.dumps(boxes))
+`
+
+func TestLimitResults(t *testing.T) {
+	results := []OCRResult{
+		{Text: "first", Confidence: 0.5},
+		{Text: "second", Confidence: 0.9},
+		{Text: "third", Confidence: 0.7},
+	}
+
+	tests := []struct {
+		limit     int
+		limitBy   string
+		want      []string
+		truncated bool
+	}{
+		{0, "confidence", []string{"first", "second", "third"}, false},
+		{3, "confidence", []string{"first", "second", "third"}, false},
+		{2, "confidence", []string{"second", "third"}, true},
+		{2, "order", []string{"first", "second"}, true},
+		{1, "confidence", []string{"second"}, true},
+	}
+
+	for _, tt := range tests {
+		limited, truncated := limitResults(results, tt.limit, tt.limitBy)
+		var texts []string
+		for _, result := range limited {
+			texts = append(texts, result.Text)
+		}
+		if !slices.Equal(texts, tt.want) || truncated != tt.truncated {
+			t.Errorf("limitResults(%d, %q) = %v, %v, want %v, %v", tt.limit, tt.limitBy, texts, truncated, tt.want, tt.truncated)
+		}
+	}
+}
+
+func TestHandleOCRLimit(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, multiBoxOCRScript), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 60), map[string]string{"limit": "2", "verbose": "true"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("X-OCR-Truncated"); got != "true" {
+		t.Errorf("X-OCR-Truncated = %q, want true", got)
+	}
+
+	var response ocrResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Cannot decode response: %v", err)
+	}
+	if !response.Truncated {
+		t.Error("Truncated = false, want true")
+	}
+	if len(response.Results) != 2 || response.Results[0].Text != "second" || response.Results[1].Text != "third" {
+		t.Errorf("Results = %+v, want second and third", response.Results)
+	}
+
+	// Không vượt quá limit thì không đánh dấu bị cắt
+	rec = serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 60), map[string]string{"limit": "5"}))
+	if got := rec.Header().Get("X-OCR-Truncated"); got != "" {
+		t.Errorf("X-OCR-Truncated = %q, want empty", got)
+	}
+}
+
+func TestHandleOCRMaxResults(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, multiBoxOCRScript), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 60), map[string]string{"max_results": "2", "verbose": "true"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var response ocrResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Cannot decode response: %v", err)
+	}
+	// Hai box có độ tin cậy cao nhất (0.9 và 0.7) được giữ theo thứ tự đọc
+	if !response.Truncated || len(response.Results) != 2 || response.Results[0].Text != "second" || response.Results[1].Text != "third" {
+		t.Errorf("Response = %+v, want second and third with truncated set", response)
+	}
+
+	// Gửi cả limit và max_results cùng giá trị vẫn hợp lệ
+	rec = serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 60), map[string]string{"limit": "1", "max_results": "1"}))
+	var results []OCRResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || len(results) != 1 || results[0].Text != "second" {
+		t.Errorf("Response = %s, want only second", rec.Body.String())
+	}
+}
+
+func TestHandleOCRInvalidLimit(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, multiBoxOCRScript), 0)
+
+	for _, fields := range []map[string]string{{"limit": "0"}, {"limit": "-3"}, {"limit": "many"}, {"limit_by": "size"}, {"max_results": "0"}, {"limit": "1", "max_results": "2"}} {
+		rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 60), fields))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, want %d", fields, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestFilterByConfidence(t *testing.T) {
+	results := []OCRResult{
+		{Text: "low", Confidence: 0.2},
+		{Text: "edge", Confidence: 0.6},
+		{Text: "high", Confidence: 0.95},
+		{Text: "medium", Confidence: 0.59},
+	}
+
+	tests := []struct {
+		minConfidence float64
+		want          []string
+	}{
+		{0, []string{"low", "edge", "high", "medium"}},
+		{0.6, []string{"edge", "high"}},
+		{0.96, nil},
+	}
+
+	for _, tt := range tests {
+		var texts []string
+		for _, result := range filterByConfidence(results, tt.minConfidence) {
+			texts = append(texts, result.Text)
+		}
+		if !slices.Equal(texts, tt.want) {
+			t.Errorf("filterByConfidence(%v) = %v, want %v", tt.minConfidence, texts, tt.want)
+		}
+	}
+}
+
+func TestHandleOCRMinConfidence(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, multiBoxOCRScript), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 60), map[string]string{"min_confidence": "0.7"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var results []OCRResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatalf("Cannot decode results: %v", err)
+	}
+	if len(results) != 2 || results[0].Text != "second" || results[1].Text != "third" {
+		t.Errorf("Results = %+v, want second and third", results)
+	}
+}
+
+func TestHandleOCRInvalidMinConfidence(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, multiBoxOCRScript), 0)
+
+	for _, value := range []string{"-0.1", "1.5", "high"} {
+		rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 60), map[string]string{"min_confidence": value}))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("min_confidence=%s: status = %d, want %d", value, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
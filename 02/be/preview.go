@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"net/http"
+)
+
+// previewLabelPadding là khoảng đệm (pixel) quanh text của nhãn trên ảnh preview
+const previewLabelPadding = 1
+
+// resizeNearest thu nhỏ/phóng to ảnh về width x height bằng cách lấy điểm ảnh gần nhất
+func resizeNearest(src image.Image, width, height int) *image.RGBA {
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if bounds.Dx() == width && bounds.Dy() == height {
+		draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+		return dst
+	}
+
+	for y := 0; y < height; y++ {
+		sy := bounds.Min.Y + y*bounds.Dy()/height
+		for x := 0; x < width; x++ {
+			dst.Set(x, y, src.At(bounds.Min.X+x*bounds.Dx()/width, sy))
+		}
+	}
+	return dst
+}
+
+// drawLabels vẽ text và độ tin cậy của từng kết quả ngay phía trên box, hoặc bên trong box nếu box sát mép trên
+func drawLabels(img draw.Image, results []OCRResult, c color.RGBA) {
+	for _, result := range results {
+		box := pixelBox(resultBox(result))
+		label := fmt.Sprintf("%s %d%%", result.Text, int(math.Round(result.Confidence*100)))
+
+		height := glyphHeight + 2*previewLabelPadding
+		y := box[1] - height
+		if y < img.Bounds().Min.Y {
+			y = box[1]
+		}
+		background := image.Rect(box[0], y, box[0]+textWidth(label)+2*previewLabelPadding, y+height)
+		draw.Draw(img, background.Intersect(img.Bounds()), image.NewUniform(c), image.Point{}, draw.Src)
+		drawText(img, box[0]+previewLabelPadding, y+previewLabelPadding, label, contrastColor(c))
+	}
+}
+
+// contrastColor trả về đen hoặc trắng tùy độ sáng của nền để text dễ đọc
+func contrastColor(c color.RGBA) color.Color {
+	if 299*int(c.R)+587*int(c.G)+114*int(c.B) > 128*1000 {
+		return color.Black
+	}
+	return color.White
+}
+
+// handleOCRPreview chạy OCR rồi trả về ảnh PNG ở kích thước lúc OCR, có vẽ bounding box và text nhận diện được
+// Khác /ocr/annotate, ảnh được resize theo max_width/max_height nên Coords được vẽ đúng như PaddleOCR trả về
+func (s *server) handleOCRPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	upload, err := s.receiveUpload(w, r)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+	defer upload.remove()
+
+	opts, err := parseAnnotateOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	src, err := decodeUpload(upload)
+	if err != nil {
+		writeRequestError(w, err)
+		return
+	}
+
+	results, _, err := s.recognize(r.Context(), upload)
+	if err != nil {
+		s.writeOCRError(w, r, "Error processing image with PaddleOCR", err)
+		return
+	}
+
+	bounds := src.Bounds()
+	width, height := processedDimensions(bounds.Dx(), bounds.Dy(), upload.maxWidth, upload.maxHeight)
+	canvas := resizeNearest(src, width, height)
+	drawBoxes(canvas, results, 1, 1, opts)
+	drawLabels(canvas, results, opts.color)
+
+	setDimensionHeaders(w, upload)
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, canvas)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// servePreview gửi ảnh tới /ocr/preview và decode ảnh PNG trả về
+func servePreview(t *testing.T, srv *server, content []byte, fields map[string]string) image.Image {
+	t.Helper()
+
+	req := newUploadRequest(t, "image.png", content, fields)
+	req.URL.Path = "/ocr/preview"
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Content-Type = %q, want image/png", ct)
+	}
+
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatalf("Response is not a valid PNG: %v", err)
+	}
+	return img
+}
+
+func TestHandleOCRPreview(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	// Ảnh 1600x400 bị giới hạn bởi MAX_ALLOWED_DIMENSION nên preview có kích thước 800x200
+	img := servePreview(t, srv, encodePNG(t, 1600, 400), map[string]string{"max_width": "1600"})
+	if size := img.Bounds().Size(); size != image.Pt(800, 200) {
+		t.Errorf("Preview size = %v, want 800x200", size)
+	}
+
+	// Ảnh nhỏ giữ nguyên kích thước, nhãn của box (0,0)-(10,10) nằm trong box vì box sát mép trên
+	img = servePreview(t, srv, encodePNG(t, 120, 40), nil)
+	if size := img.Bounds().Size(); size != image.Pt(120, 40) {
+		t.Errorf("Preview size = %v, want 120x40", size)
+	}
+
+	red := color.RGBA{R: 255, A: 255}
+	if got := color.RGBAModel.Convert(img.At(0, 0)); got != red {
+		t.Errorf("Label background pixel = %v, want %v", got, red)
+	}
+	white := 0
+	for y := 0; y < glyphHeight+2; y++ {
+		for x := 0; x < 100; x++ {
+			if color.RGBAModel.Convert(img.At(x, y)) == (color.RGBA{255, 255, 255, 255}) {
+				white++
+			}
+		}
+	}
+	if white == 0 {
+		t.Error("Preview has no label text drawn")
+	}
+}
+
+func TestDrawText(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2*glyphAdvance, glyphHeight))
+	drawText(img, 0, 0, "Ii", color.White)
+
+	// Chữ "I": hàng trên và dưới có 3 pixel, cột giữa được tô kín
+	for x := 0; x < glyphWidth; x++ {
+		for _, offset := range []int{0, glyphAdvance} {
+			want := x >= 1 && x <= 3
+			if got := img.GrayAt(offset+x, 0).Y == 255; got != want {
+				t.Errorf("Pixel (%d,0) set = %v, want %v", offset+x, got, want)
+			}
+		}
+	}
+	for y := 0; y < glyphHeight; y++ {
+		if img.GrayAt(2, y).Y != 255 {
+			t.Errorf("Pixel (2,%d) not set", y)
+		}
+	}
+
+	if got := glyph('ư'); got != unknownGlyph {
+		t.Errorf("glyph('ư') = %v, want the unknown glyph", got)
+	}
+	if got, want := textWidth("abc"), 3*glyphAdvance-1; got != want {
+		t.Errorf("textWidth() = %d, want %d", got, want)
+	}
+}
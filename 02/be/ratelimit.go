@@ -0,0 +1,113 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRateLimitBuckets giới hạn số bucket giữ trong bộ nhớ trước khi dọn bớt các bucket đã đầy
+const maxRateLimitBuckets = 10000
+
+// tokenBucket lưu số token còn lại của một client
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter giới hạn số request theo từng IP bằng thuật toán token bucket
+type rateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+}
+
+// newRateLimiter tạo limiter cho phép rate request/giây với tối đa burst request dồn dập
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// allow lấy một token của client, nếu hết token thì trả về thời gian cần chờ
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateLimitBuckets {
+			l.prune(now)
+		}
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+
+	// Nạp lại token theo thời gian đã trôi qua
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// prune xóa các bucket đã được nạp đầy vì chúng không còn ảnh hưởng tới giới hạn, caller phải giữ mutex
+func (l *rateLimiter) prune(now time.Time) {
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientIP lấy IP của client, chỉ tin X-Forwarded-For khi server chạy sau proxy
+// Proxy nối IP nó thấy vào cuối header nên chỉ phần tử cuối cùng là đáng tin,
+// các phần tử phía trước do client tự gửi và có thể bị giả mạo
+func clientIP(r *http.Request, trustProxy bool) string {
+	if values := r.Header.Values("X-Forwarded-For"); trustProxy && len(values) > 0 {
+		entries := strings.Split(values[len(values)-1], ",")
+		if ip := strings.TrimSpace(entries[len(entries)-1]); net.ParseIP(ip) != nil {
+			return ip
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Middleware giới hạn tần suất request theo IP, trả về 429 kèm Retry-After khi vượt giới hạn
+func rateLimitMiddleware(limiter *rateLimiter, trustProxy bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if limiter == nil {
+			next(w, r)
+			return
+		}
+
+		allowed, wait := limiter.allow(clientIP(r, trustProxy))
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter := newRateLimiter(1, 3)
+	handler := rateLimitMiddleware(limiter, false, func(w http.ResponseWriter, r *http.Request) {})
+
+	var limited int
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/ocr", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if rec.Code == http.StatusTooManyRequests {
+			limited++
+			if rec.Header().Get("Retry-After") == "" {
+				t.Error("Expected Retry-After header on 429 response")
+			}
+		}
+	}
+
+	// Burst 3 nên 7 request còn lại bị chặn
+	if limited != 7 {
+		t.Errorf("Limited requests = %d, want 7", limited)
+	}
+
+	// IP khác có bucket riêng
+	req := httptest.NewRequest(http.MethodPost, "/ocr", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Other client status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimiterRefillsTokens(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(2, 1)
+	limiter.now = func() time.Time { return now }
+
+	if ok, _ := limiter.allow("client"); !ok {
+		t.Fatal("First request should be allowed")
+	}
+	if ok, wait := limiter.allow("client"); ok || wait <= 0 {
+		t.Fatalf("Second request should be limited with a positive wait, got allowed=%v wait=%v", ok, wait)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := limiter.allow("client"); !ok {
+		t.Error("Request should be allowed after the bucket refills")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ocr", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	// Phần tử đầu do client gửi, proxy nối IP thật của client vào cuối
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+
+	if ip := clientIP(req, false); ip != "10.0.0.1" {
+		t.Errorf("clientIP() without proxy = %s, want 10.0.0.1", ip)
+	}
+	if ip := clientIP(req, true); ip != "203.0.113.7" {
+		t.Errorf("clientIP() behind proxy = %s, want 203.0.113.7", ip)
+	}
+
+	// Giá trị cuối không phải IP thì dùng địa chỉ kết nối
+	req.Header.Set("X-Forwarded-For", "203.0.113.7, unknown")
+	if ip := clientIP(req, true); ip != "10.0.0.1" {
+		t.Errorf("clientIP() with an invalid forwarded entry = %s, want 10.0.0.1", ip)
+	}
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	limiter := newRateLimiter(1, 1)
+	handler := rateLimitMiddleware(limiter, true, func(w http.ResponseWriter, r *http.Request) {})
+
+	// Mỗi request gửi phần tử đầu khác nhau nhưng proxy vẫn nối cùng IP client
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/ocr", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d, 203.0.113.7", i))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		want := http.StatusOK
+		if i > 0 {
+			want = http.StatusTooManyRequests
+		}
+		if rec.Code != want {
+			t.Errorf("Request %d status = %d, want %d", i, rec.Code, want)
+		}
+	}
+	if n := len(limiter.buckets); n != 1 {
+		t.Errorf("Buckets = %d, want 1 for the single client", n)
+	}
+}
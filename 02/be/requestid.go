@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// requestIDHeader là header chứa request ID gửi lên và trả về cho client
+const requestIDHeader = "X-Request-ID"
+
+// requestIDKey là key lưu request ID trong context
+type requestIDKey struct{}
+
+// newRequestID tạo UUID v4 ngẫu nhiên
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// maxRequestIDLength là độ dài tối đa của request ID nhận từ client
+const maxRequestIDLength = 128
+
+// validRequestID chỉ chấp nhận ID ngắn gồm ký tự an toàn để client không chèn nội dung lạ vào log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestID lấy request ID từ context, trả về "-" nếu không có
+func requestID(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return "-"
+}
+
+// Middleware gán request ID cho mỗi request (dùng lại X-Request-ID của client nếu hợp lệ)
+// và trả ID về qua response header để đối chiếu với log
+func requestIDMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		next(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDRoundTrip(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+	handler := srv.routes()
+
+	req := newUploadRequest(t, "image.png", encodePNG(t, 10, 10), nil)
+	req.Header.Set(requestIDHeader, "client-id-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(requestIDHeader); got != "client-id-123" {
+		t.Errorf("%s = %q, want client-id-123", requestIDHeader, got)
+	}
+
+	content := readLog(t, srv.logger)
+	for _, line := range []string{"Uploaded File", "POST /ocr 200"} {
+		if !strings.Contains(content, "[client-id-123] "+line) {
+			t.Errorf("Log line %q missing request ID, got:\n%s", line, content)
+		}
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	handler := requestIDMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if requestID(r.Context()) != w.Header().Get(requestIDHeader) {
+			t.Error("Context request ID differs from response header")
+		}
+	})
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, incoming := range []string{"", "bad id with spaces", strings.Repeat("a", 200)} {
+		req := httptest.NewRequest(http.MethodGet, "/ocr", nil)
+		if incoming != "" {
+			req.Header.Set(requestIDHeader, incoming)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if got := rec.Header().Get(requestIDHeader); !uuid.MatchString(got) {
+			t.Errorf("Incoming %q: generated ID %q is not a UUID v4", incoming, got)
+		}
+	}
+}
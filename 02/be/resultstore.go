@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// resultIDHeader là header trả về ID của kết quả đã lưu để client lấy lại qua /results/{id}
+const resultIDHeader = "X-OCR-Result-ID"
+
+// storedResult là kết quả OCR được lưu lại để kiểm tra về sau
+type storedResult struct {
+	ID        string `json:"id"`
+	RequestID string `json:"request_id"`
+	// Hash là SHA-256 của file upload, dạng hex
+	Hash      string      `json:"hash"`
+	Lang      string      `json:"lang,omitempty"`
+	MaxWidth  int         `json:"max_width"`
+	MaxHeight int         `json:"max_height"`
+	CreatedAt time.Time   `json:"created_at"`
+	Results   []OCRResult `json:"results"`
+}
+
+// resultStore lưu mỗi kết quả OCR thành một file JSON <id>.json trong dir
+type resultStore struct {
+	dir string
+}
+
+// newResultStore tạo thư mục lưu kết quả nếu chưa có
+func newResultStore(dir string) (*resultStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create results directory %s: %v", dir, err)
+	}
+	return &resultStore{dir: dir}, nil
+}
+
+// resultHashBytes là số byte đầu của hash ảnh được ghép vào ID kết quả
+const resultHashBytes = 8
+
+// resultID ghép request ID với phần đầu hash của ảnh để ID vừa duy nhất vừa cho biết ảnh nào
+// Request ID bị cắt bớt để ID ghép vẫn không dài quá maxRequestIDLength và qua được validRequestID
+func resultID(reqID string, hash []byte) string {
+	// Request ngoài middleware không có ID thì tạo ID mới để các kết quả không ghi đè nhau
+	if reqID == "-" {
+		reqID = newRequestID()
+	}
+	if len(hash) > resultHashBytes {
+		hash = hash[:resultHashBytes]
+	}
+	if maxPrefix := maxRequestIDLength - 1 - 2*resultHashBytes; len(reqID) > maxPrefix {
+		reqID = reqID[:maxPrefix]
+	}
+	return reqID + "_" + hex.EncodeToString(hash)
+}
+
+// path trả về file của kết quả, ID chỉ gồm ký tự an toàn nên không thể trỏ ra ngoài dir
+func (s *resultStore) path(id string) (string, bool) {
+	if !validRequestID(id) {
+		return "", false
+	}
+	return filepath.Join(s.dir, id+".json"), true
+}
+
+// save ghi kết quả vào file tạm rồi đổi tên để không bao giờ đọc phải file ghi dở
+func (s *resultStore) save(result storedResult) error {
+	path, ok := s.path(result.ID)
+	if !ok {
+		return fmt.Errorf("invalid result ID %q", result.ID)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".result_")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// load đọc kết quả đã lưu, ok là false nếu không có kết quả với ID này
+func (s *resultStore) load(id string) (result storedResult, ok bool, err error) {
+	path, valid := s.path(id)
+	if !valid {
+		return result, false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return result, false, nil
+	}
+	if err != nil {
+		return result, false, err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, false, fmt.Errorf("corrupt result file %s: %v", path, err)
+	}
+	return result, true, nil
+}
+
+// storeResult lưu kết quả OCR nếu bật lưu trữ và trả ID qua header X-OCR-Result-ID
+// Lưu lỗi chỉ được ghi log, request vẫn thành công
+// Chỉ kết quả của ảnh một frame được lưu, PDF và ảnh nhiều frame trả kết quả theo trang không có trong storedResult
+func (s *server) storeResult(w http.ResponseWriter, r *http.Request, upload *ocrUpload, results []OCRResult) {
+	if s.results == nil {
+		return
+	}
+
+	reqID := requestID(r.Context())
+	result := storedResult{
+		ID:        resultID(reqID, upload.hash),
+		RequestID: reqID,
+		Hash:      hex.EncodeToString(upload.hash),
+		Lang:      upload.lang,
+		MaxWidth:  upload.maxWidth,
+		MaxHeight: upload.maxHeight,
+		CreatedAt: time.Now().UTC(),
+		Results:   results,
+	}
+	if err := s.results.save(result); err != nil {
+		s.logger.Error("[%s] Failed to store OCR result: %v", reqID, err)
+		return
+	}
+	w.Header().Set(resultIDHeader, result.ID)
+}
+
+// handleStoredResult trả về kết quả OCR đã lưu theo ID
+func (s *server) handleStoredResult(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if s.results == nil {
+		writeError(w, http.StatusNotFound, "Result storage is disabled")
+		return
+	}
+
+	result, ok, err := s.results.load(r.PathValue("id"))
+	if err != nil {
+		s.logger.Error("[%s] Failed to load stored result: %v", requestID(r.Context()), err)
+		writeError(w, http.StatusInternalServerError, "Error reading stored result")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "Result not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// getStoredResult gọi GET /results/{id} qua routes để PathValue được gán
+func getStoredResult(srv *server, id string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/results/"+id, nil))
+	return rec
+}
+
+func TestStoredResultRoundTrip(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+	store, err := newResultStore(filepath.Join(t.TempDir(), "results"))
+	if err != nil {
+		t.Fatalf("newResultStore() error = %v", err)
+	}
+	srv.results = store
+
+	req := newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{"lang": "en"})
+	req.URL.Path = "/ocr"
+	req.Header.Set(requestIDHeader, "audit-1")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	id := rec.Header().Get(resultIDHeader)
+	if filepath.Dir(id) != "." || len(id) <= len("audit-1_") || id[:len("audit-1_")] != "audit-1_" {
+		t.Fatalf("%s = %q, want an ID starting with the request ID", resultIDHeader, id)
+	}
+
+	rec = getStoredResult(srv, id)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /results/%s status = %d, body: %s", id, rec.Code, rec.Body.String())
+	}
+	var stored storedResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &stored); err != nil {
+		t.Fatalf("Cannot decode stored result: %v", err)
+	}
+	if stored.ID != id || stored.RequestID != "audit-1" || stored.Lang != "en" || len(stored.Hash) != 64 ||
+		len(stored.Results) != 1 || stored.CreatedAt.IsZero() {
+		t.Errorf("Stored result = %+v", stored)
+	}
+
+	for _, missing := range []string{"unknown", "..%2Fconfig", "bad%20id"} {
+		if rec := getStoredResult(srv, missing); rec.Code != http.StatusNotFound {
+			t.Errorf("GET /results/%s status = %d, want %d", missing, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestStoredResultLongRequestID(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+	store, err := newResultStore(filepath.Join(t.TempDir(), "results"))
+	if err != nil {
+		t.Fatalf("newResultStore() error = %v", err)
+	}
+	srv.results = store
+
+	// Request ID dài nhất được chấp nhận vẫn cho ra ID kết quả hợp lệ
+	reqID := strings.Repeat("a", maxRequestIDLength)
+	req := newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil)
+	req.URL.Path = "/ocr"
+	req.Header.Set(requestIDHeader, reqID)
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+
+	id := rec.Header().Get(resultIDHeader)
+	if id == "" || len(id) > maxRequestIDLength || !validRequestID(id) {
+		t.Fatalf("%s = %q, want a valid ID for a %d character request ID", resultIDHeader, id, len(reqID))
+	}
+	rec = getStoredResult(srv, id)
+	var stored storedResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &stored); rec.Code != http.StatusOK || err != nil || stored.RequestID != reqID {
+		t.Errorf("GET /results/%s = %d %s, want the result with the full request ID", id, rec.Code, rec.Body.String())
+	}
+}
+
+func TestStoreResultFailureDoesNotFailRequest(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	// Thư mục lưu là một file thường nên mọi lần ghi đều lỗi
+	notDir := filepath.Join(t.TempDir(), "results")
+	os.WriteFile(notDir, nil, 0644)
+	srv.results = &resultStore{dir: notDir}
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if id := rec.Header().Get(resultIDHeader); id != "" {
+		t.Errorf("%s = %q, want empty when storing failed", resultIDHeader, id)
+	}
+}
+
+func TestStoredResultDisabled(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil))
+	if id := rec.Header().Get(resultIDHeader); id != "" {
+		t.Errorf("%s = %q, want empty when storage is disabled", resultIDHeader, id)
+	}
+	if rec := getStoredResult(srv, "anything"); rec.Code != http.StatusNotFound {
+		t.Errorf("Status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
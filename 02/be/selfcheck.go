@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// selfCheckTimeout là thời gian tối đa cho lần kiểm tra môi trường Python, gồm cả thời gian import paddleocr
+const selfCheckTimeout = 2 * time.Minute
+
+// runSelfCheck chạy "python <script> --selfcheck" để chắc chắn trình thông dịch và các thư viện của script dùng được
+// Lỗi được phân loại theo stderr giống lỗi OCR để log chỉ rõ nguyên nhân, ví dụ thiếu module
+func runSelfCheck(ctx context.Context, cfg Config) error {
+	if _, err := exec.LookPath(cfg.Python); err != nil {
+		return fmt.Errorf("python interpreter not found: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, selfCheckTimeout)
+	defer cancel()
+
+	cmd := cfg.pythonCommand(ctx, "--selfcheck")
+	cmd.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("python environment check did not finish within %v", selfCheckTimeout)
+	}
+	if err != nil {
+		oe := newOCRError(err, stderr.String())
+		if oe.detail == "" {
+			return fmt.Errorf("python environment check failed: %v", err)
+		}
+		return fmt.Errorf("python environment check failed (%s): %s", oe.kind, oe.detail)
+	}
+	return nil
+}
+
+// selfCheck kiểm tra môi trường Python và lưu kết quả để /ready báo lỗi cho tới lần kiểm tra thành công tiếp theo
+func (s *server) selfCheck() error {
+	err := runSelfCheck(context.Background(), s.cfg)
+
+	s.selfCheckMu.Lock()
+	s.selfCheckErr = err
+	s.selfCheckMu.Unlock()
+	return err
+}
+
+// lastSelfCheck trả về lỗi của lần kiểm tra môi trường gần nhất, nil nếu chưa kiểm tra hoặc thành công
+func (s *server) lastSelfCheck() error {
+	s.selfCheckMu.Lock()
+	defer s.selfCheckMu.Unlock()
+	return s.selfCheckErr
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// selfCheckOCRScript giả lập ocr.py hỗ trợ --selfcheck, STUB_BROKEN làm giả môi trường thiếu paddleocr
+const selfCheckOCRScript = `
+import sys, os, json
+
+if os.environ.get("STUB_BROKEN"):
+    print("Traceback (most recent call last):", file=sys.stderr)
+    print("ModuleNotFoundError: No module named 'paddleocr'", file=sys.stderr)
+    sys.exit(1)
+
+if sys.argv[1] == "--selfcheck":
+    print(json.dumps({"status": "ok"}))
+    sys.exit(0)
+`
+
+func TestSelfCheck(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, selfCheckOCRScript), 0)
+
+	if err := srv.selfCheck(); err != nil {
+		t.Fatalf("selfCheck() error = %v, want nil for a healthy environment", err)
+	}
+	if status, _ := getHealth(t, srv, "/ready"); status != http.StatusOK {
+		t.Errorf("/ready status = %d after a passing self-check, want %d", status, http.StatusOK)
+	}
+
+	t.Setenv("STUB_BROKEN", "1")
+	err := srv.selfCheck()
+	if err == nil || !strings.Contains(err.Error(), ocrErrorMissingDependency) || !strings.Contains(err.Error(), "No module named 'paddleocr'") {
+		t.Fatalf("selfCheck() error = %v, want a missing dependency error", err)
+	}
+
+	status, resp := getHealth(t, srv, "/ready")
+	if status != http.StatusServiceUnavailable {
+		t.Fatalf("/ready status = %d after a failed self-check, want %d", status, http.StatusServiceUnavailable)
+	}
+	if !strings.Contains(resp.Error, "python environment check failed") {
+		t.Errorf("/ready error = %q, want the self-check error", resp.Error)
+	}
+}
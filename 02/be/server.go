@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"logger"
+)
+
+// server gom các thành phần dùng chung của OCR server
+type server struct {
+	cfg    Config
+	logger *logger.Logger
+	// pool là nil khi chạy script Python mới cho mỗi request
+	pool *workerPool
+	// cache là nil khi cache kết quả bị tắt
+	cache *resultCache
+	// results là nil khi không lưu kết quả OCR xuống đĩa
+	results *resultStore
+	// jobs lưu trạng thái các job OCR bất đồng bộ
+	jobs *jobStore
+	// limiter là nil khi không giới hạn tần suất request
+	limiter *rateLimiter
+	// metrics là các chỉ số xuất ra ở /metrics
+	metrics *metrics
+	// concurrency là nil khi không giới hạn số lần OCR chạy đồng thời
+	concurrency *concurrencyLimiter
+	// stopSweep dừng goroutine dọn thư mục tạm định kỳ, nil khi không dọn định kỳ
+	stopSweep chan struct{}
+	// background đếm các job OCR bất đồng bộ đang chạy để chờ chúng xong khi tắt server
+	background sync.WaitGroup
+	// selfCheckErr là lỗi của lần kiểm tra môi trường Python gần nhất, được /ready trả về
+	selfCheckMu  sync.Mutex
+	selfCheckErr error
+}
+
+// newServer tạo server và khởi động pool worker Python nếu được cấu hình
+func newServer(cfg Config, l *logger.Logger) (*server, error) {
+	if err := prepareTempDir(cfg.TempDir); err != nil {
+		return nil, err
+	}
+
+	s := &server{
+		cfg:     cfg,
+		logger:  l,
+		jobs:    newJobStore(cfg.JobTTL, cfg.MaxPendingJobs),
+		metrics: newMetrics(),
+	}
+
+	// File còn sót lại từ lần chạy trước bị crash được dọn ngay khi khởi động
+	s.sweepStaleTempFiles(time.Now())
+	if cfg.TempSweepInterval > 0 {
+		s.stopSweep = make(chan struct{})
+		go s.sweepTempDirPeriodically(cfg.TempSweepInterval, s.stopSweep)
+	}
+
+	if cfg.RateLimit > 0 {
+		s.limiter = newRateLimiter(cfg.RateLimit, cfg.RateBurst)
+	}
+
+	if cfg.MaxConcurrency > 0 {
+		s.concurrency = newConcurrencyLimiter(cfg.MaxConcurrency, cfg.MaxQueue, cfg.QueueTimeout)
+	}
+
+	if cfg.CacheSize > 0 {
+		s.cache = newResultCache(cfg.CacheSize, cfg.CacheTTL)
+	}
+
+	if cfg.ResultsDir != "" {
+		results, err := newResultStore(cfg.ResultsDir)
+		if err != nil {
+			return nil, err
+		}
+		s.results = results
+	}
+
+	if cfg.Workers > 0 {
+		pool, err := newWorkerPool(cfg, cfg.Workers, l)
+		if err != nil {
+			return nil, err
+		}
+		s.pool = pool
+	}
+
+	return s, nil
+}
+
+// prepareTempDir tạo thư mục tạm nếu chưa có và kiểm tra có ghi được không
+func prepareTempDir(dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create temp directory %s: %v", dir, err)
+	}
+
+	probe, err := os.CreateTemp(dir, ".probe_")
+	if err != nil {
+		return fmt.Errorf("temp directory %s is not writable: %v", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// routes đăng ký các endpoint của server
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+
+	// Sử dụng middleware CORS, giới hạn tần suất, xác thực, nén gzip và ghi access log cho mọi request
+	handle := func(pattern string, handler http.HandlerFunc) {
+		handler = gzipMiddleware(handler)
+		handler = authMiddleware(s.cfg.APIKeys, handler)
+		handler = rateLimitMiddleware(s.limiter, s.cfg.TrustProxy, handler)
+		handler = metricsMiddleware(s.metrics, handler)
+		mux.HandleFunc(pattern, requestIDMiddleware(accessLogMiddleware(s.logger, corsMiddleware(s.cfg.CORSOrigins, handler))))
+	}
+
+	handle("/ocr", s.handleOCR)
+	handle("/ocr/batch", s.handleOCRBatch)
+	handle("/ocr/async", s.handleOCRAsync)
+	handle("/ocr/result/{job_id}", s.handleOCRResult)
+	handle("/ocr/jobs", s.handleOCRAsync)
+	handle("/ocr/jobs/{job_id}", s.handleOCRResult)
+	handle("/ocr/annotate", s.handleOCRAnnotate)
+	handle("/ocr/preview", s.handleOCRPreview)
+	handle("/results/{id}", s.handleStoredResult)
+
+	// Endpoint cho Prometheus scrape, không cần xác thực
+	mux.HandleFunc("/metrics", s.handleMetrics)
+
+	// Endpoint cho liveness/readiness probe của Kubernetes, không cần xác thực
+	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/ready", s.handleReady)
+
+	return mux
+}
+
+// Close giải phóng các tài nguyên của server và xóa file tạm còn sót lại
+func (s *server) Close() {
+	if s.stopSweep != nil {
+		close(s.stopSweep)
+		s.stopSweep = nil
+	}
+	if s.pool != nil {
+		s.pool.Close()
+	}
+	if err := cleanTempDir(s.cfg.TempDir); err != nil {
+		s.logger.Warning("Failed to clean temp directory %s: %v", s.cfg.TempDir, err)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// serve chạy HTTP server trên ln cho tới khi ctx bị hủy rồi tắt server an toàn:
+// ngừng nhận kết nối mới và chờ các request và job OCR đang chạy xong tối đa timeout
+func (s *server) serve(ctx context.Context, ln net.Listener, timeout time.Duration) error {
+	httpServer := &http.Server{Handler: s.routes()}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.logger.Info("Shutting down, waiting up to %v for in-flight requests...", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := httpServer.Shutdown(shutdownCtx)
+	if err == nil {
+		err = s.waitBackground(shutdownCtx)
+	}
+	if serveErr := <-serveErr; !errors.Is(serveErr, http.ErrServerClosed) && err == nil {
+		err = serveErr
+	}
+	return err
+}
+
+// waitBackground chờ các job OCR bất đồng bộ đang chạy kết thúc hoặc ctx hết hạn
+func (s *server) waitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background OCR jobs did not finish: %v", ctx.Err())
+	}
+}
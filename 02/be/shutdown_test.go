@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServeDrainsInFlightRequests(t *testing.T) {
+	script := writeStubScript(t, countingOCRScript)
+	srv := newLimitedServer(t, script, 0, 0, time.Second)
+	t.Setenv("STUB_RUN_SECONDS", "0.5")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	serveDone := make(chan error, 1)
+	go func() {
+		serveDone <- srv.serve(ctx, ln, 5*time.Second)
+	}()
+
+	req := newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil)
+	req.URL.Scheme = "http"
+	req.URL.Host = ln.Addr().String()
+	req.RequestURI = ""
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("Request error = %v", err)
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+
+	// Chờ script bắt đầu chạy rồi mới yêu cầu tắt server
+	liveCounts := filepath.Join(filepath.Dir(script), "live_counts")
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(liveCounts); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("OCR script did not start")
+		}
+	}
+	cancel()
+
+	select {
+	case code := <-status:
+		if code != http.StatusOK {
+			t.Errorf("In-flight request status = %d, want %d", code, http.StatusOK)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("In-flight request did not complete")
+	}
+	if err := <-serveDone; err != nil {
+		t.Errorf("serve() error = %v, want nil", err)
+	}
+
+	// Server đã tắt thì không nhận kết nối mới
+	if conn, err := net.Dial("tcp", ln.Addr().String()); err == nil {
+		conn.Close()
+		t.Error("Server still accepts connections after shutdown")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+// confidenceBucketBounds là cận dưới của các khoảng độ tin cậy trong thống kê, khoảng cuối gồm cả 1.0
+var confidenceBucketBounds = []float64{0, 0.5, 0.8}
+
+// confidenceBucket là số box có độ tin cậy trong [Min, Max), riêng khoảng cuối là [Min, Max]
+type confidenceBucket struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// confidenceStats tóm tắt chất lượng kết quả OCR khi client gửi stats=true
+type confidenceStats struct {
+	Total int `json:"total"`
+	// MeanConfidence là độ tin cậy trung bình, 0 khi không có box nào
+	MeanConfidence float64            `json:"mean_confidence"`
+	Buckets        []confidenceBucket `json:"buckets"`
+}
+
+// computeConfidenceStats đếm số box theo từng khoảng độ tin cậy và tính độ tin cậy trung bình
+func computeConfidenceStats(results []OCRResult) *confidenceStats {
+	stats := &confidenceStats{Total: len(results), Buckets: make([]confidenceBucket, len(confidenceBucketBounds))}
+	for i, min := range confidenceBucketBounds {
+		max := 1.0
+		if i+1 < len(confidenceBucketBounds) {
+			max = confidenceBucketBounds[i+1]
+		}
+		stats.Buckets[i] = confidenceBucket{Min: min, Max: max}
+	}
+
+	var sum float64
+	for _, result := range results {
+		sum += result.Confidence
+
+		// Duyệt từ khoảng cao nhất để giá trị đúng bằng cận dưới thuộc về khoảng trên
+		for i := len(confidenceBucketBounds) - 1; i >= 0; i-- {
+			if result.Confidence >= confidenceBucketBounds[i] || i == 0 {
+				stats.Buckets[i].Count++
+				break
+			}
+		}
+	}
+	if len(results) > 0 {
+		stats.MeanConfidence = sum / float64(len(results))
+	}
+	return stats
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestComputeConfidenceStats(t *testing.T) {
+	results := []OCRResult{
+		{Text: "a", Confidence: 0.1},
+		{Text: "b", Confidence: 0.49},
+		{Text: "c", Confidence: 0.5},
+		{Text: "d", Confidence: 0.79},
+		{Text: "e", Confidence: 0.8},
+		{Text: "f", Confidence: 0.95},
+		{Text: "g", Confidence: 1},
+	}
+
+	stats := computeConfidenceStats(results)
+	if stats.Total != 7 {
+		t.Errorf("Total = %d, want 7", stats.Total)
+	}
+	if want := 4.63 / 7; math.Abs(stats.MeanConfidence-want) > 1e-9 {
+		t.Errorf("MeanConfidence = %v, want %v", stats.MeanConfidence, want)
+	}
+
+	// Giá trị đúng bằng cận dưới thuộc khoảng trên, 1.0 thuộc khoảng cuối
+	want := []confidenceBucket{{0, 0.5, 2}, {0.5, 0.8, 2}, {0.8, 1, 3}}
+	if len(stats.Buckets) != len(want) {
+		t.Fatalf("Buckets = %+v, want %+v", stats.Buckets, want)
+	}
+	for i := range want {
+		if stats.Buckets[i] != want[i] {
+			t.Errorf("Bucket %d = %+v, want %+v", i, stats.Buckets[i], want[i])
+		}
+	}
+
+	empty := computeConfidenceStats(nil)
+	if empty.Total != 0 || empty.MeanConfidence != 0 || len(empty.Buckets) != len(want) {
+		t.Errorf("Stats of no results = %+v", empty)
+	}
+}
+
+func TestHandleOCRStats(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, multiBoxOCRScript), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 60), map[string]string{"stats": "true"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var response ocrResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Cannot decode response: %v", err)
+	}
+	if len(response.Results) != 3 || response.Stats == nil {
+		t.Fatalf("Response = %+v, want 3 results with stats", response)
+	}
+	if response.Stats.Total != 3 || response.Stats.Buckets[0].Count != 0 || response.Stats.Buckets[1].Count != 2 || response.Stats.Buckets[2].Count != 1 {
+		t.Errorf("Stats = %+v", response.Stats)
+	}
+
+	// Mặc định response vẫn là mảng kết quả, verbose=true không có stats
+	rec = serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 60), nil))
+	var results []OCRResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil || len(results) != 3 {
+		t.Errorf("Default response = %s, want a flat array", rec.Body.String())
+	}
+	rec = serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 60), map[string]string{"verbose": "true"}))
+	var verbose map[string]any
+	json.Unmarshal(rec.Body.Bytes(), &verbose)
+	if _, ok := verbose["stats"]; ok {
+		t.Errorf("Verbose response without stats=true = %s, want no stats", rec.Body.String())
+	}
+
+	for _, fields := range []map[string]string{{"stats": "yes"}, {"stats": "true", "output": "text"}, {"stats": "true", "format": "hocr"}} {
+		if rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 60), fields)); rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, want %d", fields, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
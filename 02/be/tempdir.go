@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Tiền tố tên thư mục tạm chứa ảnh render từ trang PDF và frame tách từ ảnh nhiều frame
+const (
+	pdfTempPrefix    = "pdf_"
+	framesTempPrefix = "frames_"
+)
+
+// cleanTempDir xóa các file upload, thư mục trang PDF và thư mục frame còn sót lại trong thư mục tạm
+// Chỉ xóa những tên do server tạo ra vì thư mục tạm có thể dùng chung với chương trình khác
+func cleanTempDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if !isUploadTempName(entry.Name()) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isUploadTempName cho biết tên file có dạng "<unix-seconds>_..." của saveUploadedFile,
+// "pdf_..." của thư mục render PDF hoặc "frames_..." của thư mục tách frame
+func isUploadTempName(name string) bool {
+	if strings.HasPrefix(name, pdfTempPrefix) || strings.HasPrefix(name, framesTempPrefix) {
+		return true
+	}
+	timestamp, _, found := strings.Cut(name, "_")
+	if !found || timestamp == "" {
+		return false
+	}
+	for _, r := range timestamp {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// sweepTempDir xóa các file upload trong thư mục tạm cũ hơn maxAge, thường là file còn sót lại khi tiến trình bị crash
+// File mới hơn maxAge có thể thuộc request đang chạy nên được giữ lại
+func sweepTempDir(dir string, maxAge time.Duration, now time.Time) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	var errs []error
+	for _, entry := range entries {
+		if !isUploadTempName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
+
+// sweepTempDirPeriodically dọn thư mục tạm mỗi interval cho tới khi stop bị đóng
+func (s *server) sweepTempDirPeriodically(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			s.sweepStaleTempFiles(now)
+		}
+	}
+}
+
+// sweepStaleTempFiles dọn thư mục tạm theo cấu hình và ghi log số file đã xóa
+func (s *server) sweepStaleTempFiles(now time.Time) {
+	removed, err := sweepTempDir(s.cfg.TempDir, s.cfg.TempMaxAge, now)
+	if err != nil {
+		s.logger.Warning("Failed to sweep temp directory %s: %v", s.cfg.TempDir, err)
+	}
+	if removed > 0 {
+		s.logger.Info("Removed %d stale temp files from %s", removed, s.cfg.TempDir)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// tempDirNames trả về tên các phần tử trong thư mục theo thứ tự
+func tempDirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir(%s) error = %v", dir, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestCleanTempDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"1700000000_123_image.png", "1700000000_456_scan.webp.png", "other.txt", "notes_1.md"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "pdf_789"), 0755)
+	os.Mkdir(filepath.Join(dir, "frames_789"), 0755)
+
+	if err := cleanTempDir(dir); err != nil {
+		t.Fatalf("cleanTempDir() error = %v", err)
+	}
+
+	names := tempDirNames(t, dir)
+	if !slices.Equal(names, []string{"notes_1.md", "other.txt"}) {
+		t.Errorf("Remaining entries = %v, want only the files not created by the server", names)
+	}
+}
+
+func TestSweepTempDir(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+
+	files := map[string]time.Time{
+		"1700000000_1_old.png":   old,
+		"1700000000_2_new.png":   now.Add(-time.Minute),
+		"unrelated_old_file.txt": old,
+	}
+	for name, modTime := range files {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, nil, 0644)
+		os.Chtimes(path, modTime, modTime)
+	}
+	for _, name := range []string{"pdf_123", "frames_123"} {
+		path := filepath.Join(dir, name)
+		os.Mkdir(path, 0755)
+		os.Chtimes(path, old, old)
+	}
+
+	removed, err := sweepTempDir(dir, time.Hour, now)
+	if err != nil {
+		t.Fatalf("sweepTempDir() error = %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("sweepTempDir() removed %d entries, want 3", removed)
+	}
+
+	// File mới có thể thuộc request đang chạy, file không do server tạo thì không bị xóa
+	if names := tempDirNames(t, dir); !slices.Equal(names, []string{"1700000000_2_new.png", "unrelated_old_file.txt"}) {
+		t.Errorf("Remaining entries = %v, want the new upload and the unrelated file", names)
+	}
+}
+
+func TestNewServerSweepsTempDirOnStartup(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.TempDir = t.TempDir()
+	cfg.ScriptPath = writeStubScript(t, stubOCRScript)
+	cfg.Workers = 0
+
+	stale := filepath.Join(cfg.TempDir, "1700000000_1_stale.png")
+	os.WriteFile(stale, nil, 0644)
+	old := time.Now().Add(-2 * cfg.TempMaxAge)
+	os.Chtimes(stale, old, old)
+
+	srv, err := newServer(cfg, newTestLogger(t))
+	if err != nil {
+		t.Fatalf("newServer() error = %v", err)
+	}
+	defer srv.Close()
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("Stale temp file still exists after startup: %v", err)
+	}
+}
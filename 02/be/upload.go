@@ -0,0 +1,607 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ocrUpload là ảnh đã upload được lưu vào file tạm cùng các tham số xử lý
+type ocrUpload struct {
+	path string
+	hash []byte
+	// maxWidth, maxHeight là kích thước tối đa lúc OCR, đã được giới hạn bởi MAX_ALLOWED_DIMENSION
+	maxWidth  int
+	maxHeight int
+	// clamped là true khi max_width hoặc max_height của client bị giảm về MAX_ALLOWED_DIMENSION
+	clamped bool
+	// lang là ngôn ngữ nhận diện, rỗng nghĩa là dùng mặc định của script
+	lang string
+	// contentType là kiểu nội dung nhận diện từ các byte đầu của file
+	contentType string
+	// width, height là kích thước gốc của ảnh, bằng 0 nếu không đọc được header ảnh
+	width  int
+	height int
+	// frames là số frame của ảnh TIFF nhiều trang hay GIF động, 1 với ảnh thường
+	frames int
+}
+
+// parseMaxDimension đọc tham số max_width/max_height, bỏ trống nghĩa là MAX_ALLOWED_DIMENSION
+// Giá trị lớn hơn giới hạn bị giảm về MAX_ALLOWED_DIMENSION và clamped là true,
+// giá trị không phải số nguyên dương bị từ chối với lỗi 400
+func parseMaxDimension(r *http.Request, name string) (value int, clamped bool, err error) {
+	raw := r.FormValue(name)
+	if raw == "" {
+		return MAX_ALLOWED_DIMENSION, false, nil
+	}
+
+	value, err = strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		return 0, false, &requestError{http.StatusBadRequest, fmt.Sprintf("Invalid %s value %q, expected a positive integer", name, raw)}
+	}
+	if value > MAX_ALLOWED_DIMENSION {
+		return MAX_ALLOWED_DIMENSION, true, nil
+	}
+	return value, false, nil
+}
+
+// setDimensionHeaders báo cho client kích thước tối đa thực sự được dùng khi OCR
+func setDimensionHeaders(w http.ResponseWriter, upload *ocrUpload) {
+	w.Header().Set("X-OCR-Max-Width", strconv.Itoa(upload.maxWidth))
+	w.Header().Set("X-OCR-Max-Height", strconv.Itoa(upload.maxHeight))
+	if upload.clamped {
+		w.Header().Set("X-OCR-Dimensions-Clamped", "true")
+	}
+}
+
+// remove xóa file tạm của upload
+func (u *ocrUpload) remove() {
+	os.Remove(u.path)
+}
+
+// supportedLanguages là danh sách ngôn ngữ PaddleOCR được phép chọn qua tham số lang
+// Chỉ chấp nhận giá trị trong danh sách để tránh truyền tham số tùy ý vào script Python
+var supportedLanguages = map[string]bool{
+	"ch":          true,
+	"chinese_cht": true,
+	"en":          true,
+	"vi":          true,
+	"japan":       true,
+	"korean":      true,
+	"fr":          true,
+	"german":      true,
+}
+
+// requestError là lỗi kèm HTTP status code cần trả về cho client
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// writeRequestError trả lỗi về client với status code phù hợp
+func writeRequestError(w http.ResponseWriter, err error) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		writeError(w, reqErr.status, reqErr.message)
+		return
+	}
+	writeError(w, http.StatusInternalServerError, err.Error())
+}
+
+// errorResponse là body JSON trả về khi request thất bại, code cho phép client phân loại lỗi mà không cần đọc message
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// errorCodes ánh xạ status code sang mã lỗi trong errorResponse
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "invalid_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusRequestEntityTooLarge: "upload_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "invalid_image",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusGatewayTimeout:        "timeout",
+}
+
+// statusErrorCode trả về mã lỗi của status code, "error" nếu không có trong errorCodes
+func statusErrorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	return "error"
+}
+
+// writeError trả lỗi dạng JSON {"error", "code"} với status code cho trước
+func writeError(w http.ResponseWriter, status int, message string) {
+	code := statusErrorCode(status)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Error: message, Code: code})
+}
+
+// defaultMaxUploadSize là kích thước tối đa mặc định của body request upload
+const defaultMaxUploadSize = 20 << 20
+
+// maxFormFieldSize là kích thước tối đa của một trường form không phải file
+const maxFormFieldSize = 64 << 10
+
+// uploadedFile là file upload đã được ghi thẳng xuống file tạm
+type uploadedFile struct {
+	path     string
+	filename string
+	header   textproto.MIMEHeader
+	size     int64
+	hash     []byte
+}
+
+// receiveUpload đọc ảnh và tham số từ form upload rồi lưu ảnh vào file tạm
+func (s *server) receiveUpload(w http.ResponseWriter, r *http.Request) (*ocrUpload, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxUploadSize)
+
+	// Lấy file từ request: ảnh gửi thẳng trong body, base64 trong JSON hoặc qua form multipart
+	var file *uploadedFile
+	var err error
+	switch {
+	case isRawImageUpload(r):
+		file, err = s.saveRawBody(r)
+	case isJSONUpload(r):
+		file, err = s.saveJSONBody(r)
+	default:
+		file, err = s.streamMultipart(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.prepareUpload(r, file)
+}
+
+// prepareUpload đọc tham số xử lý từ form và chuẩn bị ảnh đã lưu cho OCR, file tạm bị xóa nếu có lỗi
+func (s *server) prepareUpload(r *http.Request, file *uploadedFile) (*ocrUpload, error) {
+	id := requestID(r.Context())
+	s.logger.Info("[%s] Uploaded File: %+v", id, file.filename)
+	s.logger.Info("[%s] File Size: %+v", id, file.size)
+	s.logger.Info("[%s] MIME Header: %+v", id, file.header)
+
+	// Xử lý tham số max_width, max_height - đảm bảo không vượt quá giới hạn
+	maxWidth, widthClamped, err := parseMaxDimension(r, "max_width")
+	if err != nil {
+		os.Remove(file.path)
+		return nil, err
+	}
+	maxHeight, heightClamped, err := parseMaxDimension(r, "max_height")
+	if err != nil {
+		os.Remove(file.path)
+		return nil, err
+	}
+
+	// Xử lý tham số lang - chỉ chấp nhận ngôn ngữ được hỗ trợ
+	lang := r.FormValue("lang")
+	if lang != "" && !supportedLanguages[lang] {
+		os.Remove(file.path)
+		return nil, &requestError{http.StatusBadRequest, "Unsupported language: " + lang}
+	}
+
+	upload := &ocrUpload{
+		path:      file.path,
+		hash:      file.hash,
+		maxWidth:  maxWidth,
+		maxHeight: maxHeight,
+		clamped:   widthClamped || heightClamped,
+		lang:      lang,
+	}
+	upload.contentType = detectContentType(file.path)
+
+	// File không phải ảnh bị từ chối ngay thay vì để Python báo lỗi khó hiểu
+	if !supportedContentTypes[upload.contentType] && !convertibleFormats[upload.contentType] {
+		upload.remove()
+		return nil, &requestError{http.StatusUnsupportedMediaType,
+			fmt.Sprintf("Unsupported file type %s, expected a PNG, JPEG, BMP, GIF, TIFF, WebP, HEIC or AVIF image or a PDF", upload.contentType)}
+	}
+
+	// Ảnh chụp từ điện thoại thường chỉ đánh dấu chiều bằng EXIF, xoay lại để ocr.py thấy ảnh đúng chiều
+	if upload.contentType == "image/jpeg" {
+		if rotated, err := applyJPEGOrientation(file.path); err != nil {
+			s.logger.Warning("[%s] Cannot apply EXIF orientation: %v", id, err)
+		} else if rotated {
+			s.logger.Info("[%s] Rotated JPEG according to its EXIF orientation", id)
+		}
+	}
+	upload.width, upload.height = imageDimensions(file.path)
+	upload.frames = countFrames(file.path, upload.contentType, s.cfg.MaxFrames)
+
+	// Các định dạng ocr.py có thể không đọc được thì chuyển sang PNG trước,
+	// ảnh nhiều frame được giữ nguyên để tách từng frame khi OCR
+	if convertibleFormats[upload.contentType] && upload.frames == 1 {
+		if err := s.convertToPNG(upload); err != nil {
+			upload.remove()
+			return nil, err
+		}
+	}
+
+	return upload, nil
+}
+
+// streamMultipart đọc form multipart theo từng phần: file "image" được ghi thẳng xuống file tạm
+// thay vì buffer trong bộ nhớ, các trường còn lại được gán vào r.Form để dùng qua r.FormValue
+func (s *server) streamMultipart(r *http.Request) (*uploadedFile, error) {
+	files, _, err := s.readMultipart(r, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 1 {
+		return files[0], nil
+	}
+
+	// Không có file thì tải ảnh từ trường image_url nếu client gửi
+	imageURL := r.FormValue("image_url")
+	if imageURL == "" {
+		return nil, &requestError{http.StatusBadRequest, "Error retrieving the file: " + http.ErrMissingFile.Error()}
+	}
+	return s.fetchImage(r.Context(), imageURL)
+}
+
+// readMultipart đọc form multipart, ghi tối đa maxFiles file "image" xuống file tạm và gán các trường còn lại vào r.Form
+// Số file "image" vượt quá maxFiles được trả về để handler tự quyết định bỏ qua hay từ chối
+func (s *server) readMultipart(r *http.Request, maxFiles int) ([]*uploadedFile, int, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, 0, &requestError{http.StatusBadRequest, "Error retrieving the file: " + err.Error()}
+	}
+
+	fields := make(url.Values)
+	var files []*uploadedFile
+	extra := 0
+
+	// Xóa các file tạm nếu form bị lỗi giữa chừng
+	fail := func(err error) ([]*uploadedFile, int, error) {
+		for _, file := range files {
+			os.Remove(file.path)
+		}
+		return nil, 0, err
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(uploadReadError(err))
+		}
+
+		name := part.FormName()
+		switch {
+		case name == "image" && part.FileName() != "" && len(files) < maxFiles:
+			file, err := s.saveFilePart(part)
+			if err != nil {
+				return fail(err)
+			}
+			files = append(files, file)
+		case name == "image" && part.FileName() != "":
+			extra++
+		case part.FileName() == "":
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize+1))
+			if err != nil {
+				return fail(uploadReadError(err))
+			}
+			if len(value) > maxFormFieldSize {
+				return fail(&requestError{http.StatusBadRequest, "Form field too large: " + name})
+			}
+			fields.Add(name, string(value))
+		}
+		part.Close()
+	}
+
+	// Gán các trường form để các bước xử lý sau đọc được qua r.FormValue
+	r.MultipartForm = &multipart.Form{Value: fields}
+	r.PostForm = fields
+	r.Form = r.URL.Query()
+	for name, values := range fields {
+		r.Form[name] = append(r.Form[name], values...)
+	}
+
+	return files, extra, nil
+}
+
+// saveFilePart ghi nội dung một file part vào file tạm
+func (s *server) saveFilePart(part *multipart.Part) (*uploadedFile, error) {
+	return s.saveUploadedFile(part.FileName(), part.Header, part)
+}
+
+// saveUploadedFile ghi nội dung src vào file tạm, đồng thời tính hash để tra cache
+func (s *server) saveUploadedFile(filename string, header textproto.MIMEHeader, src io.Reader) (*uploadedFile, error) {
+	// Tạo tên file tạm thời dựa trên timestamp, tên file từ client được làm sạch để không thoát khỏi thư mục tạm
+	// Phần ngẫu nhiên tránh ghi đè khi nhiều file cùng tên được upload trong cùng một giây
+	tempDir, _ := filepath.Abs(s.cfg.TempDir)
+	tempFile, err := os.CreateTemp(tempDir, fmt.Sprintf("%d_*_%s", time.Now().Unix(), sanitizeFilename(filename)))
+	if err != nil {
+		return nil, &requestError{http.StatusInternalServerError, "Error creating temporary file: " + err.Error()}
+	}
+	tempFilePath := tempFile.Name()
+
+	// Sao chép nội dung file upload vào file tạm thời, đồng thời tính hash để tra cache
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tempFile, hasher), src)
+	if err != nil {
+		tempFile.Close()
+		os.Remove(tempFilePath)
+		return nil, uploadReadError(err)
+	}
+
+	// Đóng file đúng một lần trước khi Python đọc, lỗi khi đóng nghĩa là dữ liệu có thể chưa được ghi hết
+	if err := tempFile.Close(); err != nil {
+		os.Remove(tempFilePath)
+		return nil, &requestError{http.StatusInternalServerError, "Error writing temporary file: " + err.Error()}
+	}
+
+	return &uploadedFile{
+		path:     tempFilePath,
+		filename: filename,
+		header:   header,
+		size:     size,
+		hash:     hasher.Sum(nil),
+	}, nil
+}
+
+// isRawImageUpload cho biết request gửi ảnh thẳng trong body, ví dụ curl --data-binary với Content-Type image/*
+func isRawImageUpload(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && strings.HasPrefix(mediaType, "image/")
+}
+
+// saveRawBody ghi body request vào file tạm, tham số được đọc từ query string
+// Tên file lấy từ header Content-Disposition nếu có, nếu không thì đặt theo Content-Type
+func (s *server) saveRawBody(r *http.Request) (*uploadedFile, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	filename := "upload." + strings.TrimPrefix(mediaType, "image/")
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		filename = params["filename"]
+	}
+
+	file, err := s.saveUploadedFile(filename, textproto.MIMEHeader{"Content-Type": {mediaType}}, r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if file.size == 0 {
+		os.Remove(file.path)
+		return nil, &requestError{http.StatusBadRequest, "Error retrieving the file: empty request body"}
+	}
+
+	// Body đã được đọc hết, tham số chỉ còn trong query string
+	r.Form = r.URL.Query()
+	r.PostForm = make(url.Values)
+	return file, nil
+}
+
+// isJSONUpload cho biết request gửi ảnh dạng base64 trong body JSON
+func isJSONUpload(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+// saveJSONBody giải mã ảnh base64 trong trường image_base64 của body JSON vào file tạm, hoặc tải ảnh từ image_url
+// image_base64 có thể là base64 thuần hoặc data URL ("data:image/png;base64,..."),
+// các trường còn lại như max_width, lang được gán vào r.Form giống trường form multipart
+func (s *server) saveJSONBody(r *http.Request) (*uploadedFile, error) {
+	var body map[string]any
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, uploadReadError(err)
+		}
+		return nil, &requestError{http.StatusBadRequest, "Invalid JSON body: " + err.Error()}
+	}
+
+	encoded, _ := body["image_base64"].(string)
+	imageURL, _ := body["image_url"].(string)
+	if encoded == "" && imageURL == "" {
+		return nil, &requestError{http.StatusBadRequest, "Error retrieving the file: missing image_base64 or image_url"}
+	}
+	delete(body, "image_base64")
+	delete(body, "image_url")
+
+	// Tải ảnh từ image_url khi không có ảnh base64
+	if encoded == "" {
+		fields, err := jsonFormValues(body)
+		if err != nil {
+			return nil, err
+		}
+		file, err := s.fetchImage(r.Context(), imageURL)
+		if err != nil {
+			return nil, err
+		}
+		setJSONForm(r, fields)
+		return file, nil
+	}
+
+	// Data URL mang theo kiểu ảnh, dùng để đặt tên file
+	mediaType := ""
+	if rest, ok := strings.CutPrefix(encoded, "data:"); ok {
+		meta, data, found := strings.Cut(rest, ",")
+		if !found || !strings.HasSuffix(meta, ";base64") {
+			return nil, &requestError{http.StatusBadRequest, "Invalid image_base64: data URL is not base64 encoded"}
+		}
+		mediaType, encoded = strings.TrimSuffix(meta, ";base64"), data
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, &requestError{http.StatusBadRequest, "Invalid image_base64: " + err.Error()}
+	}
+	if len(data) == 0 {
+		return nil, &requestError{http.StatusBadRequest, "Error retrieving the file: empty image_base64"}
+	}
+
+	filename := "upload"
+	if subtype, ok := strings.CutPrefix(mediaType, "image/"); ok && subtype != "" {
+		filename += "." + subtype
+	}
+	if name, ok := body["filename"].(string); ok && name != "" {
+		filename = name
+	}
+	delete(body, "filename")
+
+	fields, err := jsonFormValues(body)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := s.saveUploadedFile(filename, textproto.MIMEHeader{"Content-Type": {mediaType}}, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	setJSONForm(r, fields)
+	return file, nil
+}
+
+// setJSONForm gán các trường JSON để các bước xử lý sau đọc được qua r.FormValue, giống form multipart
+func setJSONForm(r *http.Request, fields url.Values) {
+	r.PostForm = fields
+	r.Form = r.URL.Query()
+	for name, values := range fields {
+		r.Form[name] = append(r.Form[name], values...)
+	}
+}
+
+// jsonFormValues chuyển các trường JSON dạng chuỗi, số và bool thành giá trị form
+func jsonFormValues(body map[string]any) (url.Values, error) {
+	fields := make(url.Values, len(body))
+	for name, value := range body {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			fields.Set(name, v)
+		case json.Number:
+			fields.Set(name, v.String())
+		case bool:
+			fields.Set(name, strconv.FormatBool(v))
+		default:
+			return nil, &requestError{http.StatusBadRequest, "Invalid JSON field: " + name}
+		}
+	}
+	return fields, nil
+}
+
+// uploadReadError chuyển lỗi đọc body thành lỗi trả về client, body vượt giới hạn trả về 413
+func uploadReadError(err error) *requestError {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return &requestError{http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload exceeds the maximum size of %d bytes", maxBytesErr.Limit)}
+	}
+	return &requestError{http.StatusBadRequest, "Error reading the upload: " + err.Error()}
+}
+
+// detectContentType nhận diện kiểu nội dung từ 512 byte đầu của file
+func detectContentType(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	return sniffContentType(head[:n])
+}
+
+// imageDimensions đọc kích thước ảnh từ header mà không cần decode toàn bộ ảnh
+func imageDimensions(path string) (int, int) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0
+	}
+	return config.Width, config.Height
+}
+
+// processedDimensions tính kích thước ảnh sau khi script OCR resize về giới hạn max_width/max_height
+// Công thức giống preprocess_image trong ocr.py
+func processedDimensions(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= maxWidth && height <= maxHeight {
+		return width, height
+	}
+
+	ratio := math.Min(float64(maxWidth)/float64(width), float64(maxHeight)/float64(height))
+	return int(float64(width) * ratio), int(float64(height) * ratio)
+}
+
+// maxSanitizedFilename là độ dài tối đa của tên file sau khi làm sạch, để tên file tạm
+// (thêm timestamp và phần ngẫu nhiên) không vượt giới hạn độ dài tên file của hệ điều hành
+const maxSanitizedFilename = 100
+
+// maxFilenameExt là độ dài tối đa của phần mở rộng được giữ lại khi cắt bớt tên file
+const maxFilenameExt = 16
+
+// sanitizeFilename chỉ giữ lại phần tên file và các ký tự an toàn (chữ, số, '.', '-', '_')
+// Tên quá dài được cắt bớt phần tên, giữ lại phần mở rộng để vẫn nhận ra định dạng
+func sanitizeFilename(name string) string {
+	// Client trên Windows có thể gửi đường dẫn dùng '\'
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+
+	var builder strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune('_')
+		}
+	}
+
+	// Không để tên file chỉ gồm dấu chấm như "." hoặc ".."
+	sanitized := strings.TrimLeft(builder.String(), ".")
+	if sanitized == "" {
+		return "upload"
+	}
+
+	// Sau khi làm sạch tên chỉ còn ký tự ASCII nên cắt theo byte không làm hỏng ký tự
+	if len(sanitized) > maxSanitizedFilename {
+		ext := filepath.Ext(sanitized)
+		if len(ext) > maxFilenameExt {
+			ext = ""
+		}
+		sanitized = sanitized[:maxSanitizedFilename-len(ext)] + ext
+	}
+	return sanitized
+}
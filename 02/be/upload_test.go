@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"image.png", "image.png"},
+		{"../../evil.png", "evil.png"},
+		{"..\\..\\evil.png", "evil.png"},
+		{"/etc/passwd", "passwd"},
+		{"my photo (1).jpg", "my_photo__1_.jpg"},
+		{"..", "upload"},
+		{"", "upload"},
+		{".hidden", "hidden"},
+		{strings.Repeat("a", 300) + ".png", strings.Repeat("a", maxSanitizedFilename-4) + ".png"},
+		{strings.Repeat("a", 300), strings.Repeat("a", maxSanitizedFilename)},
+		{"a." + strings.Repeat("b", 300), "a." + strings.Repeat("b", maxSanitizedFilename-2)},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeFilename(tt.name); got != tt.want {
+			t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHandleOCRLongFilename(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	// Tên file gốc dài hơn giới hạn tên file của hệ điều hành vẫn lưu được thành file tạm
+	rec := serveOCR(srv, newUploadRequest(t, strings.Repeat("x", 300)+".png", encodePNG(t, 20, 20), nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status = %d, want %d, body: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
+
+func TestHandleOCRPathTraversalStaysInTempDir(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "../../evil.png", encodePNG(t, 20, 20), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	tempDir, _ := filepath.Abs(srv.cfg.TempDir)
+	calls := readCalls(t, script)
+	if len(calls) != 1 {
+		t.Fatalf("Script calls = %+v, want 1", calls)
+	}
+	if dir := filepath.Dir(calls[0].ImagePath); dir != tempDir {
+		t.Errorf("Temp file written to %s, want inside %s", calls[0].ImagePath, tempDir)
+	}
+	if !strings.HasSuffix(calls[0].ImagePath, "_evil.png") {
+		t.Errorf("Temp file name = %s, want suffix _evil.png", calls[0].ImagePath)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, "..", "..", "evil.png")); err == nil {
+		t.Error("Upload escaped the temp directory")
+	}
+}
+
+func TestHandleOCRUsesConfiguredTempDir(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	calls := readCalls(t, script)
+	if len(calls) != 1 || filepath.Dir(calls[0].ImagePath) != srv.cfg.TempDir {
+		t.Fatalf("Script calls = %+v, want one call with an image in %s", calls, srv.cfg.TempDir)
+	}
+
+	// File tạm được xóa sau khi xử lý xong
+	if _, err := os.Stat(calls[0].ImagePath); !os.IsNotExist(err) {
+		t.Errorf("Temp file %s still exists after the request", calls[0].ImagePath)
+	}
+}
+
+// fileSizeOCRScript chờ một chút rồi trả về kích thước file ảnh làm text,
+// file tạm bị request khác ghi đè trong lúc chờ sẽ cho kết quả sai
+const fileSizeOCRScript = `
+import sys, json, os, time
+time.sleep(0.3)
+size = os.path.getsize(sys.argv[1])
+print(json.dumps([{"coords": [[0, 0], [10, 0], [10, 10], [0, 10]], "text": str(size), "confidence": 0.9}]))
+`
+
+func TestHandleOCRConcurrentUploadsWithSameFilename(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, fileSizeOCRScript), 0)
+
+	images := [][]byte{encodePNG(t, 20, 20), encodePNG(t, 400, 300)}
+	texts := make([]string, len(images))
+	var wg sync.WaitGroup
+	for i, image := range images {
+		req := newUploadRequest(t, "image.png", image, nil)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var results []OCRResult
+			json.Unmarshal(serveOCR(srv, req).Body.Bytes(), &results)
+			if len(results) == 1 {
+				texts[i] = results[0].Text
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i, image := range images {
+		if want := strconv.Itoa(len(image)); texts[i] != want {
+			t.Errorf("Request %d OCRed a file of size %s, want its own upload of size %s", i, texts[i], want)
+		}
+	}
+}
+
+func TestPrepareTempDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "nested", "temp")
+	if err := prepareTempDir(dir); err != nil {
+		t.Fatalf("prepareTempDir() error = %v", err)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("Temp directory %s was not created", dir)
+	}
+
+	// File thường không thể dùng làm thư mục tạm
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0644)
+	if err := prepareTempDir(file); err == nil {
+		t.Error("Expected error for a temp dir that is a regular file")
+	}
+}
+
+// newStreamingUploadRequest tạo request upload có file kích thước size được ghi dần qua pipe,
+// để request không giữ toàn bộ nội dung trong bộ nhớ
+func newStreamingUploadRequest(tb testing.TB, size int64, fields map[string]string) *http.Request {
+	tb.Helper()
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		part, err := writer.CreateFormFile("image", "large.png")
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		// Nội dung bắt đầu bằng chữ ký PNG để qua được bước kiểm tra kiểu file
+		chunk := bytes.Repeat([]byte{'x'}, 32<<10)
+		copy(chunk, "\x89PNG\r\n\x1a\n")
+		for written := int64(0); written < size; written += int64(len(chunk)) {
+			n := min(int64(len(chunk)), size-written)
+			if _, err := part.Write(chunk[:n]); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		// Các trường đặt sau file vẫn phải được đọc
+		for name, value := range fields {
+			writer.WriteField(name, value)
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, "/ocr", pr)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestHandleOCRStreamsLargeUploadToDisk(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	const size = 16 << 20
+	req := newStreamingUploadRequest(t, size, map[string]string{"lang": "en"})
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	rec := serveOCR(srv, req)
+	runtime.ReadMemStats(&after)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/4 {
+		t.Errorf("Allocated %d bytes for a %d byte upload, want the file streamed to disk", allocated, size)
+	}
+
+	calls := readCalls(t, script)
+	if len(calls) != 1 || calls[0].Lang != "en" {
+		t.Fatalf("Script calls = %+v, want one call with lang en", calls)
+	}
+}
+
+func TestHandleOCRRejectsOversizedUpload(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+	srv.cfg.MaxUploadSize = 64 << 10
+
+	rec := serveOCR(srv, newStreamingUploadRequest(t, srv.cfg.MaxUploadSize+1, nil))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Status = %d, want %d, body: %s", rec.Code, http.StatusRequestEntityTooLarge, rec.Body.String())
+	}
+	if calls := readCalls(t, script); len(calls) != 0 {
+		t.Errorf("Script calls = %+v, want none", calls)
+	}
+
+	// File tạm dở dang phải được xóa
+	entries, _ := os.ReadDir(srv.cfg.TempDir)
+	if len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after a rejected upload", len(entries))
+	}
+}
+
+func TestHandleOCRErrorsAreJSON(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+		code string
+	}{
+		{"not an image", newUploadRequest(t, "notes.png", []byte("plain text"), nil), http.StatusUnsupportedMediaType, "unsupported_media_type"},
+		{"invalid option", newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{"limit": "many"}), http.StatusBadRequest, "invalid_request"},
+		{"wrong method", httptest.NewRequest(http.MethodGet, "/ocr", nil), http.StatusMethodNotAllowed, "method_not_allowed"},
+	}
+
+	for _, tt := range tests {
+		rec := serveOCR(srv, tt.req)
+		if rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type = %q, want application/json", tt.name, ct)
+		}
+
+		var resp errorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Errorf("%s: body %q is not JSON: %v", tt.name, rec.Body.String(), err)
+			continue
+		}
+		if resp.Error == "" || resp.Code != tt.code {
+			t.Errorf("%s: response = %+v, want an error message with code %s", tt.name, resp, tt.code)
+		}
+	}
+}
+
+func TestHandleOCRMissingImage(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("lang", "en")
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/ocr", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	rec := serveOCR(srv, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func BenchmarkReceiveLargeUpload(b *testing.B) {
+	srv := newTestServer(b, writeStubScript(b, stubOCRScript), 0)
+
+	const size = 8 << 20
+	b.ReportAllocs()
+	b.SetBytes(size)
+	for b.Loop() {
+		req := newStreamingUploadRequest(b, size, nil)
+		upload, err := srv.receiveUpload(httptest.NewRecorder(), req)
+		if err != nil {
+			b.Fatalf("receiveUpload: %v", err)
+		}
+		upload.remove()
+	}
+}
+
+func TestHandleOCRRawImageBody(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	var jpegBytes bytes.Buffer
+	if err := jpeg.Encode(&jpegBytes, image.NewGray(image.Rect(0, 0, 30, 20)), nil); err != nil {
+		t.Fatalf("Failed to encode JPEG: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/ocr?lang=en&verbose=true", bytes.NewReader(jpegBytes.Bytes()))
+	req.Header.Set("Content-Type", "image/jpeg")
+	rec := serveOCR(srv, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+
+	var response ocrResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Cannot decode response: %v", err)
+	}
+	if len(response.Results) != 1 || response.OriginalWidth != 30 || response.OriginalHeight != 20 {
+		t.Errorf("Response = %+v, want one result for a 30x20 image", response)
+	}
+
+	calls := readCalls(t, script)
+	if len(calls) != 1 || calls[0].Lang != "en" || !strings.HasSuffix(calls[0].ImagePath, "_upload.jpeg") {
+		t.Errorf("Script calls = %+v, want one call for upload.jpeg with lang en", calls)
+	}
+}
+
+func TestHandleOCRRawBodyValidation(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        io.Reader
+		want        int
+	}{
+		{"empty body", "image/png", strings.NewReader(""), http.StatusBadRequest},
+		{"not an image type", "text/plain", strings.NewReader("hello"), http.StatusBadRequest},
+		{"too large", "image/png", io.LimitReader(zeroReader{}, defaultMaxUploadSize+1), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/ocr", tt.body)
+		req.Header.Set("Content-Type", tt.contentType)
+		if rec := serveOCR(srv, req); rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after rejected uploads", len(entries))
+	}
+}
+
+func TestHandleOCRBase64JSON(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	// Kích thước khác nhau để request thứ hai không lấy kết quả từ cache
+	tests := []struct {
+		name   string
+		image  string
+		width  int
+		suffix string
+	}{
+		{"plain base64", base64.StdEncoding.EncodeToString(encodePNG(t, 40, 30)), 40, "_upload"},
+		{"data URL", "data:image/png;base64," + base64.StdEncoding.EncodeToString(encodePNG(t, 50, 30)), 50, "_upload.png"},
+	}
+
+	for i, tt := range tests {
+		body, _ := json.Marshal(map[string]any{"image_base64": tt.image, "max_width": 800, "lang": "en", "verbose": true})
+		req := httptest.NewRequest(http.MethodPost, "/ocr", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		rec := serveOCR(srv, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body: %s", tt.name, rec.Code, rec.Body.String())
+		}
+
+		var response ocrResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: cannot decode response: %v", tt.name, err)
+		}
+		if len(response.Results) != 1 || response.OriginalWidth != tt.width || response.OriginalHeight != 30 {
+			t.Errorf("%s: response = %+v, want one result for a %dx30 image", tt.name, response, tt.width)
+		}
+
+		calls := readCalls(t, script)
+		if len(calls) != i+1 || calls[i].Lang != "en" || !strings.HasSuffix(calls[i].ImagePath, tt.suffix) {
+			t.Errorf("%s: script calls = %+v, want a call for %s with lang en", tt.name, calls, tt.suffix)
+		}
+	}
+}
+
+func TestHandleOCRBase64JSONValidation(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"malformed base64", `{"image_base64": "not base64!"}`, http.StatusBadRequest},
+		{"missing image", `{"max_width": 800}`, http.StatusBadRequest},
+		{"empty image", `{"image_base64": "data:image/png;base64,"}`, http.StatusBadRequest},
+		{"data URL without base64", `{"image_base64": "data:image/png,abc"}`, http.StatusBadRequest},
+		{"invalid JSON", `{"image_base64": `, http.StatusBadRequest},
+		{"nested parameter", `{"image_base64": "aGVsbG8=", "lang": ["en"]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/ocr", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		if rec := serveOCR(srv, req); rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after rejected uploads", len(entries))
+	}
+}
+
+// zeroReader trả về vô hạn byte 0
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestHandleOCRClampsMaxDimensions(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{
+		"verbose":    "true",
+		"max_width":  "5000",
+		"max_height": "400",
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, body: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("X-OCR-Max-Width"); got != strconv.Itoa(MAX_ALLOWED_DIMENSION) {
+		t.Errorf("X-OCR-Max-Width = %q, want %d", got, MAX_ALLOWED_DIMENSION)
+	}
+	if got := rec.Header().Get("X-OCR-Max-Height"); got != "400" {
+		t.Errorf("X-OCR-Max-Height = %q, want 400", got)
+	}
+	if got := rec.Header().Get("X-OCR-Dimensions-Clamped"); got != "true" {
+		t.Errorf("X-OCR-Dimensions-Clamped = %q, want true", got)
+	}
+
+	var resp ocrResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Cannot decode verbose response: %v", err)
+	}
+	if resp.MaxWidth != MAX_ALLOWED_DIMENSION || resp.MaxHeight != 400 || !resp.Clamped {
+		t.Errorf("Effective dimensions = %dx%d clamped=%v, want %dx400 clamped", resp.MaxWidth, resp.MaxHeight, resp.Clamped, MAX_ALLOWED_DIMENSION)
+	}
+
+	// Giá trị trong giới hạn được giữ nguyên và không bị báo là đã giới hạn
+	rec = serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{"max_width": "400"}))
+	if got := rec.Header().Get("X-OCR-Dimensions-Clamped"); rec.Code != http.StatusOK || got != "" {
+		t.Errorf("Status = %d, X-OCR-Dimensions-Clamped = %q, want 200 and no header", rec.Code, got)
+	}
+
+	for _, params := range []map[string]string{
+		{"max_width": "-5"},
+		{"max_width": "0"},
+		{"max_height": "abc"},
+	} {
+		rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), params))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%v: status = %d, want %d", params, rec.Code, http.StatusBadRequest)
+		}
+	}
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after rejected uploads", len(entries))
+	}
+}
+
+func TestHandleOCRFailedUploadCopyCleansUp(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 0)
+
+	// Kết nối bị ngắt giữa chừng khi đang ghi body vào file tạm
+	body := io.MultiReader(bytes.NewReader(encodePNG(t, 20, 20)), iotest.ErrReader(errors.New("connection reset by peer")))
+	req := httptest.NewRequest(http.MethodPost, "/ocr", body)
+	req.Header.Set("Content-Type", "image/png")
+
+	rec := serveOCR(srv, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Status = %d, want %d, body: %s", rec.Code, http.StatusBadRequest, rec.Body.String())
+	}
+	var resp errorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || !strings.Contains(resp.Error, "connection reset by peer") {
+		t.Errorf("Body = %s, want the read error", rec.Body.String())
+	}
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after the failed copy", len(entries))
+	}
+}
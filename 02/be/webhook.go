@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// webhookRetryBackoff là thời gian chờ trước lần gửi lại callback đầu tiên, tăng gấp đôi sau mỗi lần
+const webhookRetryBackoff = 200 * time.Millisecond
+
+// webhookSignatureHeader chứa chữ ký "sha256=<hex>" của body callback để receiver kiểm tra
+const webhookSignatureHeader = "X-OCR-Signature"
+
+// errInternalAddress được trả về khi callback_url hay image_url trỏ tới địa chỉ nội bộ không nằm trong danh sách cho phép
+var errInternalAddress = errors.New("internal address not allowed")
+
+// checkCallbackURL chỉ chấp nhận URL http(s) tuyệt đối cho callback_url
+// Host là IP nội bộ bị từ chối ngay, tên miền được kiểm tra lại khi kết nối trong internalDialControl
+func (s *server) checkCallbackURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.New("missing host")
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && internalIP(ip) && !s.callbackHostAllowed(u.Hostname()) {
+		return fmt.Errorf("%w: %s", errInternalAddress, ip)
+	}
+	return nil
+}
+
+// callbackHostAllowed cho biết host có nằm trong CallbackAllowedHosts hay không
+func (s *server) callbackHostAllowed(host string) bool {
+	for _, allowed := range s.cfg.CallbackAllowedHosts {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// internalIP cho biết ip thuộc loopback, mạng riêng, link-local hay là địa chỉ không xác định
+func internalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// internalDialControl chặn kết nối tới địa chỉ nội bộ sau khi đã phân giải DNS
+// Kiểm tra ở lúc kết nối nên tên miền đổi sang IP nội bộ sau lần kiểm tra URL (DNS rebinding) cũng bị chặn
+func internalDialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || internalIP(ip) {
+		return fmt.Errorf("%w: %s", errInternalAddress, host)
+	}
+	return nil
+}
+
+// guardedDialContext trả về hàm DialContext chặn địa chỉ nội bộ, trừ các host mà allowed chấp nhận
+// Host được xét theo từng lần kết nối nên cũng áp dụng cho URL sau chuyển hướng
+func guardedDialContext(timeout time.Duration, allowed func(host string) bool) func(ctx context.Context, network, address string) (net.Conn, error) {
+	open := &net.Dialer{Timeout: timeout}
+	guarded := &net.Dialer{Timeout: timeout, Control: internalDialControl}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(address); err == nil && allowed(host) {
+			return open.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+}
+
+// signWebhook tính chữ ký HMAC-SHA256 của body theo định dạng của header X-OCR-Signature
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// errWebhookRejected được trả về khi receiver từ chối callback với lỗi 4xx, gửi lại cũng không có ích
+var errWebhookRejected = errors.New("callback rejected")
+
+// deliverWebhook POST job đã xong tới callbackURL, gửi lại tối đa cfg.WebhookRetries lần khi lỗi
+// Body giống response của GET /ocr/jobs/{job_id}, lỗi gửi chỉ được ghi log vì client vẫn có thể polling
+func (s *server) deliverWebhook(reqID, callbackURL string, job ocrJob) {
+	body, err := json.Marshal(job)
+	if err != nil {
+		s.logger.Error("[%s] Cannot encode callback for job %s: %v", reqID, job.ID, err)
+		return
+	}
+
+	// Host trong CallbackAllowedHosts được kết nối tới cả địa chỉ nội bộ, các host khác bị kiểm tra sau khi phân giải
+	// Không dùng proxy từ biến môi trường vì khi đó địa chỉ được kết nối là của proxy chứ không phải của receiver
+	// Không theo redirect để callback chỉ tới đúng URL client đã đăng ký
+	client := &http.Client{
+		Timeout:   s.cfg.WebhookTimeout,
+		Transport: &http.Transport{DialContext: guardedDialContext(s.cfg.WebhookTimeout, s.callbackHostAllowed)},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	for attempt := 0; ; attempt++ {
+		err := s.postWebhook(client, callbackURL, job.ID, body)
+		if err == nil {
+			s.logger.Info("[%s] Delivered callback for job %s", reqID, job.ID)
+			return
+		}
+		if errors.Is(err, errWebhookRejected) || errors.Is(err, errInternalAddress) || attempt >= s.cfg.WebhookRetries {
+			s.logger.Error("[%s] Failed to deliver callback for job %s after %d attempts: %v", reqID, job.ID, attempt+1, err)
+			return
+		}
+
+		backoff := webhookRetryBackoff << attempt
+		s.logger.Warning("[%s] Callback attempt %d for job %s failed, retrying in %v: %v", reqID, attempt+1, job.ID, backoff, err)
+		time.Sleep(backoff)
+	}
+}
+
+// postWebhook gửi body một lần, trả về nil khi receiver trả về 2xx
+func (s *server) postWebhook(client *http.Client, callbackURL, jobID string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-OCR-Job-ID", jobID)
+	if s.cfg.WebhookSecret != "" {
+		req.Header.Set(webhookSignatureHeader, signWebhook(s.cfg.WebhookSecret, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusRequestTimeout:
+		return fmt.Errorf("%w: unexpected status %s", errWebhookRejected, resp.Status)
+	}
+	return fmt.Errorf("unexpected status %s", resp.Status)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// submitJobWithCallback gửi ảnh tới /ocr/jobs kèm callback_url và trả về job_id
+func submitJobWithCallback(t *testing.T, handler http.Handler, callbackURL string) string {
+	t.Helper()
+
+	req := newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{"callback_url": callbackURL})
+	req.URL.Path = "/ocr/jobs"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Submit status = %d, want %d, body: %s", rec.Code, http.StatusAccepted, rec.Body.String())
+	}
+
+	var resp map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Cannot decode submit response: %v", err)
+	}
+	return resp["job_id"]
+}
+
+// webhookDelivery là một callback receiver đã nhận được
+type webhookDelivery struct {
+	body      []byte
+	signature string
+	jobID     string
+}
+
+func TestAsyncJobCallback(t *testing.T) {
+	// Receiver lỗi ở lần đầu để kiểm tra callback được gửi lại
+	var attempts atomic.Int32
+	deliveries := make(chan webhookDelivery, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- webhookDelivery{body, r.Header.Get(webhookSignatureHeader), r.Header.Get("X-OCR-Job-ID")}
+	}))
+	defer receiver.Close()
+
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 1)
+	srv.cfg.WebhookSecret = "secret"
+	srv.cfg.CallbackAllowedHosts = []string{"127.0.0.1"}
+	id := submitJobWithCallback(t, srv.routes(), receiver.URL+"/hook")
+
+	var delivery webhookDelivery
+	select {
+	case delivery = <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Callback not delivered, %d attempts", attempts.Load())
+	}
+
+	var job ocrJob
+	if err := json.Unmarshal(delivery.body, &job); err != nil {
+		t.Fatalf("Cannot decode callback payload %s: %v", delivery.body, err)
+	}
+	if job.ID != id || delivery.jobID != id || job.Status != jobDone || len(job.Results) != 1 || job.Results[0].Text == "" {
+		t.Errorf("Callback payload = %s, want the results of job %s", delivery.body, id)
+	}
+	if want := signWebhook("secret", delivery.body); delivery.signature != want {
+		t.Errorf("Signature = %q, want %q", delivery.signature, want)
+	}
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("Receiver got %d attempts, want 2", got)
+	}
+}
+
+func TestAsyncJobCallbackGivesUp(t *testing.T) {
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 1)
+	srv.cfg.WebhookRetries = 1
+	srv.cfg.CallbackAllowedHosts = []string{"127.0.0.1"}
+	submitJobWithCallback(t, srv.routes(), receiver.URL)
+
+	// Job và việc gửi callback chạy trong background, chờ tất cả kết thúc
+	srv.background.Wait()
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("Receiver got %d attempts, want 2 (first delivery and one retry)", got)
+	}
+}
+
+func TestAsyncJobRejectsInvalidCallbackURL(t *testing.T) {
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 1)
+
+	for _, callbackURL := range []string{"file:///etc/passwd", "http://", "not a url"} {
+		req := newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{"callback_url": callbackURL})
+		req.URL.Path = "/ocr/jobs"
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("callback_url %q: status = %d, want %d", callbackURL, rec.Code, http.StatusBadRequest)
+		}
+	}
+	if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+		t.Errorf("Temp dir contains %d entries after rejected jobs", len(entries))
+	}
+}
+
+func TestAsyncJobRefusesLoopbackCallback(t *testing.T) {
+	var attempts atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+	}))
+	defer receiver.Close()
+	receiverURL, _ := url.Parse(receiver.URL)
+
+	srv := newTestServer(t, writeStubScript(t, stubOCRScript), 1)
+	srv.cfg.WebhookRetries = 2
+
+	// IP nội bộ bị từ chối ngay khi submit
+	for _, callbackURL := range []string{receiver.URL, "http://10.0.0.1/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]/hook", "http://0.0.0.0/hook"} {
+		req := newUploadRequest(t, "image.png", encodePNG(t, 20, 20), map[string]string{"callback_url": callbackURL})
+		req.URL.Path = "/ocr/jobs"
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("callback_url %q: status = %d, want %d", callbackURL, rec.Code, http.StatusBadRequest)
+		}
+	}
+
+	// Tên miền phân giải ra loopback bị chặn lúc kết nối và không được gửi lại
+	submitJobWithCallback(t, srv.routes(), "http://localhost:"+receiverURL.Port()+"/hook")
+	srv.background.Wait()
+	if got := attempts.Load(); got != 0 {
+		t.Errorf("Receiver got %d attempts, want the loopback callback refused", got)
+	}
+	if log := readLog(t, srv.logger); !strings.Contains(log, "after 1 attempts") {
+		t.Errorf("Log does not show a single refused attempt:\n%s", log)
+	}
+
+	// Host trong allowlist vẫn được gửi callback
+	srv.cfg.CallbackAllowedHosts = []string{"localhost"}
+	submitJobWithCallback(t, srv.routes(), "http://localhost:"+receiverURL.Port()+"/hook")
+	srv.background.Wait()
+	if got := attempts.Load(); got != 1 {
+		t.Errorf("Receiver got %d attempts, want 1 for an allowlisted host", got)
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"logger"
+)
+
+// workerRequest là một dòng JSON gửi tới worker Python qua stdin
+type workerRequest struct {
+	// ID được worker gửi lại trong response để ghép đúng kết quả với request
+	ID        uint64 `json:"id"`
+	ImagePath string `json:"image_path"`
+	MaxWidth  int    `json:"max_width"`
+	MaxHeight int    `json:"max_height"`
+	Lang      string `json:"lang,omitempty"`
+}
+
+// workerResponse là một dòng JSON worker Python trả về qua stdout
+type workerResponse struct {
+	// ID là ID của request tương ứng, 0 nếu script không gửi lại ID
+	ID      uint64      `json:"id"`
+	Results []OCRResult `json:"results"`
+	Error   string      `json:"error"`
+	// raw là các dòng stdout đã đọc cho request này, kể cả dòng không phải JSON bị bỏ qua
+	raw []byte
+}
+
+// errPoolClosed được trả về khi pool đã bị đóng
+var errPoolClosed = errors.New("OCR worker pool is closed")
+
+// errWorkerFailed được trả về khi worker crash hoặc không khởi động lại được,
+// request có thể chạy lại bằng script một lần
+var errWorkerFailed = errors.New("OCR worker failed")
+
+// ocrWorker là một tiến trình Python chạy ở chế độ --worker
+type ocrWorker struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	done   chan struct{}
+}
+
+// workerPool quản lý N tiến trình Python chạy thường trực để tránh phải nạp model mỗi request
+type workerPool struct {
+	// cfg cho biết trình thông dịch, tham số và script dùng để khởi động worker
+	cfg    Config
+	logger *logger.Logger
+
+	// idle chứa các worker đang rảnh, phần tử nil là slot cần khởi động lại worker
+	idle chan *ocrWorker
+
+	// nextID tạo ID tương quan cho mỗi request gửi tới worker
+	nextID atomic.Uint64
+
+	mu      sync.Mutex
+	closed  bool
+	workers map[*ocrWorker]struct{}
+}
+
+// newWorkerPool khởi động size tiến trình worker
+func newWorkerPool(cfg Config, size int, l *logger.Logger) (*workerPool, error) {
+	p := &workerPool{
+		cfg:     cfg,
+		logger:  l,
+		idle:    make(chan *ocrWorker, size),
+		workers: make(map[*ocrWorker]struct{}),
+	}
+
+	for i := 0; i < size; i++ {
+		w, err := p.startWorker()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.idle <- w
+	}
+
+	return p, nil
+}
+
+// startWorker khởi động một tiến trình Python ở chế độ worker
+func (p *workerPool) startWorker() (*ocrWorker, error) {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return nil, errPoolClosed
+	}
+
+	cmd := p.cfg.pythonCommand(context.Background(), "--worker")
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating worker stdin: %v", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating worker stdout: %v", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating worker stderr: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting OCR worker: %v", err)
+	}
+
+	w := &ocrWorker{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+		done:   make(chan struct{}),
+	}
+
+	// Chuyển stderr của worker vào log để không bị mất thông tin lỗi từ Python
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			p.logger.Warning("OCR worker %d: %s", cmd.Process.Pid, scanner.Text())
+		}
+		cmd.Wait()
+		close(w.done)
+	}()
+
+	p.mu.Lock()
+	p.workers[w] = struct{}{}
+	p.mu.Unlock()
+
+	p.logger.Info("Started OCR worker %d", cmd.Process.Pid)
+	return w, nil
+}
+
+// stopWorker dừng một worker và bỏ nó khỏi danh sách quản lý
+func (p *workerPool) stopWorker(w *ocrWorker) {
+	p.mu.Lock()
+	delete(p.workers, w)
+	p.mu.Unlock()
+
+	w.stdin.Close()
+	w.cmd.Process.Kill()
+	<-w.done
+}
+
+// process gửi một request tới worker rảnh và chờ kết quả tối đa timeout hoặc tới khi ctx bị hủy,
+// worker bị crash, bị treo quá thời gian hoặc bị bỏ giữa chừng sẽ bị dừng và khởi động lại
+func (p *workerPool) process(ctx context.Context, req workerRequest, timeout time.Duration) ([]OCRResult, error) {
+	// Client ngắt kết nối khi đang chờ worker rảnh thì không gửi request tới worker nữa
+	var w *ocrWorker
+	select {
+	case idle, ok := <-p.idle:
+		if !ok {
+			return nil, errPoolClosed
+		}
+		w = idle
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	// Slot trống do lần khởi động lại trước bị lỗi, thử khởi động lại worker
+	if w == nil {
+		var err error
+		if w, err = p.startWorker(); err != nil {
+			p.release(nil)
+			if errors.Is(err, errPoolClosed) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %v", errWorkerFailed, err)
+		}
+	}
+
+	req.ID = p.nextID.Add(1)
+
+	resp, err := w.roundTripTimeout(ctx, req, timeout)
+	if err != nil {
+		switch {
+		case errors.Is(err, errOCRTimeout):
+			p.logger.Error("OCR worker %d timed out after %v, restarting", w.cmd.Process.Pid, timeout)
+		case errors.Is(err, context.Canceled):
+			p.logger.Warning("OCR request canceled, restarting OCR worker %d", w.cmd.Process.Pid)
+		default:
+			p.logger.Error("OCR worker %d crashed, restarting: %v", w.cmd.Process.Pid, err)
+		}
+		p.stopWorker(w)
+
+		replacement, startErr := p.startWorker()
+		if startErr != nil {
+			p.logger.Error("Failed to restart OCR worker: %v", startErr)
+		}
+		p.release(replacement)
+		if errors.Is(err, errOCRTimeout) || errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errWorkerFailed, err)
+	}
+
+	p.release(w)
+	recordDebug(ctx, debugSourceWorker, string(resp.raw), "")
+
+	// Worker trả lỗi qua trường error thay vì stderr nên được phân loại theo cùng cách
+	if resp.Error != "" {
+		return nil, newOCRError(errors.New("OCR worker error"), resp.Error)
+	}
+	return resp.Results, nil
+}
+
+// release trả worker về pool, dừng worker nếu pool đã đóng
+func (p *workerPool) release(w *ocrWorker) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		if w != nil {
+			go p.stopWorker(w)
+		}
+		return
+	}
+	p.idle <- w
+}
+
+// roundTripTimeout chạy roundTrip và trả về errOCRTimeout nếu worker không trả lời kịp hoặc
+// context.Canceled nếu ctx bị hủy, khi đó goroutine đọc kết quả chỉ kết thúc sau khi worker bị dừng
+func (w *ocrWorker) roundTripTimeout(ctx context.Context, req workerRequest, timeout time.Duration) (workerResponse, error) {
+	type result struct {
+		resp workerResponse
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := w.roundTrip(req)
+		done <- result{resp, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.resp, r.err
+	case <-timer.C:
+		return workerResponse{}, errOCRTimeout
+	case <-ctx.Done():
+		return workerResponse{}, context.Canceled
+	}
+}
+
+// roundTrip gửi một request và đọc dòng JSON kết quả tương ứng
+func (w *ocrWorker) roundTrip(req workerRequest) (workerResponse, error) {
+	line, err := json.Marshal(req)
+	if err != nil {
+		return workerResponse{}, err
+	}
+	if _, err := w.stdin.Write(append(line, '\n')); err != nil {
+		return workerResponse{}, fmt.Errorf("error writing to worker: %v", err)
+	}
+
+	var raw []byte
+	for {
+		out, err := w.stdout.ReadBytes('\n')
+		if err != nil {
+			return workerResponse{}, fmt.Errorf("error reading from worker: %v", err)
+		}
+		raw = append(raw, out...)
+
+		// Bỏ qua các dòng không phải JSON mà thư viện có thể in ra stdout
+		out = bytes.TrimSpace(out)
+		if len(out) == 0 || out[0] != '{' {
+			continue
+		}
+
+		var resp workerResponse
+		if err := json.Unmarshal(out, &resp); err != nil {
+			return workerResponse{}, fmt.Errorf("error parsing worker response: %v", err)
+		}
+
+		// Bỏ qua response của request khác, ví dụ dòng còn sót lại trong pipe
+		if resp.ID != 0 && resp.ID != req.ID {
+			continue
+		}
+		resp.raw = raw
+		return resp, nil
+	}
+}
+
+// busy trả về số slot worker đang xử lý request
+func (p *workerPool) busy() int {
+	return cap(p.idle) - len(p.idle)
+}
+
+// alive trả về số worker chưa thoát, 0 khi pool đã đóng
+func (p *workerPool) alive() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return 0
+	}
+
+	count := 0
+	for w := range p.workers {
+		select {
+		case <-w.done:
+		default:
+			count++
+		}
+	}
+	return count
+}
+
+// Close dừng toàn bộ worker trong pool
+func (p *workerPool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.idle)
+	workers := make([]*ocrWorker, 0, len(p.workers))
+	for w := range p.workers {
+		workers = append(workers, w)
+	}
+	p.mu.Unlock()
+
+	for _, w := range workers {
+		p.stopWorker(w)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// stubOCRScript giả lập ocr.py: tốn thời gian "nạp model" khi khởi động,
+// ghi lại mỗi lần nạp vào file loads, mỗi lần gọi vào file calls và trả về tên file ảnh làm text
+const stubOCRScript = `
+import sys, json, os, time
+
+stub_dir = os.path.dirname(os.path.abspath(__file__))
+
+time.sleep(float(os.environ.get("STUB_LOAD_SECONDS", "0")))
+with open(os.path.join(stub_dir, "loads"), "a") as f:
+    f.write("load\n")
+
+def recognize(path, lang, worker):
+    with open(os.path.join(stub_dir, "calls"), "a") as f:
+        f.write(json.dumps({"image_path": path, "lang": lang}) + "\n")
+    # "worker_crash" chỉ làm worker crash, "crash" làm crash cả khi chạy một lần
+    if "worker_crash" in path:
+        if worker:
+            os._exit(1)
+    elif "crash" in path:
+        os._exit(1)
+    return [{"coords": [[0, 0], [10, 0], [10, 10], [0, 10]], "text": os.path.basename(path), "confidence": 0.9}]
+
+if sys.argv[1] == "--worker":
+    for line in sys.stdin:
+        request = json.loads(line)
+        # Response thừa với ID khác phải bị phía Go bỏ qua
+        if "stale" in request["image_path"]:
+            print(json.dumps({"id": request["id"] + 1000, "results": []}), flush=True)
+        results = recognize(request["image_path"], request.get("lang", ""), True)
+        print(json.dumps({"id": request["id"], "results": results}), flush=True)
+else:
+    print(json.dumps(recognize(sys.argv[1], sys.argv[4] if len(sys.argv) > 4 else "", False)))
+`
+
+// writeStubScript ghi script giả lập vào thư mục tạm và trả về đường dẫn
+func writeStubScript(tb testing.TB, source string) string {
+	tb.Helper()
+	path := filepath.Join(tb.TempDir(), "stub_ocr.py")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		tb.Fatalf("Failed to write stub script: %v", err)
+	}
+	return path
+}
+
+// countLoads đếm số lần script giả lập đã "nạp model"
+func countLoads(tb testing.TB, scriptPath string) int {
+	tb.Helper()
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(scriptPath), "loads"))
+	if err != nil {
+		return 0
+	}
+	return strings.Count(string(content), "load\n")
+}
+
+// stubCall là một lần script giả lập được gọi
+type stubCall struct {
+	ImagePath string `json:"image_path"`
+	Lang      string `json:"lang"`
+}
+
+// readCalls đọc danh sách các lần script giả lập được gọi
+func readCalls(tb testing.TB, scriptPath string) []stubCall {
+	tb.Helper()
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(scriptPath), "calls"))
+	if err != nil {
+		return nil
+	}
+
+	var calls []stubCall
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var call stubCall
+		if err := json.Unmarshal([]byte(line), &call); err != nil {
+			tb.Fatalf("Cannot decode stub call %q: %v", line, err)
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// newTestServer tạo server dùng script giả lập với số worker cho trước
+func newTestServer(tb testing.TB, scriptPath string, workers int) *server {
+	tb.Helper()
+	cfg := defaultConfig()
+	cfg.TempDir = tb.TempDir()
+	cfg.ScriptPath = scriptPath
+	cfg.Workers = workers
+
+	srv, err := newServer(cfg, newTestLogger(tb))
+	if err != nil {
+		tb.Fatalf("Failed to create server: %v", err)
+	}
+	tb.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWorkerPoolLoadsModelOnce(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 1)
+
+	for i := 0; i < 3; i++ {
+		results, err := srv.processPaddleOCR(context.Background(), "image.png", 800, 800, "")
+		if err != nil {
+			t.Fatalf("processPaddleOCR() error = %v", err)
+		}
+		if len(results) != 1 || results[0].Text != "image.png" {
+			t.Fatalf("Unexpected results: %+v", results)
+		}
+	}
+
+	if loads := countLoads(t, script); loads != 1 {
+		t.Errorf("Model loaded %d times, want 1", loads)
+	}
+}
+
+func TestWorkerPoolRestartsCrashedWorker(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 1)
+
+	if _, err := srv.processPaddleOCR(context.Background(), "crash.png", 800, 800, ""); err == nil {
+		t.Fatal("Expected error when the worker crashes")
+	}
+
+	results, err := srv.processPaddleOCR(context.Background(), "image.png", 800, 800, "")
+	if err != nil {
+		t.Fatalf("processPaddleOCR() after crash error = %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("Unexpected results after restart: %+v", results)
+	}
+
+	// Request lỗi được chạy lại bằng script một lần, script đó cũng crash
+	if loads := countLoads(t, script); loads != 3 {
+		t.Errorf("Model loaded %d times, want 3 (initial start, restart and one-shot fallback)", loads)
+	}
+}
+
+func TestWorkerPoolFallsBackToOneShot(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 1)
+
+	results, err := srv.processPaddleOCR(context.Background(), "worker_crash.png", 800, 800, "")
+	if err != nil {
+		t.Fatalf("processPaddleOCR() error = %v, want the one-shot fallback to succeed", err)
+	}
+	if len(results) != 1 || results[0].Text != "worker_crash.png" {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+
+	// Worker đã được khởi động lại và tiếp tục phục vụ các request sau
+	if _, err := srv.processPaddleOCR(context.Background(), "image.png", 800, 800, ""); err != nil {
+		t.Fatalf("processPaddleOCR() after fallback error = %v", err)
+	}
+	if loads := countLoads(t, script); loads != 3 {
+		t.Errorf("Model loaded %d times, want 3 (initial start, restart and one-shot fallback)", loads)
+	}
+}
+
+func TestWorkerPoolSkipsStaleResponses(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 1)
+
+	for _, name := range []string{"stale.png", "image.png"} {
+		results, err := srv.processPaddleOCR(context.Background(), name, 800, 800, "")
+		if err != nil {
+			t.Fatalf("processPaddleOCR(%s) error = %v", name, err)
+		}
+		if len(results) != 1 || results[0].Text != name {
+			t.Errorf("processPaddleOCR(%s) = %+v, want the response with the matching ID", name, results)
+		}
+	}
+}
+
+func TestProcessPaddleOCRWithoutWorkers(t *testing.T) {
+	script := writeStubScript(t, stubOCRScript)
+	srv := newTestServer(t, script, 0)
+
+	for i := 0; i < 2; i++ {
+		if _, err := srv.processPaddleOCR(context.Background(), "image.png", 800, 800, ""); err != nil {
+			t.Fatalf("processPaddleOCR() error = %v", err)
+		}
+	}
+
+	if loads := countLoads(t, script); loads != 2 {
+		t.Errorf("Model loaded %d times, want 2 (one per request)", loads)
+	}
+}
+
+// benchmarkOCR đo thời gian xử lý với số worker cho trước,
+// script giả lập mất 100ms để nạp model giống chi phí khởi tạo PaddleOCR
+func benchmarkOCR(b *testing.B, workers int) {
+	b.Setenv("STUB_LOAD_SECONDS", "0.1")
+	script := writeStubScript(b, stubOCRScript)
+	srv := newTestServer(b, script, workers)
+
+	// Chờ worker nạp model xong trước khi đo
+	if workers > 0 {
+		if _, err := srv.processPaddleOCR(context.Background(), "warmup.png", 800, 800, ""); err != nil {
+			b.Fatalf("Warmup failed: %v", err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := srv.processPaddleOCR(context.Background(), "image.png", 800, 800, ""); err != nil {
+			b.Fatalf("processPaddleOCR() error = %v", err)
+		}
+	}
+}
+
+func BenchmarkProcessPaddleOCRCold(b *testing.B) {
+	benchmarkOCR(b, 0)
+}
+
+func BenchmarkProcessPaddleOCRWarm(b *testing.B) {
+	benchmarkOCR(b, 1)
+}
+
+// slowOCRScript giả lập script bị treo: ghi PID vào file pid rồi ngủ rất lâu
+const slowOCRScript = `
+import sys, os, time
+
+stub_dir = os.path.dirname(os.path.abspath(__file__))
+with open(os.path.join(stub_dir, "pid"), "a") as f:
+    f.write("%d\n" % os.getpid())
+
+if sys.argv[1] == "--worker":
+    for line in sys.stdin:
+        time.sleep(60)
+else:
+    time.sleep(60)
+`
+
+// processAlive cho biết tiến trình có PID trong file pid của script giả lập còn chạy không
+func processAlive(tb testing.TB, scriptPath string) bool {
+	tb.Helper()
+	content, err := os.ReadFile(filepath.Join(filepath.Dir(scriptPath), "pid"))
+	if err != nil {
+		tb.Fatalf("Stub script didn't record its PID: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.Fields(string(content))[0])
+	if err != nil {
+		tb.Fatalf("Invalid PID %q: %v", content, err)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+func TestHandleOCRTimeout(t *testing.T) {
+	for _, workers := range []int{0, 1} {
+		script := writeStubScript(t, slowOCRScript)
+		srv := newTestServer(t, script, workers)
+		srv.cfg.OCRTimeout = 200 * time.Millisecond
+
+		start := time.Now()
+		rec := serveOCR(srv, newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil))
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("workers=%d: request took %v, want about the timeout", workers, elapsed)
+		}
+
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Fatalf("workers=%d: status = %d, want 504, body: %s", workers, rec.Code, rec.Body.String())
+		}
+		var resp ocrErrorResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || resp.Kind != ocrErrorTimeout || resp.Code != "ocr_timeout" {
+			t.Errorf("workers=%d: response = %s, want kind %s with code ocr_timeout", workers, rec.Body.String(), ocrErrorTimeout)
+		}
+
+		if processAlive(t, script) {
+			t.Errorf("workers=%d: OCR process still running after the timeout", workers)
+		}
+		if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+			t.Errorf("workers=%d: temp dir contains %d entries after the timeout", workers, len(entries))
+		}
+	}
+}
+
+// waitForPID chờ script giả lập ghi PID, tức là tiến trình OCR đã bắt đầu chạy
+func waitForPID(tb testing.TB, scriptPath string) {
+	tb.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if content, err := os.ReadFile(filepath.Join(filepath.Dir(scriptPath), "pid")); err == nil && len(content) > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tb.Fatal("OCR process did not start")
+}
+
+func TestHandleOCRClientDisconnect(t *testing.T) {
+	for _, workers := range []int{0, 1} {
+		script := writeStubScript(t, slowOCRScript)
+		srv := newTestServer(t, script, workers)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req := newUploadRequest(t, "image.png", encodePNG(t, 20, 20), nil).WithContext(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			serveOCR(srv, req)
+		}()
+
+		// Client ngắt kết nối khi script đang chạy
+		waitForPID(t, script)
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("workers=%d: handler still running after the request was canceled", workers)
+		}
+
+		if processAlive(t, script) {
+			t.Errorf("workers=%d: OCR process still running after the client disconnected", workers)
+		}
+		if entries, _ := os.ReadDir(srv.cfg.TempDir); len(entries) != 0 {
+			t.Errorf("workers=%d: temp dir contains %d entries after the client disconnected", workers, len(entries))
+		}
+	}
+}
+
+func TestWorkerPoolCanceledWhileWorkersBusy(t *testing.T) {
+	script := writeStubScript(t, slowOCRScript)
+	srv := newTestServer(t, script, 1)
+
+	// Worker duy nhất bận với request đầu tiên
+	busyCtx, cancelBusy := context.WithCancel(context.Background())
+	defer cancelBusy()
+	go srv.pool.process(busyCtx, workerRequest{ImagePath: "busy.png"}, time.Minute)
+	waitForPID(t, script)
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.pool.nextID.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	if _, err := srv.pool.process(ctx, workerRequest{ImagePath: "waiting.png"}, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("process() canceled while waiting for a worker error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("process() returned after %v, want soon after the cancel", elapsed)
+	}
+	if dispatched := srv.pool.nextID.Load(); dispatched != 1 {
+		t.Errorf("%d requests dispatched to workers, want only the busy one", dispatched)
+	}
+}